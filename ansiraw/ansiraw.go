@@ -1,29 +1,349 @@
+// Package ansiraw decodes the raw byte sequences terminals send for key
+// presses and mouse reports into events.
 package ansiraw
 
-import "bytes"
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const ESC = 0x1B
 
-func ParseRaw(raw []byte) RawEvent {
+type KeyCode int
 
-	var (
-		pageUp   = []byte{ESC, '[', '5', '~'}
-		pageDown = []byte{ESC, '[', '6', '~'}
-	)
+const (
+	KeyUnknown KeyCode = iota
+	// KeyRune is a character key, see Key.Rune
+	KeyRune
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyEscape
+	KeyUp
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+)
 
-	if bytes.Equal(raw, pageUp) {
-		return PageUp
-	} else if bytes.Equal(raw, pageDown) {
-		return PageDown
+var keyNames = map[KeyCode]string{
+	KeyUnknown:   "unknown",
+	KeyEnter:     "enter",
+	KeyTab:       "tab",
+	KeyBackspace: "backspace",
+	KeyEscape:    "escape",
+	KeyUp:        "up",
+	KeyDown:      "down",
+	KeyRight:     "right",
+	KeyLeft:      "left",
+	KeyHome:      "home",
+	KeyEnd:       "end",
+	KeyInsert:    "insert",
+	KeyDelete:    "delete",
+	KeyPageUp:    "page_up",
+	KeyPageDown:  "page_down",
+}
+
+func (c KeyCode) String() string {
+	if c >= KeyF1 && c <= KeyF12 {
+		return "f" + strconv.Itoa(int(c-KeyF1)+1)
 	}
+	if name, ok := keyNames[c]; ok {
+		return name
+	}
+	return "key(" + strconv.Itoa(int(c)) + ")"
+}
 
-	return Unknown
+// Modifier is a bitmask of modifier keys. The values match the xterm
+// modifier parameter minus one.
+type Modifier int
+
+const (
+	ModShift Modifier = 1 << iota
+	ModAlt
+	ModCtrl
+	ModMeta
+)
+
+// Key is a decoded key press.
+type Key struct {
+	Code KeyCode
+	// Rune is set for KeyRune. Control characters are reported as the
+	// corresponding lowercase letter with ModCtrl set.
+	Rune rune
+	Mod  Modifier
 }
 
-const ESC = 0x1B
+func (k Key) String() string {
+	var parts []string
+	if k.Mod&ModCtrl != 0 {
+		parts = append(parts, "ctrl")
+	}
+	if k.Mod&ModAlt != 0 {
+		parts = append(parts, "alt")
+	}
+	if k.Mod&ModMeta != 0 {
+		parts = append(parts, "meta")
+	}
+	if k.Mod&ModShift != 0 {
+		parts = append(parts, "shift")
+	}
+	if k.Code == KeyRune {
+		parts = append(parts, string(k.Rune))
+	} else {
+		parts = append(parts, k.Code.String())
+	}
+	return strings.Join(parts, "+")
+}
+
+// Is reports whether k is the character r with exactly the modifiers mod.
+func (k Key) Is(r rune, mod Modifier) bool {
+	return k.Code == KeyRune && k.Rune == r && k.Mod == mod
+}
+
+// ParseRaw decodes a single key press. Unrecognized input returns a Key
+// with Code KeyUnknown.
+func ParseRaw(raw []byte) Key {
+	if len(raw) == 0 {
+		return Key{}
+	}
+
+	if raw[0] != ESC || len(raw) == 1 {
+		return parsePlain(raw)
+	}
+
+	switch raw[1] {
+	case '[':
+		if len(raw) > 2 {
+			return parseCSI(raw[2:])
+		}
+	case 'O':
+		if len(raw) > 2 {
+			return parseSS3(raw[2:])
+		}
+	}
+
+	// alt sends an escape before the key
+	k := ParseRaw(raw[1:])
+	if k.Code == KeyUnknown {
+		return k
+	}
+	k.Mod |= ModAlt
+	return k
+}
 
-type RawEvent string
+func parsePlain(raw []byte) Key {
+	r, size := utf8.DecodeRune(raw)
+	if size != len(raw) || r == utf8.RuneError {
+		return Key{}
+	}
+
+	switch {
+	case r == '\r':
+		return Key{Code: KeyEnter}
+	case r == '\t':
+		return Key{Code: KeyTab}
+	case r == 0x7f || r == 0x08:
+		return Key{Code: KeyBackspace}
+	case r == ESC:
+		return Key{Code: KeyEscape}
+	case r == 0:
+		return Key{Code: KeyRune, Rune: ' ', Mod: ModCtrl}
+	case r <= 0x1a:
+		// ctrl-a is 0x01
+		return Key{Code: KeyRune, Rune: r + 0x60, Mod: ModCtrl}
+	case r < 0x20:
+		// ctrl-\ is 0x1c
+		return Key{Code: KeyRune, Rune: r + 0x40, Mod: ModCtrl}
+	}
+
+	return Key{Code: KeyRune, Rune: r}
+}
+
+// parseCSI decodes the part of a CSI sequence after ESC [.
+func parseCSI(b []byte) Key {
+	final := b[len(b)-1]
+	params := parseParams(b[:len(b)-1])
+
+	var k Key
+	switch final {
+	case 'A':
+		k.Code = KeyUp
+	case 'B':
+		k.Code = KeyDown
+	case 'C':
+		k.Code = KeyRight
+	case 'D':
+		k.Code = KeyLeft
+	case 'H':
+		k.Code = KeyHome
+	case 'F':
+		k.Code = KeyEnd
+	case 'P', 'Q', 'R', 'S':
+		k.Code = KeyF1 + KeyCode(final-'P')
+	case 'Z':
+		return Key{Code: KeyTab, Mod: ModShift}
+	case 'u':
+		if len(params) == 0 {
+			return Key{}
+		}
+		k = kittyKey(params[0])
+		if k.Code == KeyUnknown {
+			return Key{}
+		}
+	case '~':
+		if len(params) == 0 {
+			return Key{}
+		}
+		code, ok := tildeKeys[params[0]]
+		if !ok {
+			return Key{}
+		}
+		k.Code = code
+	default:
+		return Key{}
+	}
+
+	if len(params) > 1 {
+		k.Mod = modifier(params[1])
+	}
+
+	return k
+}
+
+// parseSS3 decodes the part of an SS3 sequence after ESC O.
+func parseSS3(b []byte) Key {
+	var k Key
+
+	// some terminals send the modifier before the final byte
+	final := b[len(b)-1]
+	if len(b) > 1 {
+		mod, err := strconv.Atoi(string(b[:len(b)-1]))
+		if err != nil {
+			return Key{}
+		}
+		k.Mod = modifier(mod)
+	}
+
+	switch final {
+	case 'A':
+		k.Code = KeyUp
+	case 'B':
+		k.Code = KeyDown
+	case 'C':
+		k.Code = KeyRight
+	case 'D':
+		k.Code = KeyLeft
+	case 'H':
+		k.Code = KeyHome
+	case 'F':
+		k.Code = KeyEnd
+	case 'P', 'Q', 'R', 'S':
+		k.Code = KeyF1 + KeyCode(final-'P')
+	case 'M':
+		k.Code = KeyEnter
+	default:
+		return Key{}
+	}
+
+	return k
+}
+
+// kittyKey converts the key code of a kitty keyboard protocol CSI u
+// sequence. Text keys are reported as their unicode code point.
+func kittyKey(code int) Key {
+	switch code {
+	case 13, kittyKeypadEnter:
+		return Key{Code: KeyEnter}
+	case 9:
+		return Key{Code: KeyTab}
+	case 127, 8:
+		return Key{Code: KeyBackspace}
+	case 27:
+		return Key{Code: KeyEscape}
+	}
+
+	if code < 0x20 || (code >= kittyPrivateUseStart && code <= kittyPrivateUseEnd) || !utf8.ValidRune(rune(code)) {
+		return Key{}
+	}
+	return Key{Code: KeyRune, Rune: rune(code)}
+}
 
 const (
-	Unknown  RawEvent = "unknown"
-	PageDown RawEvent = "page_down"
-	PageUp   RawEvent = "page_up"
+	// kitty encodes keys without a unicode code point (keypad, media
+	// keys, lone modifiers) in the private use area
+	kittyPrivateUseStart = 57344
+	kittyPrivateUseEnd   = 63743
+	kittyKeypadEnter     = 57414
 )
+
+var tildeKeys = map[int]KeyCode{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPageUp,
+	6:  KeyPageDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+}
+
+// parseParams splits semicolon separated numeric parameters. Empty or
+// invalid parameters are returned as 1, the xterm default. Only the
+// first of any colon separated sub-parameters is kept.
+func parseParams(b []byte) []int {
+	if len(b) == 0 {
+		return nil
+	}
+
+	var params []int
+	for _, p := range strings.Split(string(b), ";") {
+		p, _, _ = strings.Cut(p, ":")
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			n = 1
+		}
+		params = append(params, n)
+	}
+	return params
+}
+
+// modifier converts an xterm modifier parameter to a Modifier. Bits we
+// don't track, such as the kitty caps lock and num lock states, are
+// dropped.
+func modifier(param int) Modifier {
+	if param < 1 {
+		return 0
+	}
+	return Modifier(param-1) & (ModShift | ModAlt | ModCtrl | ModMeta)
+}
@@ -0,0 +1,171 @@
+package ansiraw
+
+import "testing"
+
+func TestParseRaw(t *testing.T) {
+	testCases := []struct {
+		name   string
+		raw    string
+		expect Key
+	}{
+		{"empty", "", Key{}},
+		{"letter", "a", Key{Code: KeyRune, Rune: 'a'}},
+		{"upper", "A", Key{Code: KeyRune, Rune: 'A'}},
+		{"unicode", "☃", Key{Code: KeyRune, Rune: '☃'}},
+		{"enter", "\r", Key{Code: KeyEnter}},
+		{"tab", "\t", Key{Code: KeyTab}},
+		{"backspace", "\x7f", Key{Code: KeyBackspace}},
+		{"ctrl-h backspace", "\x08", Key{Code: KeyBackspace}},
+		{"escape", "\x1b", Key{Code: KeyEscape}},
+		{"ctrl-a", "\x01", Key{Code: KeyRune, Rune: 'a', Mod: ModCtrl}},
+		{"ctrl-d", "\x04", Key{Code: KeyRune, Rune: 'd', Mod: ModCtrl}},
+		{"ctrl-space", "\x00", Key{Code: KeyRune, Rune: ' ', Mod: ModCtrl}},
+		{"ctrl-backslash", "\x1c", Key{Code: KeyRune, Rune: '\\', Mod: ModCtrl}},
+
+		{"up", "\x1b[A", Key{Code: KeyUp}},
+		{"down", "\x1b[B", Key{Code: KeyDown}},
+		{"right", "\x1b[C", Key{Code: KeyRight}},
+		{"left", "\x1b[D", Key{Code: KeyLeft}},
+		{"ctrl-right", "\x1b[1;5C", Key{Code: KeyRight, Mod: ModCtrl}},
+		{"shift-up", "\x1b[1;2A", Key{Code: KeyUp, Mod: ModShift}},
+		{"alt-left", "\x1b[1;3D", Key{Code: KeyLeft, Mod: ModAlt}},
+		{"ctrl-shift-down", "\x1b[1;6B", Key{Code: KeyDown, Mod: ModCtrl | ModShift}},
+		{"shift-tab", "\x1b[Z", Key{Code: KeyTab, Mod: ModShift}},
+
+		{"home csi", "\x1b[H", Key{Code: KeyHome}},
+		{"end csi", "\x1b[F", Key{Code: KeyEnd}},
+		{"home tilde", "\x1b[1~", Key{Code: KeyHome}},
+		{"end tilde", "\x1b[4~", Key{Code: KeyEnd}},
+		{"home rxvt", "\x1b[7~", Key{Code: KeyHome}},
+		{"end rxvt", "\x1b[8~", Key{Code: KeyEnd}},
+		{"ctrl-home", "\x1b[1;5H", Key{Code: KeyHome, Mod: ModCtrl}},
+		{"insert", "\x1b[2~", Key{Code: KeyInsert}},
+		{"delete", "\x1b[3~", Key{Code: KeyDelete}},
+		{"shift-delete", "\x1b[3;2~", Key{Code: KeyDelete, Mod: ModShift}},
+		{"page up", "\x1b[5~", Key{Code: KeyPageUp}},
+		{"page down", "\x1b[6~", Key{Code: KeyPageDown}},
+
+		{"f1 ss3", "\x1bOP", Key{Code: KeyF1}},
+		{"f2 ss3", "\x1bOQ", Key{Code: KeyF2}},
+		{"f3 ss3", "\x1bOR", Key{Code: KeyF3}},
+		{"f4 ss3", "\x1bOS", Key{Code: KeyF4}},
+		{"ctrl-f1", "\x1b[1;5P", Key{Code: KeyF1, Mod: ModCtrl}},
+		{"f1 tilde", "\x1b[11~", Key{Code: KeyF1}},
+		{"f5", "\x1b[15~", Key{Code: KeyF5}},
+		{"f6", "\x1b[17~", Key{Code: KeyF6}},
+		{"f7", "\x1b[18~", Key{Code: KeyF7}},
+		{"f8", "\x1b[19~", Key{Code: KeyF8}},
+		{"f9", "\x1b[20~", Key{Code: KeyF9}},
+		{"f10", "\x1b[21~", Key{Code: KeyF10}},
+		{"f11", "\x1b[23~", Key{Code: KeyF11}},
+		{"f12", "\x1b[24~", Key{Code: KeyF12}},
+		{"shift-f12", "\x1b[24;2~", Key{Code: KeyF12, Mod: ModShift}},
+
+		{"up ss3", "\x1bOA", Key{Code: KeyUp}},
+		{"down ss3", "\x1bOB", Key{Code: KeyDown}},
+		{"right ss3", "\x1bOC", Key{Code: KeyRight}},
+		{"left ss3", "\x1bOD", Key{Code: KeyLeft}},
+		{"home ss3", "\x1bOH", Key{Code: KeyHome}},
+		{"end ss3", "\x1bOF", Key{Code: KeyEnd}},
+		{"keypad enter ss3", "\x1bOM", Key{Code: KeyEnter}},
+		{"ctrl-up ss3", "\x1bO5A", Key{Code: KeyUp, Mod: ModCtrl}},
+
+		{"alt-a", "\x1ba", Key{Code: KeyRune, Rune: 'a', Mod: ModAlt}},
+		{"alt-shift-a", "\x1bA", Key{Code: KeyRune, Rune: 'A', Mod: ModAlt}},
+		{"alt-unicode", "\x1b☃", Key{Code: KeyRune, Rune: '☃', Mod: ModAlt}},
+		{"alt-ctrl-a", "\x1b\x01", Key{Code: KeyRune, Rune: 'a', Mod: ModCtrl | ModAlt}},
+		{"alt-backspace", "\x1b\x7f", Key{Code: KeyBackspace, Mod: ModAlt}},
+		{"alt-enter", "\x1b\r", Key{Code: KeyEnter, Mod: ModAlt}},
+		{"alt-up", "\x1b\x1b[A", Key{Code: KeyUp, Mod: ModAlt}},
+		{"alt-O", "\x1bO", Key{Code: KeyRune, Rune: 'O', Mod: ModAlt}},
+		{"alt-[", "\x1b[", Key{Code: KeyRune, Rune: '[', Mod: ModAlt}},
+
+		{"kitty escape", "\x1b[27u", Key{Code: KeyEscape}},
+		{"kitty enter", "\x1b[13u", Key{Code: KeyEnter}},
+		{"kitty shift-enter", "\x1b[13;2u", Key{Code: KeyEnter, Mod: ModShift}},
+		{"kitty ctrl-enter", "\x1b[13;5u", Key{Code: KeyEnter, Mod: ModCtrl}},
+		{"kitty keypad enter", "\x1b[57414u", Key{Code: KeyEnter}},
+		{"kitty tab", "\x1b[9u", Key{Code: KeyTab}},
+		{"kitty ctrl-i", "\x1b[105;5u", Key{Code: KeyRune, Rune: 'i', Mod: ModCtrl}},
+		{"kitty ctrl-m", "\x1b[109;5u", Key{Code: KeyRune, Rune: 'm', Mod: ModCtrl}},
+		{"kitty ctrl-shift-a", "\x1b[97;6u", Key{Code: KeyRune, Rune: 'a', Mod: ModCtrl | ModShift}},
+		{"kitty alt-backspace", "\x1b[127;3u", Key{Code: KeyBackspace, Mod: ModAlt}},
+		{"kitty caps lock ignored", "\x1b[97;69u", Key{Code: KeyRune, Rune: 'a', Mod: ModCtrl}},
+		{"kitty alternate keys", "\x1b[97:65;6u", Key{Code: KeyRune, Rune: 'a', Mod: ModCtrl | ModShift}},
+		{"kitty event type", "\x1b[97;5:1u", Key{Code: KeyRune, Rune: 'a', Mod: ModCtrl}},
+		{"kitty private use", "\x1b[57441;2u", Key{}},
+
+		{"unknown csi", "\x1b[99~", Key{}},
+		{"unknown final", "\x1b[1;5X", Key{}},
+		{"invalid utf8", "\xff", Key{}},
+		{"multiple runes", "ab", Key{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ParseRaw([]byte(tc.raw))
+			if got != tc.expect {
+				t.Errorf("ParseRaw(%q) got %s (%+v) expected %s (%+v)", tc.raw, got, got, tc.expect, tc.expect)
+			}
+		})
+	}
+}
+
+func TestKeyString(t *testing.T) {
+	testCases := []struct {
+		key    Key
+		expect string
+	}{
+		{Key{Code: KeyRune, Rune: 'a'}, "a"},
+		{Key{Code: KeyRune, Rune: 'a', Mod: ModCtrl}, "ctrl+a"},
+		{Key{Code: KeyRight, Mod: ModCtrl | ModShift}, "ctrl+shift+right"},
+		{Key{Code: KeyF11, Mod: ModAlt}, "alt+f11"},
+		{Key{Code: KeyPageDown}, "page_down"},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.key.String(); got != tc.expect {
+			t.Errorf("got %q expected %q", got, tc.expect)
+		}
+	}
+}
+
+func TestParseMouse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		raw      string
+		expectOk bool
+		expect   Mouse
+	}{
+		{"left press", "\x1b[<0;5;3M", true, Mouse{Action: MousePress, Button: MouseLeft, Col: 5, Row: 3}},
+		{"left release", "\x1b[<0;5;3m", true, Mouse{Action: MouseRelease, Button: MouseLeft, Col: 5, Row: 3}},
+		{"right press", "\x1b[<2;10;20M", true, Mouse{Action: MousePress, Button: MouseRight, Col: 10, Row: 20}},
+		{"middle press", "\x1b[<1;1;1M", true, Mouse{Action: MousePress, Button: MouseMiddle, Col: 1, Row: 1}},
+		{"left drag", "\x1b[<32;6;3M", true, Mouse{Action: MouseDrag, Button: MouseLeft, Col: 6, Row: 3}},
+		{"move", "\x1b[<35;6;3M", true, Mouse{Action: MouseMove, Button: MouseNoButton, Col: 6, Row: 3}},
+		{"wheel up", "\x1b[<64;2;4M", true, Mouse{Action: MouseWheelUp, Button: MouseNoButton, Col: 2, Row: 4}},
+		{"wheel down", "\x1b[<65;2;4M", true, Mouse{Action: MouseWheelDown, Button: MouseNoButton, Col: 2, Row: 4}},
+		{"wheel left", "\x1b[<66;2;4M", true, Mouse{Action: MouseWheelLeft, Button: MouseNoButton, Col: 2, Row: 4}},
+		{"wheel right", "\x1b[<67;2;4M", true, Mouse{Action: MouseWheelRight, Button: MouseNoButton, Col: 2, Row: 4}},
+		{"shift wheel right", "\x1b[<71;2;4M", true, Mouse{Action: MouseWheelRight, Button: MouseNoButton, Col: 2, Row: 4, Mod: ModShift}},
+		{"ctrl click", "\x1b[<16;7;8M", true, Mouse{Action: MousePress, Button: MouseLeft, Col: 7, Row: 8, Mod: ModCtrl}},
+		{"shift alt click", "\x1b[<12;7;8M", true, Mouse{Action: MousePress, Button: MouseLeft, Col: 7, Row: 8, Mod: ModShift | ModAlt}},
+		{"large coordinates", "\x1b[<0;300;120M", true, Mouse{Action: MousePress, Button: MouseLeft, Col: 300, Row: 120}},
+
+		{"key", "\x1b[A", false, Mouse{}},
+		{"missing params", "\x1b[<0;5M", false, Mouse{}},
+		{"plain", "a", false, Mouse{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := ParseMouse([]byte(tc.raw))
+			if ok != tc.expectOk {
+				t.Fatalf("ParseMouse(%q) ok=%t expected %t", tc.raw, ok, tc.expectOk)
+			}
+			if got != tc.expect {
+				t.Errorf("ParseMouse(%q) got %+v expected %+v", tc.raw, got, tc.expect)
+			}
+		})
+	}
+}
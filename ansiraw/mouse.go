@@ -0,0 +1,111 @@
+package ansiraw
+
+import "bytes"
+
+type MouseAction int
+
+const (
+	MousePress MouseAction = iota
+	MouseRelease
+	// MouseDrag is motion with a button held down
+	MouseDrag
+	// MouseMove is motion with no buttons held down
+	MouseMove
+	MouseWheelUp
+	MouseWheelDown
+	// horizontal scrolling, sent by trackpads and tilting wheels
+	MouseWheelLeft
+	MouseWheelRight
+)
+
+type MouseButton int
+
+const (
+	MouseLeft MouseButton = iota
+	MouseMiddle
+	MouseRight
+	MouseNoButton
+)
+
+// Mouse is a decoded mouse report.
+type Mouse struct {
+	Action MouseAction
+	Button MouseButton
+	// terminal coordinates of the event (1 based)
+	Col, Row int
+	Mod      Modifier
+}
+
+// bits of the SGR mouse button parameter
+const (
+	mouseButtonMask = 0x03
+	mouseShift      = 0x04
+	mouseAlt        = 0x08
+	mouseCtrl       = 0x10
+	mouseMotion     = 0x20
+	mouseWheel      = 0x40
+)
+
+// ParseMouse decodes an SGR (mode 1006) mouse report of the form
+// ESC [ < button ; col ; row M (or m for release). It returns false if
+// raw is not a mouse report.
+func ParseMouse(raw []byte) (Mouse, bool) {
+	if !bytes.HasPrefix(raw, []byte{ESC, '[', '<'}) || len(raw) < 4 {
+		return Mouse{}, false
+	}
+
+	final := raw[len(raw)-1]
+	if final != 'M' && final != 'm' {
+		return Mouse{}, false
+	}
+
+	params := parseParams(raw[3 : len(raw)-1])
+	if len(params) != 3 {
+		return Mouse{}, false
+	}
+
+	b := params[0]
+	m := Mouse{
+		Button: MouseButton(b & mouseButtonMask),
+		Col:    params[1],
+		Row:    params[2],
+	}
+
+	if b&mouseShift != 0 {
+		m.Mod |= ModShift
+	}
+	if b&mouseAlt != 0 {
+		m.Mod |= ModAlt
+	}
+	if b&mouseCtrl != 0 {
+		m.Mod |= ModCtrl
+	}
+
+	switch {
+	case b&mouseWheel != 0:
+		// the low bits are 0-3 for wheel buttons 4-7
+		switch b & mouseButtonMask {
+		case 0:
+			m.Action = MouseWheelUp
+		case 1:
+			m.Action = MouseWheelDown
+		case 2:
+			m.Action = MouseWheelLeft
+		case 3:
+			m.Action = MouseWheelRight
+		}
+		m.Button = MouseNoButton
+	case b&mouseMotion != 0:
+		if m.Button == MouseNoButton {
+			m.Action = MouseMove
+		} else {
+			m.Action = MouseDrag
+		}
+	case final == 'm':
+		m.Action = MouseRelease
+	default:
+		m.Action = MousePress
+	}
+
+	return m, true
+}
@@ -0,0 +1,499 @@
+// charset detects and converts the character encoding of files. hat
+// edits UTF-8 text, files in other encodings are decoded by a Reader on
+// load and encoded again by a Writer on save.
+package charset
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Charset is a character encoding.
+type Charset int
+
+const (
+	UTF8 Charset = iota
+	UTF16LE
+	UTF16BE
+	// Latin1 is ISO 8859-1, every byte is the code point of the same
+	// value.
+	Latin1
+	// Windows1252 is Latin1 with printable characters in place of the
+	// C1 controls 0x80-0x9f.
+	Windows1252
+)
+
+var charsetNames = []string{
+	UTF8:        "utf-8",
+	UTF16LE:     "utf-16le",
+	UTF16BE:     "utf-16be",
+	Latin1:      "latin1",
+	Windows1252: "windows-1252",
+}
+
+func (c Charset) String() string {
+	return charsetNames[c]
+}
+
+// Encoding is a charset and whether files in it start with a byte order
+// mark.
+type Encoding struct {
+	Charset Charset
+	BOM     bool
+}
+
+// String returns the encoding's name as accepted by Parse, such as
+// utf-8 or utf-16le-bom. These match the EditorConfig charset names.
+func (e Encoding) String() string {
+	if e.BOM {
+		return e.Charset.String() + "-bom"
+	}
+	return e.Charset.String()
+}
+
+// Parse returns the named encoding.
+func Parse(name string) (Encoding, error) {
+	var e Encoding
+	if base, ok := strings.CutSuffix(name, "-bom"); ok {
+		name = base
+		e.BOM = true
+	}
+
+	switch name {
+	case "utf-8", "utf8":
+		e.Charset = UTF8
+	case "utf-16le":
+		e.Charset = UTF16LE
+	case "utf-16be":
+		e.Charset = UTF16BE
+	case "latin1", "iso-8859-1":
+		e.Charset = Latin1
+	case "windows-1252", "cp1252":
+		e.Charset = Windows1252
+	default:
+		return Encoding{}, fmt.Errorf("unknown encoding %q", name)
+	}
+	if e.BOM && e.bom() == nil {
+		return Encoding{}, fmt.Errorf("%s has no byte order mark", name)
+	}
+	return e, nil
+}
+
+// bom returns the byte order mark for the charset.
+func (e Encoding) bom() []byte {
+	switch e.Charset {
+	case UTF8:
+		return []byte{0xef, 0xbb, 0xbf}
+	case UTF16LE:
+		return []byte{0xff, 0xfe}
+	case UTF16BE:
+		return []byte{0xfe, 0xff}
+	}
+	return nil
+}
+
+// Detect returns the encoding of p, typically the start of a file. A
+// byte order mark is trusted if present. Otherwise UTF-16 is recognized
+// by the zero bytes of ASCII characters, and text that isn't UTF-8 is
+// taken to be Windows-1252, or Latin1 if it doesn't use any of the
+// characters where they differ.
+func Detect(p []byte) Encoding {
+	for _, e := range []Encoding{{UTF8, true}, {UTF16LE, true}, {UTF16BE, true}} {
+		if bytes.HasPrefix(p, e.bom()) {
+			return e
+		}
+	}
+
+	if c, ok := detectUTF16(p); ok {
+		return Encoding{Charset: c}
+	}
+
+	if looksUTF8(p) {
+		return Encoding{Charset: UTF8}
+	}
+	for _, c := range p {
+		if c >= 0x80 && c < 0xa0 {
+			return Encoding{Charset: Windows1252}
+		}
+	}
+	return Encoding{Charset: Latin1}
+}
+
+// Binary reports whether p, typically the start of a file, looks like
+// binary data rather than text: it has NUL bytes without being UTF-16,
+// or more than a third of it is invalid UTF-8. Such files should be
+// edited without any conversion.
+func Binary(p []byte) bool {
+	if len(p) == 0 {
+		return false
+	}
+	switch Detect(p).Charset {
+	case UTF16LE, UTF16BE:
+		return false
+	}
+	if bytes.IndexByte(p, 0) >= 0 {
+		return true
+	}
+
+	var invalid int
+	for i := 0; i < len(p); {
+		r, size := utf8.DecodeRune(p[i:])
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		}
+		i += size
+	}
+	return invalid*3 > len(p)
+}
+
+// detectUTF16 looks for text that is mostly ASCII encoded as UTF-16,
+// where every other byte is zero.
+func detectUTF16(p []byte) (Charset, bool) {
+	if len(p) < 4 {
+		return 0, false
+	}
+
+	var evenZero, oddZero int
+	for i, c := range p {
+		if c != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZero++
+		} else {
+			oddZero++
+		}
+	}
+
+	units := len(p) / 2
+	switch {
+	case oddZero >= units*9/10 && evenZero == 0:
+		return UTF16LE, true
+	case evenZero >= units*9/10 && oddZero == 0:
+		return UTF16BE, true
+	}
+	return 0, false
+}
+
+// looksUTF8 reports whether p is UTF-8. A few invalid bytes are allowed
+// as long as there are more valid multibyte characters, so one stray
+// byte doesn't turn a UTF-8 file into mojibake.
+func looksUTF8(p []byte) bool {
+	// p may end part way through a character
+	for i := 0; i < utf8.UTFMax-1 && i < len(p); i++ {
+		if utf8.RuneStart(p[len(p)-1-i]) {
+			if !utf8.FullRune(p[len(p)-1-i:]) {
+				p = p[:len(p)-1-i]
+			}
+			break
+		}
+	}
+
+	var multibyte, invalid int
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid++
+		case size > 1:
+			multibyte++
+		}
+		p = p[size:]
+	}
+	return invalid == 0 || multibyte > invalid
+}
+
+// windows1252 holds the code points for 0x80-0x9f. The five bytes
+// Windows-1252 leaves undefined map to the C1 control of the same value
+// so that any file can be decoded and encoded again unchanged.
+var windows1252 = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+// NewReader returns a reader that decodes text in encoding e from r to
+// UTF-8. A byte order mark at the start is dropped. Invalid UTF-16 is
+// replaced with U+FFFD.
+func NewReader(r io.Reader, e Encoding) io.Reader {
+	if e == (Encoding{Charset: UTF8}) {
+		return r
+	}
+	return &reader{
+		r:   r,
+		enc: e,
+		in:  make([]byte, 32<<10),
+		bom: e.bom(),
+	}
+}
+
+type reader struct {
+	r   io.Reader
+	enc Encoding
+	in  []byte
+	out []byte
+	// pending is decoded text that hasn't been read yet
+	pending []byte
+	// carry is the start of a UTF-16 character split across reads
+	carry []byte
+	// bom is what remains to be skipped of the byte order mark
+	bom []byte
+	err error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.r.Read(r.in)
+		r.err = err
+		r.pending = r.decode(r.skipBOM(r.in[:n]))
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *reader) skipBOM(p []byte) []byte {
+	for len(r.bom) > 0 && len(p) > 0 && p[0] == r.bom[0] {
+		r.bom = r.bom[1:]
+		p = p[1:]
+	}
+	if len(p) > 0 {
+		// the text didn't start with a complete byte order mark
+		r.bom = nil
+	}
+	return p
+}
+
+func (r *reader) decode(p []byte) []byte {
+	out := r.out[:0]
+
+	switch r.enc.Charset {
+	case UTF8:
+		out = append(out, p...)
+	case Latin1:
+		for _, c := range p {
+			out = utf8.AppendRune(out, rune(c))
+		}
+	case Windows1252:
+		for _, c := range p {
+			if c >= 0x80 && c < 0xa0 {
+				out = utf8.AppendRune(out, windows1252[c-0x80])
+			} else {
+				out = utf8.AppendRune(out, rune(c))
+			}
+		}
+	case UTF16LE, UTF16BE:
+		out = r.decodeUTF16(out, p)
+	}
+
+	r.out = out
+	return out
+}
+
+func (r *reader) decodeUTF16(out, p []byte) []byte {
+	if len(r.carry) > 0 {
+		p = append(r.carry, p...)
+		r.carry = nil
+	}
+
+	unit := func(i int) rune {
+		if r.enc.Charset == UTF16LE {
+			return rune(p[i]) | rune(p[i+1])<<8
+		}
+		return rune(p[i])<<8 | rune(p[i+1])
+	}
+
+	i := 0
+	for ; i+2 <= len(p); i += 2 {
+		u := unit(i)
+		if utf16.IsSurrogate(u) && u < 0xdc00 {
+			if i+4 > len(p) {
+				if r.err == nil {
+					break
+				}
+				out = utf8.AppendRune(out, utf8.RuneError)
+				continue
+			}
+			if c := utf16.DecodeRune(u, unit(i+2)); c != utf8.RuneError {
+				out = utf8.AppendRune(out, c)
+				i += 2
+				continue
+			}
+		}
+		if utf16.IsSurrogate(u) {
+			u = utf8.RuneError
+		}
+		out = utf8.AppendRune(out, u)
+	}
+
+	if rest := p[i:]; len(rest) > 0 {
+		if r.err != nil {
+			// a trailing odd byte
+			out = utf8.AppendRune(out, utf8.RuneError)
+		} else {
+			r.carry = append([]byte(nil), rest...)
+		}
+	}
+	return out
+}
+
+// EncodeError is returned when text can't be represented in the
+// encoding it is being written in.
+type EncodeError struct {
+	Rune     rune
+	Encoding Encoding
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("%q (U+%04X) can't be encoded in %s", e.Rune, e.Rune, e.Encoding)
+}
+
+// NewWriter returns a writer that encodes UTF-8 text written to it in
+// encoding e. The byte order mark, if e has one, is written before the
+// text. Invalid UTF-8 is written unchanged in UTF-8 and the single byte
+// charsets and as U+FFFD in UTF-16. Close must be called once all the
+// text has been written.
+func NewWriter(w io.Writer, e Encoding) io.WriteCloser {
+	return &writer{w: w, enc: e}
+}
+
+type writer struct {
+	w   io.Writer
+	enc Encoding
+	// carry is the start of a UTF-8 character split across writes
+	carry      []byte
+	buf        []byte
+	wroteStart bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	if w.enc.Charset == UTF8 {
+		return w.w.Write(p)
+	}
+
+	n := len(p)
+	if len(w.carry) > 0 {
+		p = append(w.carry, p...)
+		w.carry = nil
+	}
+
+	// leave a character split across writes for the next one
+	for i := 1; i < utf8.UTFMax && i <= len(p); i++ {
+		if utf8.RuneStart(p[len(p)-i]) {
+			if !utf8.FullRune(p[len(p)-i:]) {
+				w.carry = append([]byte(nil), p[len(p)-i:]...)
+				p = p[:len(p)-i]
+			}
+			break
+		}
+	}
+
+	if err := w.encode(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Close writes out anything held back from the last Write, and the byte
+// order mark if nothing was written. It doesn't close the underlying
+// writer.
+func (w *writer) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if len(w.carry) == 0 {
+		return nil
+	}
+	carry := w.carry
+	w.carry = nil
+	if w.enc.Charset == UTF8 {
+		_, err := w.w.Write(carry)
+		return err
+	}
+	return w.encode(carry)
+}
+
+func (w *writer) start() error {
+	if w.wroteStart {
+		return nil
+	}
+	w.wroteStart = true
+	if !w.enc.BOM {
+		return nil
+	}
+	_, err := w.w.Write(w.enc.bom())
+	return err
+}
+
+func (w *writer) encode(p []byte) error {
+	out := w.buf[:0]
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		invalid := r == utf8.RuneError && size == 1
+
+		switch w.enc.Charset {
+		case UTF16LE, UTF16BE:
+			if invalid {
+				r = utf8.RuneError
+			}
+			var units []uint16
+			if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+				units = []uint16{uint16(r1), uint16(r2)}
+			} else {
+				units = []uint16{uint16(r)}
+			}
+			for _, u := range units {
+				if w.enc.Charset == UTF16LE {
+					out = append(out, byte(u), byte(u>>8))
+				} else {
+					out = append(out, byte(u>>8), byte(u))
+				}
+			}
+		case Latin1, Windows1252:
+			c, ok := w.encodeByte(r)
+			if invalid {
+				c, ok = p[0], true
+			}
+			if !ok {
+				return &EncodeError{Rune: r, Encoding: w.enc}
+			}
+			out = append(out, c)
+		}
+		p = p[size:]
+	}
+	w.buf = out
+
+	_, err := w.w.Write(out)
+	return err
+}
+
+// encodeByte returns the byte for r in a single byte charset.
+func (w *writer) encodeByte(r rune) (byte, bool) {
+	if w.enc.Charset == Windows1252 {
+		for i, c := range windows1252 {
+			if c == r {
+				return byte(0x80 + i), true
+			}
+		}
+		if r >= 0x80 && r < 0xa0 {
+			return 0, false
+		}
+	}
+	if r < 0x100 {
+		return byte(r), true
+	}
+	return 0, false
+}
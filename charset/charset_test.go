@@ -0,0 +1,157 @@
+package charset
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDetect(t *testing.T) {
+	checks := []struct {
+		name   string
+		text   string
+		expect string
+	}{
+		{"empty", "", "utf-8"},
+		{"ascii", "hello\n", "utf-8"},
+		{"utf-8", "caf\xc3\xa9\n", "utf-8"},
+		{"utf-8 bom", "\xef\xbb\xbfhi", "utf-8-bom"},
+		{"utf-16le bom", "\xff\xfeh\x00i\x00", "utf-16le-bom"},
+		{"utf-16be bom", "\xfe\xff\x00h\x00i", "utf-16be-bom"},
+		{"utf-16le", "h\x00e\x00l\x00l\x00o\x00", "utf-16le"},
+		{"utf-16be", "\x00h\x00e\x00l\x00l\x00o", "utf-16be"},
+		{"latin1", "caf\xe9\n", "latin1"},
+		{"windows-1252", "\x93quoted\x94\n", "windows-1252"},
+		{"stray byte in utf-8", "caf\xc3\xa9 na\xc3\xafve \xff", "utf-8"},
+		{"split character", "caf\xc3", "utf-8"},
+		{"binary", "\x00\x00\x00\x01\x02", "utf-8"},
+	}
+
+	for _, check := range checks {
+		if got := Detect([]byte(check.text)).String(); got != check.expect {
+			t.Errorf("%s: got %s expected %s", check.name, got, check.expect)
+		}
+	}
+}
+
+func TestBinary(t *testing.T) {
+	checks := []struct {
+		name   string
+		text   string
+		expect bool
+	}{
+		{"empty", "", false},
+		{"ascii", "hello\n", false},
+		{"latin1", "caf\xe9 cr\xe8me br\xfbl\xe9e\n", false},
+		{"utf-16le", "h\x00e\x00l\x00l\x00o\x00", false},
+		{"utf-16le bom", "\xff\xfeh\x00i\x00", false},
+		{"nul", "ELF\x02\x01\x01\x00\x00", true},
+		{"mostly invalid", "\xde\xad\xbe\xefok\xfe\xed", true},
+	}
+
+	for _, check := range checks {
+		if got := Binary([]byte(check.text)); got != check.expect {
+			t.Errorf("%s: got %t expected %t", check.name, got, check.expect)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	checks := []struct {
+		enc  string
+		raw  string
+		utf8 string
+	}{
+		{"utf-8", "caf\xc3\xa9", "caf\xc3\xa9"},
+		{"utf-8-bom", "\xef\xbb\xbfcaf\xc3\xa9", "caf\xc3\xa9"},
+		{"utf-16le-bom", "\xff\xfeh\x00\xe9\x00", "h\xc3\xa9"},
+		{"utf-16be", "\x00h\x00\xe9", "h\xc3\xa9"},
+		{"utf-16le", "=\xd8\x00\xde", "\xf0\x9f\x98\x80"},
+		{"utf-16be", "\xd8=\xde\x00\x00\n", "\xf0\x9f\x98\x80\n"},
+		{"latin1", "caf\xe9 \x80", "caf\xc3\xa9 \xc2\x80"},
+		{"windows-1252", "\x93hi\x94 \x80 \x81", "\xe2\x80\x9chi\xe2\x80\x9d \xe2\x82\xac \xc2\x81"},
+		{"utf-8", "", ""},
+		{"utf-16le-bom", "\xff\xfe", ""},
+	}
+
+	for _, check := range checks {
+		enc, err := Parse(check.enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		readers := map[string]io.Reader{
+			"whole":    strings.NewReader(check.raw),
+			"one byte": iotest.OneByteReader(strings.NewReader(check.raw)),
+			"data err": iotest.DataErrReader(strings.NewReader(check.raw)),
+		}
+		for name, r := range readers {
+			got, err := io.ReadAll(NewReader(r, enc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != check.utf8 {
+				t.Errorf("%s %s decode %q got %q expected %q", enc, name, check.raw, got, check.utf8)
+			}
+		}
+
+		// write a byte at a time to split characters across writes
+		var buf bytes.Buffer
+		w := NewWriter(&buf, enc)
+		for i := 0; i < len(check.utf8); i++ {
+			if _, err := w.Write([]byte{check.utf8[i]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != check.raw {
+			t.Errorf("%s encode %q got %q expected %q", enc, check.utf8, buf.String(), check.raw)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	// unpaired surrogates and a trailing odd byte
+	got, _ := io.ReadAll(NewReader(strings.NewReader("\x00\xd8a\x00\x00\xdcb"), Encoding{Charset: UTF16LE}))
+	if string(got) != "�a��" {
+		t.Errorf("utf-16 decode got %q", got)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Encoding{Charset: Latin1})
+	w.Write([]byte("a\xffb\xc3"))
+	w.Close()
+	if buf.String() != "a\xffb\xc3" {
+		t.Errorf("latin1 encode of invalid utf-8 got %q", buf.String())
+	}
+
+	w = NewWriter(io.Discard, Encoding{Charset: Windows1252})
+	_, err := w.Write([]byte("price: 5\xe2\x82\xac, \xe2\x98\x83"))
+	var encErr *EncodeError
+	if !errors.As(err, &encErr) || encErr.Rune != '☃' {
+		t.Errorf("got %v expected an EncodeError for U+2603", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, name := range []string{"utf-8", "utf-8-bom", "utf-16le", "utf-16be-bom", "latin1", "windows-1252"} {
+		e, err := Parse(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.String() != name {
+			t.Errorf("Parse(%q) got %s", name, e)
+		}
+	}
+
+	for _, name := range []string{"latin1-bom", "ebcdic", ""} {
+		if _, err := Parse(name); err == nil {
+			t.Errorf("Parse(%q) expected an error", name)
+		}
+	}
+}
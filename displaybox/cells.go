@@ -0,0 +1,125 @@
+package displaybox
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+const defaultTabWidth = 8
+
+// A cell is the smallest unit of a line the cursor moves over: a
+// grapheme cluster, a tab, or a byte that can't be shown as is. text is
+// what gets written to the terminal for it, and width is the number of
+// columns that takes.
+type cell struct {
+	off   int
+	size  int
+	text  string
+	width int
+}
+
+// lineCells splits the line b, which starts at buffer offset base, into
+// cells. Control characters and invalid UTF-8 are given printable
+// placeholders so that nothing in the buffer can be interpreted by the
+// terminal.
+func lineCells(b []byte, base, tabWidth int) []cell {
+	cells := make([]cell, 0, len(b))
+	var col int
+	state := -1
+	for off := 0; off < len(b); {
+		c := cell{off: base + off}
+
+		r, size := utf8.DecodeRune(b[off:])
+		switch {
+		case r == '\t':
+			c.size = 1
+			c.width = tabWidth - col%tabWidth
+			c.text = strings.Repeat(" ", c.width)
+			state = -1
+		case r == utf8.RuneError && size == 1:
+			c.size = 1
+			c.text = fmt.Sprintf("<%02x>", b[off])
+			state = -1
+		case r < 0x20 || r == 0x7f:
+			c.size = 1
+			c.text = "^" + string(rune(r^0x40))
+			state = -1
+		case r >= 0x80 && r < 0xa0:
+			c.size = size
+			c.text = fmt.Sprintf(`\x%02x`, r)
+			state = -1
+		default:
+			var cluster []byte
+			cluster, _, c.width, state = uniseg.FirstGraphemeCluster(b[off:], state)
+			// a cluster never includes a control character, but it might
+			// take in invalid UTF-8 that we need to show separately
+			if i := invalidIndex(cluster); i > 0 {
+				cluster = cluster[:i]
+				state = -1
+			}
+			c.size = len(cluster)
+			c.text = string(cluster)
+			if c.width == 0 {
+				// a combining mark without anything to combine with
+				c.width = 1
+			}
+		}
+		if c.width == 0 {
+			c.width = len(c.text)
+		}
+
+		cells = append(cells, c)
+		col += c.width
+		off += c.size
+	}
+	return cells
+}
+
+// invalidIndex returns the index of the first invalid UTF-8 byte in b,
+// or -1.
+func invalidIndex(b []byte) int {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+// cellsWidth returns the number of columns cells take up.
+func cellsWidth(cells []cell) int {
+	var w int
+	for _, c := range cells {
+		w += c.width
+	}
+	return w
+}
+
+// cellAtCol returns the index of the cell shown at column col, or
+// len(cells) if the line is shorter than that.
+func cellAtCol(cells []cell, col int) int {
+	var w int
+	for i, c := range cells {
+		w += c.width
+		if w > col {
+			return i
+		}
+	}
+	return len(cells)
+}
+
+// cellAtOffset returns the index of the cell containing buffer offset
+// off, or len(cells) if off is past the last cell.
+func cellAtOffset(cells []cell, off int) int {
+	for i, c := range cells {
+		if off < c.off+c.size {
+			return i
+		}
+	}
+	return len(cells)
+}
@@ -4,9 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 	"unicode/utf8"
 
-	"github.com/psanford/hat/gapbuffer"
+	"github.com/psanford/hat/textbuffer"
 	"github.com/psanford/hat/vt100"
 )
 
@@ -20,16 +21,48 @@ type DisplayBox struct {
 	borderRight  int
 	borderBottom int
 	addBorder    bool
-	buf          *gapbuffer.GapBuffer
+	buf          textbuffer.TextBuffer
 
 	termSize  vt100.TermCoord
 	firstRowT int
 
+	// columns between tab stops
+	tabWidth int
+
+	// text past this column is underlined, if it is set
+	maxLineLength int
+
+	// indentation settings, see SetAutoIndent and SetIndent
+	autoIndent  bool
+	indent      string
+	indentAfter string
+
 	// zero indexed location of the cursor within the editable area
 	cursorCoord *viewPortCoord
+
+	// selection is the half open range [selStart, selEnd)
+	selActive bool
+	selStart  int
+	selEnd    int
+
+	// statusRows is the number of rows below the editable area used for
+	// status messages and prompts, 0 if there is no status line
+	statusRows int
+	status     string
+	// statusInfo is shown at the right end of the status line
+	statusInfo string
+	// when promptActive is set the cursor is placed on the status line
+	promptActive bool
+	promptCol    int
+
+	// hex is set while the buffer is shown as a hex dump
+	hex *hexView
+
+	// in overwrite mode Insert replaces the text after the cursor
+	overwrite bool
 }
 
-func New(term *vt100.VT100, gb *gapbuffer.GapBuffer, addBorder bool, cursorT vt100.TermCoord) *DisplayBox {
+func New(term *vt100.VT100, gb textbuffer.TextBuffer, addBorder bool, cursorT vt100.TermCoord) *DisplayBox {
 	d := &DisplayBox{
 		editableRows:  1,
 		termOwnedRows: 1,
@@ -39,6 +72,8 @@ func New(term *vt100.VT100, gb *gapbuffer.GapBuffer, addBorder bool, cursorT vt1
 		cursorCoord: &viewPortCoord{},
 		termSize:    term.Size(),
 		firstRowT:   cursorT.Row,
+		tabWidth:    defaultTabWidth,
+		indent:      "\t",
 	}
 
 	if addBorder {
@@ -74,25 +109,26 @@ func New(term *vt100.VT100, gb *gapbuffer.GapBuffer, addBorder bool, cursorT vt1
 }
 
 func (d *DisplayBox) MvLeft() {
-	d.cursorPosSanityCheck()
-
-	startPos, _ := d.buf.GetLine(0)
-	curPos, _ := d.buf.Seek(0, io.SeekCurrent)
-	if curPos == int64(startPos) {
+	if d.hex != nil {
+		d.hexMvLeft()
 		return
 	}
-	d.buf.Seek(-1, io.SeekCurrent)
+	d.cursorPosSanityCheck()
 
-	if d.cursorCoord.X > 0 {
-		d.cursorCoord.X--
-		d.redrawCursor()
-	} else {
-		// scroll line left
-		d.redrawLine()
+	prev, ok := d.prevCell()
+	if !ok {
+		return
 	}
+	col := d.cursorCol()
+	d.buf.Seek(int64(prev), io.SeekStart)
+	d.moveCursorX(d.cursorCol() - col)
 }
 
 func (d *DisplayBox) MvRight() {
+	if d.hex != nil {
+		d.hexMvTo(d.Offset() + 1)
+		return
+	}
 	d.cursorPosSanityCheck()
 
 	bufPos, _ := d.buf.Seek(0, io.SeekCurrent)
@@ -108,22 +144,85 @@ func (d *DisplayBox) MvRight() {
 			eolPos = endBufPos
 		}
 	}
-	if bufPos == int64(eolPos) {
+	if bufPos >= int64(eolPos) {
 		return
 	}
 
-	_, err := d.buf.Seek(1, io.SeekCurrent)
+	cells, _ := d.lineCells(0)
+	next := cells[cellAtOffset(cells, int(bufPos))]
+	col := d.cursorCol()
+	_, err := d.buf.Seek(int64(next.off+next.size), io.SeekStart)
 	if err != nil {
 		panic(fmt.Sprintf("MvRight seek forward unexepected error: %s", err))
 	}
+	d.moveCursorX(d.cursorCol() - col)
+}
 
-	if d.cursorCoord.X < d.viewPortWidth()-1 {
-		d.cursorCoord.X++
-		d.redrawCursor()
-	} else {
-		// scroll line right
+// moveCursorX moves the cursor n columns within the line after the
+// buffer cursor has been moved, scrolling the line if it would leave the
+// view.
+func (d *DisplayBox) moveCursorX(n int) {
+	x := d.cursorCoord.X + n
+	switch {
+	case x < 0:
+		d.cursorCoord.X = 0
 		d.redrawLine()
+	case x > d.viewPortWidth()-1:
+		d.cursorCoord.X = d.viewPortWidth() - 1
+		d.redrawLine()
+	default:
+		d.cursorCoord.X = x
+		d.redrawCursor()
+	}
+}
+
+// prevCell returns the offset of the start of the cell before the
+// cursor on the cursor's line, or of the cell the cursor is part way
+// through.
+func (d *DisplayBox) prevCell() (int, bool) {
+	cells, _ := d.lineCells(0)
+	off := d.Offset()
+	i := cellAtOffset(cells, off)
+	if i < len(cells) && cells[i].off < off {
+		return cells[i].off, true
+	}
+	if i == 0 {
+		return 0, false
+	}
+	return cells[i-1].off, true
+}
+
+// lineCells returns the cells of the line lineDelta lines from the
+// cursor, not including its newline, and the offset the line starts at.
+// It returns a nil slice and -1 if there is no such line.
+func (d *DisplayBox) lineCells(lineDelta int) ([]cell, int) {
+	lineStart, lineEnd := d.buf.GetLine(lineDelta)
+	if lineStart == -1 {
+		return nil, -1
 	}
+
+	lineBuf := make([]byte, lineEnd-lineStart+1)
+	i, _ := d.buf.ReadAt(lineBuf, int64(lineStart))
+	lineBuf = bytes.TrimSuffix(lineBuf[:i], []byte("\n"))
+
+	return lineCells(lineBuf, lineStart, d.tabWidth), lineStart
+}
+
+// SetMaxLineLength underlines the text of lines longer than n columns
+// from column n on. Zero turns it off.
+func (d *DisplayBox) SetMaxLineLength(n int) {
+	d.maxLineLength = max(n, 0)
+	d.Redraw()
+}
+
+// SetTabWidth sets the number of columns between tab stops.
+func (d *DisplayBox) SetTabWidth(n int) {
+	if n < 1 {
+		n = defaultTabWidth
+	}
+	d.tabWidth = n
+	d.placeCursor(0)
+	d.Redraw()
 }
 
 func (d *DisplayBox) viewPortWidth() int {
@@ -131,123 +230,674 @@ func (d *DisplayBox) viewPortWidth() int {
 }
 
 func (d *DisplayBox) MvUp() {
+	if d.hex != nil {
+		d.hexMvRows(-1)
+		return
+	}
 	d.cursorPosSanityCheck()
 
-	prevStart, prevEnd := d.buf.GetLine(-1)
-	if prevStart == -1 && prevEnd == -1 {
-		// we're on the first line
+	if d.buf.LineAt(d.Offset()) == 0 {
 		return
 	}
-	curStart, _ := d.buf.GetLine(0)
-	if curStart == prevStart {
-		// this shouldn't happen
-		panic("this should be unreachable: curStart == prevStart")
+	d.MvTo(d.lineColOffset(-1, d.cursorCol()))
+}
+
+func (d *DisplayBox) MvDown() {
+	if d.hex != nil {
+		d.hexMvRows(1)
+		return
 	}
+	d.cursorPosSanityCheck()
 
-	bufPos, _ := d.buf.Seek(0, io.SeekCurrent)
-	offsetCurLine := int(bufPos) - curStart
+	if d.buf.LineAt(d.Offset()) >= d.buf.LineCount()-1 {
+		return
+	}
+	d.MvTo(d.lineColOffset(1, d.cursorCol()))
+}
 
-	rowWidth := prevEnd - prevStart
-	if offsetCurLine > rowWidth {
-		offsetCurLine = rowWidth
+func (d *DisplayBox) MvBOL() {
+	if d.hex != nil {
+		d.hexMvBOL()
+		return
 	}
+	d.cursorPosSanityCheck()
 
-	d.buf.Seek(int64(prevStart+offsetCurLine), io.SeekStart)
+	lineStart, _ := d.buf.GetLine(0)
 
-	d.cursorCoord.X = offsetCurLine
-	if d.cursorCoord.Y > 0 {
-		d.cursorCoord.Y--
-		d.redrawCursor()
-	} else {
-		d.Redraw()
+	d.buf.Seek(int64(lineStart), io.SeekStart)
+	d.cursorCoord.X = 0
+	d.redrawLine()
+}
+
+func (d *DisplayBox) MvEOL() {
+	if d.hex != nil {
+		d.hexMvEOL()
+		return
 	}
+	d.cursorPosSanityCheck()
+
+	d.MvTo(d.buf.LineEnd(d.buf.LineAt(d.Offset())))
 }
 
-func (d *DisplayBox) MvDown() {
+func (d *DisplayBox) MvPgUp() {
+	if d.hex != nil {
+		d.hexMvRows(-d.editableRows)
+		return
+	}
 	d.cursorPosSanityCheck()
+	for i := 0; i < d.termOwnedRows; i++ {
+		d.MvUp()
+	}
+}
 
-	nextStart, nextEnd := d.buf.GetLine(1)
-	if nextStart == -1 {
-		// on last line
+func (d *DisplayBox) MvPgDown() {
+	if d.hex != nil {
+		d.hexMvRows(d.editableRows)
 		return
 	}
+	d.cursorPosSanityCheck()
+	for i := 0; i < d.termOwnedRows; i++ {
+		d.MvDown()
+	}
+}
 
-	curStart, _ := d.buf.GetLine(0)
+// Offset returns the buffer offset of the cursor.
+func (d *DisplayBox) Offset() int {
+	pos, _ := d.buf.Seek(0, io.SeekCurrent)
+	return int(pos)
+}
 
-	bufPos, _ := d.buf.Seek(0, io.SeekCurrent)
-	offsetCurLine := int(bufPos) - curStart
+// Changes returns the number of edits that have been made to the
+// buffer. Comparing two values tells you if the buffer was modified
+// in between.
+func (d *DisplayBox) Changes() int {
+	return d.buf.Edits()
+}
 
-	rowWidth := nextEnd - nextStart
+// MvTo moves the cursor to the absolute buffer offset off.
+func (d *DisplayBox) MvTo(off int) {
+	if d.hex != nil {
+		d.hexMvTo(off)
+		return
+	}
+	d.cursorPosSanityCheck()
 
-	if offsetCurLine > rowWidth {
-		offsetCurLine = rowWidth
+	if off < 0 {
+		off = 0
+	} else if off > d.buf.Size() {
+		off = d.buf.Size()
 	}
 
-	_, err := d.buf.Seek(int64(nextStart+offsetCurLine), io.SeekStart)
-	if err != nil {
-		panic(fmt.Sprintf("MvDown unexpected seek error: %s", err))
+	cur := d.Offset()
+	if off == cur {
+		return
 	}
 
-	d.cursorCoord.X = offsetCurLine
-	if d.cursorCoord.Y < d.editableRows-1 {
-		d.cursorCoord.Y++
-		d.redrawCursor()
-	} else {
+	wasScrolled := d.cursorCol() != d.cursorCoord.X
+	lineDelta := d.newlinesBetween(cur, off)
+
+	d.buf.Seek(int64(off), io.SeekStart)
+
+	if d.placeCursor(lineDelta) || wasScrolled {
 		d.Redraw()
+	} else {
+		d.redrawCursor()
 	}
 }
 
-func (d *DisplayBox) MvBOL() {
+// MvBOF moves the cursor to the beginning of the buffer.
+func (d *DisplayBox) MvBOF() {
+	d.MvTo(0)
+}
+
+// MvEOF moves the cursor to the end of the buffer.
+func (d *DisplayBox) MvEOF() {
+	d.MvTo(d.buf.Size())
+}
+
+// MvWordForward moves the cursor to the start of the next word.
+func (d *DisplayBox) MvWordForward() {
+	d.MvTo(d.NextWordStart(d.Offset()))
+}
+
+// MvWordBackward moves the cursor to the start of the previous word.
+func (d *DisplayBox) MvWordBackward() {
+	d.MvTo(d.PrevWordStart(d.Offset()))
+}
+
+// MvWordEnd moves the cursor to the last character of the current or
+// next word.
+func (d *DisplayBox) MvWordEnd() {
+	d.MvTo(d.WordEnd(d.Offset()))
+}
+
+// NextWordStart returns the offset of the start of the word after off.
+// Words follow vi's definition: a run of letters, digits and underscores,
+// or a run of other non-blank characters. An empty line counts as a word.
+func (d *DisplayBox) NextWordStart(off int) int {
+	size := d.buf.Size()
+	if off >= size {
+		return size
+	}
+
+	i := off
+	class := charClass(d.byteAt(i))
+	if class != classSpace {
+		for i < size && charClass(d.byteAt(i)) == class {
+			i++
+		}
+	}
+
+	for i < size {
+		c := d.byteAt(i)
+		if charClass(c) != classSpace {
+			break
+		}
+		if c == '\n' && i+1 < size && d.byteAt(i+1) == '\n' {
+			return i + 1
+		}
+		i++
+	}
+
+	return i
+}
+
+// PrevWordStart returns the offset of the start of the word before off.
+func (d *DisplayBox) PrevWordStart(off int) int {
+	i := off - 1
+	for i >= 0 && charClass(d.byteAt(i)) == classSpace {
+		if d.byteAt(i) == '\n' && (i == 0 || d.byteAt(i-1) == '\n') {
+			// empty line
+			return i
+		}
+		i--
+	}
+
+	if i < 0 {
+		return 0
+	}
+
+	class := charClass(d.byteAt(i))
+	for i > 0 && charClass(d.byteAt(i-1)) == class {
+		i--
+	}
+
+	return i
+}
+
+// WordEnd returns the offset of the last character of the word that
+// ends after off.
+func (d *DisplayBox) WordEnd(off int) int {
+	size := d.buf.Size()
+
+	i := off + 1
+	for i < size && charClass(d.byteAt(i)) == classSpace {
+		i++
+	}
+	if i >= size {
+		return off
+	}
+
+	class := charClass(d.byteAt(i))
+	for i+1 < size && charClass(d.byteAt(i+1)) == class {
+		i++
+	}
+
+	// back up to the start of a multibyte rune
+	for i > off && !utf8.RuneStart(d.byteAt(i)) {
+		i--
+	}
+
+	return i
+}
+
+// Replace replaces the bytes in [start, end) with text and moves the
+// cursor to offset cursor in the resulting buffer.
+func (d *DisplayBox) Replace(start, end int, text []byte, cursor int) {
 	d.cursorPosSanityCheck()
 
-	lineStart, _ := d.buf.GetLine(0)
+	if end > d.buf.Size() {
+		end = d.buf.Size()
+	}
+	if start > end {
+		start = end
+	}
 
-	d.buf.Seek(int64(lineStart), io.SeekStart)
-	d.cursorCoord.X = 0
-	d.redrawLine()
+	old := make([]byte, end-start)
+	d.buf.ReadAt(old, int64(start))
+
+	// line of the old cursor relative to start
+	oldLine := d.newlinesBetween(start, d.Offset())
+
+	d.buf.Seek(int64(end), io.SeekStart)
+	d.buf.Delete(end - start)
+	d.buf.Insert(text)
+
+	if cursor > d.buf.Size() {
+		cursor = d.buf.Size()
+	}
+	newLine := d.newlinesBetween(start, cursor)
+	d.buf.Seek(int64(cursor), io.SeekStart)
+	d.placeCursor(newLine - oldLine)
+
+	addedLines := bytes.Count(text, []byte{'\n'}) - bytes.Count(old, []byte{'\n'})
+	for ; addedLines > 0; addedLines-- {
+		startPos, _ := d.buf.GetLine(d.editableRows - d.cursorCoord.Y)
+		if startPos == -1 {
+			// everything fits
+			break
+		}
+		if !d.growRegion() {
+			break
+		}
+	}
+
+	d.Redraw()
 }
 
-func (d *DisplayBox) MvEOL() {
+// Refresh redraws everything after the buffer has been edited other
+// than through the DisplayBox, keeping the cursor on the same row if it
+// can.
+func (d *DisplayBox) Refresh() {
+	d.placeCursor(0)
+	d.Redraw()
+}
+
+// Load reads r into the buffer at the cursor without drawing anything,
+// then moves the cursor to the start of the zero based line and redraws
+// once. It is much faster than Insert for large inputs.
+func (d *DisplayBox) Load(r io.Reader, line int) (int64, error) {
 	d.cursorPosSanityCheck()
 
-	lineStart, lineEnd := d.buf.GetLine(0)
-	endBufPos := d.buf.Size()
+	n, err := d.buf.ReadFrom(r)
+	d.Reset(line)
 
-	bufPos, _ := d.buf.Seek(0, io.SeekCurrent)
+	return n, err
+}
 
-	if bufPos == int64(lineEnd) {
+// Reset moves the cursor to the start of the zero based line and redraws
+// everything. Use it after the buffer has been filled other than through
+// the DisplayBox.
+func (d *DisplayBox) Reset(line int) {
+	cursor := d.buf.LineColOffset(line, 0)
+	d.buf.Seek(int64(cursor), io.SeekStart)
+	if d.hex != nil {
+		d.Redraw()
 		return
 	}
+	d.recenter()
+}
 
-	if lineEnd == endBufPos-1 {
-		lastChar := make([]byte, 1)
-		d.buf.ReadAt(lastChar, int64(endBufPos)-1)
-		if lastChar[0] != '\n' {
-			lineEnd = endBufPos
+// recenter grows the editable area to fit the buffer if it can, places
+// the cursor's line in the middle of the view and redraws everything.
+func (d *DisplayBox) recenter() {
+	cursor := d.Offset()
+
+	for d.editableRows < d.buf.LineCount() {
+		if !d.growRegion() {
+			break
 		}
 	}
 
-	d.buf.Seek(int64(lineEnd), io.SeekStart)
+	// put the cursor line in the middle of the view, or lower if the
+	// buffer ends before the bottom of the view
+	line := d.buf.LineAt(cursor)
+	below := d.buf.LineCount() - line
+	d.cursorCoord.Y = min(line, max(d.editableRows/2, d.editableRows-below))
+	d.placeCursor(0)
+	d.Redraw()
+}
+
+// OffsetAt returns the buffer offset of the character shown at terminal
+// coordinate tc. Positions past the end of a line map to the end of that
+// line and rows below the last line map to the last line. It returns
+// false if tc is outside of the editable area.
+func (d *DisplayBox) OffsetAt(tc vt100.TermCoord) (int, bool) {
+	vp, ok := d.termToViewPortCoord(tc)
+	if !ok {
+		return 0, false
+	}
+	if d.hex != nil {
+		return d.hexOffsetAt(vp), true
+	}
+
+	lineDelta := vp.Y - d.cursorCoord.Y
+	for lineDelta > 0 {
+		startPos, _ := d.buf.GetLine(lineDelta)
+		if startPos != -1 {
+			break
+		}
+		lineDelta--
+	}
 
-	d.cursorCoord.X = lineEnd - lineStart
-	if d.cursorCoord.X >= d.viewPortWidth() {
-		d.cursorCoord.X = d.viewPortWidth() - 1
+	col := vp.X
+	if lineDelta == 0 {
+		// the cursor's line may be scrolled horizontally
+		col += d.cursorCol() - d.cursorCoord.X
 	}
-	d.redrawLine()
+
+	return d.lineColOffset(lineDelta, col), true
 }
 
-func (d *DisplayBox) MvPgUp() {
+// Scroll moves the view n lines down, or up if n is negative. The cursor
+// stays on the same line unless that line would leave the view.
+func (d *DisplayBox) Scroll(n int) {
+	if d.hex != nil {
+		d.hexScroll(n)
+		return
+	}
 	d.cursorPosSanityCheck()
-	for i := 0; i < d.termOwnedRows; i++ {
-		d.MvUp()
+
+	for ; n > 0; n-- {
+		startPos, _ := d.buf.GetLine(d.editableRows - d.cursorCoord.Y)
+		if startPos == -1 {
+			break
+		}
+		d.cursorCoord.Y--
+	}
+	for ; n < 0; n++ {
+		startPos, _ := d.buf.GetLine(-d.cursorCoord.Y - 1)
+		if startPos == -1 {
+			break
+		}
+		d.cursorCoord.Y++
+	}
+
+	var lineDelta int
+	if d.cursorCoord.Y < 0 {
+		lineDelta = -d.cursorCoord.Y
+	} else if d.cursorCoord.Y > d.editableRows-1 {
+		lineDelta = d.editableRows - 1 - d.cursorCoord.Y
+	}
+
+	if lineDelta != 0 {
+		off := d.lineColOffset(lineDelta, d.cursorCol())
+		d.buf.Seek(int64(off), io.SeekStart)
+		d.cursorCoord.Y += lineDelta
+	}
+
+	d.cursorCoord.X = d.cursorCol()
+	if d.cursorCoord.X > d.viewPortWidth()-1 {
+		d.cursorCoord.X = d.viewPortWidth() - 1
 	}
+
+	d.Redraw()
 }
 
-func (d *DisplayBox) MvPgDown() {
-	d.cursorPosSanityCheck()
-	for i := 0; i < d.termOwnedRows; i++ {
-		d.MvDown()
+// lineColOffset returns the buffer offset of the cell shown at column
+// col of the line lineDelta lines from the cursor. Columns past the end
+// of the line map to the end of the line.
+func (d *DisplayBox) lineColOffset(lineDelta, col int) int {
+	cells, lineStart := d.lineCells(lineDelta)
+	if i := cellAtCol(cells, col); i < len(cells) {
+		return cells[i].off
 	}
+	if len(cells) == 0 {
+		return lineStart
+	}
+	last := cells[len(cells)-1]
+	return last.off + last.size
+}
+
+// SetSelection highlights the bytes in [start, end).
+func (d *DisplayBox) SetSelection(start, end int) {
+	if start > end {
+		start, end = end, start
+	}
+	d.selActive = true
+	d.selStart = start
+	d.selEnd = end
+	d.Redraw()
+}
+
+// ClearSelection removes the selection highlight.
+func (d *DisplayBox) ClearSelection() {
+	if !d.selActive {
+		return
+	}
+	d.selActive = false
+	d.Redraw()
+}
+
+// Selection returns the currently selected range.
+func (d *DisplayBox) Selection() (start, end int, ok bool) {
+	return d.selStart, d.selEnd, d.selActive
+}
+
+// SetCursorStyle changes the shape of the terminal cursor.
+func (d *DisplayBox) SetCursorStyle(style vt100.CursorStyle) {
+	d.vt100.SetCursorStyle(style)
+}
+
+// EnableStatusLine reserves a row below the editable area for status
+// messages and prompts.
+func (d *DisplayBox) EnableStatusLine() {
+	if d.statusRows > 0 {
+		return
+	}
+
+	haveSpaceBelow := d.firstRowT+d.termOwnedRows <= d.termSize.Row
+	if !haveSpaceBelow {
+		if d.firstRowT == 1 || !d.vt100.CanScroll() {
+			// no room for a status line
+			return
+		}
+		d.vt100.ScrollUp()
+		d.firstRowT--
+	}
+
+	d.statusRows = 1
+	d.termOwnedRows++
+	d.Redraw()
+}
+
+// maxStatusRows is the most rows a status message can take.
+const maxStatusRows = 5
+
+// SetStatus shows msg on the status line. A message of several lines,
+// such as a command's error output, takes up to maxStatusRows rows
+// below the editable area until it is replaced by a shorter one.
+func (d *DisplayBox) SetStatus(msg string) {
+	d.status = msg
+	if d.fitStatus() {
+		d.Redraw()
+		return
+	}
+	d.drawStatus()
+	d.redrawCursor()
+}
+
+// Status returns the message shown on the status line.
+func (d *DisplayBox) Status() string {
+	return d.status
+}
+
+// SetStatusInfo shows info, such as the file's encoding, right aligned
+// on the status line. It stays until replaced, independent of the
+// messages set with SetStatus.
+func (d *DisplayBox) SetStatusInfo(info string) {
+	d.statusInfo = info
+	d.drawStatus()
+	d.redrawCursor()
+}
+
+// SetPrompt shows text on the status line and places the cursor after
+// the first col runes of it. The cursor stays on the status line until
+// ClearPrompt is called.
+func (d *DisplayBox) SetPrompt(text string, col int) {
+	d.status = text
+	d.promptActive = true
+	before := []rune(text)
+	if col < len(before) {
+		before = before[:col]
+	}
+	d.promptCol = cellsWidth(lineCells([]byte(string(before)), 0, d.tabWidth))
+	if d.fitStatus() {
+		d.Redraw()
+		return
+	}
+	d.drawStatus()
+	d.redrawCursor()
+}
+
+// ClearPrompt clears the status line and returns the cursor to the
+// editable area.
+func (d *DisplayBox) ClearPrompt() {
+	d.promptActive = false
+	d.SetStatus("")
+}
+
+// statusRowT returns the status line's row in terminal coordinate space.
+func (d *DisplayBox) statusRowT() int {
+	return d.firstRowT + d.borderTop + d.editableRows + d.borderBottom
+}
+
+// statusLines returns the lines of the status message.
+func (d *DisplayBox) statusLines() []string {
+	lines := strings.Split(strings.TrimRight(d.status, "\n"), "\n")
+	if len(lines) > maxStatusRows {
+		lines = lines[:maxStatusRows]
+	}
+	return lines
+}
+
+// fitStatus gives the status line as many rows as the status message
+// has lines, taking rows below us or scrolling the terminal like
+// EnableStatusLine, and releases the rows it no longer needs. It
+// reports whether the rows above moved and everything must be redrawn.
+func (d *DisplayBox) fitStatus() bool {
+	if d.statusRows == 0 {
+		return false
+	}
+
+	want := len(d.statusLines())
+	moved := false
+	for d.statusRows < want {
+		haveSpaceBelow := d.firstRowT+d.termOwnedRows <= d.termSize.Row
+		if !haveSpaceBelow {
+			if d.firstRowT == 1 || !d.vt100.CanScroll() {
+				break
+			}
+			d.vt100.ScrollUp()
+			d.firstRowT--
+			moved = true
+		}
+		d.statusRows++
+		d.termOwnedRows++
+	}
+	for d.statusRows > max(want, 1) {
+		d.vt100.MoveTo(d.firstRowT+d.termOwnedRows-1, 1)
+		d.vt100.ClearToEndOfLine()
+		d.statusRows--
+		d.termOwnedRows--
+	}
+	return moved
+}
+
+func (d *DisplayBox) drawStatus() {
+	if d.statusRows == 0 {
+		return
+	}
+
+	lines := d.statusLines()
+	for i := 0; i < d.statusRows; i++ {
+		d.vt100.MoveTo(d.statusRowT()+i, 1)
+		d.vt100.ClearToEndOfLine()
+		if i >= len(lines) {
+			continue
+		}
+		// messages can hold text from files and commands, show it the
+		// way the buffer is shown
+		cells := lineCells([]byte(lines[i]), 0, d.tabWidth)
+		for _, c := range cells[:cellAtCol(cells, d.termSize.Col)] {
+			d.vt100.Write([]byte(c.text))
+		}
+	}
+	msgWidth := cellsWidth(lineCells([]byte(lines[0]), 0, d.tabWidth))
+
+	info := []rune(d.statusInfo)
+	// keep a space between the message and the info, and drop the info
+	// rather than cover the message
+	if len(info) > 0 && msgWidth+1+len(info) <= d.termSize.Col {
+		d.vt100.MoveTo(d.statusRowT(), d.termSize.Col-len(info)+1)
+		d.vt100.Write([]byte(string(info)))
+	}
+}
+
+// placeCursor recomputes cursorCoord after the buffer cursor has moved
+// lineDelta lines. It reports whether the visible rows shifted and need
+// to be redrawn.
+func (d *DisplayBox) placeCursor(lineDelta int) bool {
+	var shifted bool
+
+	y := d.cursorCoord.Y + lineDelta
+	if y < 0 {
+		y = 0
+		shifted = true
+	} else if y > d.editableRows-1 {
+		y = d.editableRows - 1
+		shifted = true
+	}
+
+	// don't leave empty rows above the first line
+	for y > 0 {
+		startPos, _ := d.buf.GetLine(-y)
+		if startPos != -1 {
+			break
+		}
+		y--
+		shifted = true
+	}
+
+	x := d.cursorCol()
+	if x > d.viewPortWidth()-1 {
+		x = d.viewPortWidth() - 1
+		shifted = true
+	}
+
+	d.cursorCoord.X = x
+	d.cursorCoord.Y = y
+
+	return shifted
+}
+
+// cursorCol returns the column of the cursor within its line.
+func (d *DisplayBox) cursorCol() int {
+	lineStart, _ := d.buf.GetLine(0)
+	b := make([]byte, d.Offset()-lineStart)
+	d.buf.ReadAt(b, int64(lineStart))
+	return cellsWidth(lineCells(b, lineStart, d.tabWidth))
+}
+
+// newlinesBetween counts the newlines in [from, to). If to is before from
+// the count is negative.
+func (d *DisplayBox) newlinesBetween(from, to int) int {
+	return d.buf.LineAt(to) - d.buf.LineAt(from)
+}
+
+func (d *DisplayBox) byteAt(off int) byte {
+	var b [1]byte
+	d.buf.ReadAt(b[:], int64(off))
+	return b[0]
+}
+
+const (
+	classSpace = iota
+	classWord
+	classPunct
+)
+
+func charClass(c byte) int {
+	switch {
+	case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		return classSpace
+	case c == '_' || c >= 0x80,
+		'a' <= c && c <= 'z',
+		'A' <= c && c <= 'Z',
+		'0' <= c && c <= '9':
+		return classWord
+	}
+	return classPunct
 }
 
 // Returns the last owned row in terminal coordinate space
@@ -260,16 +910,31 @@ func (d *DisplayBox) LastOwnedRow() vt100.TermCoord {
 }
 
 func (d *DisplayBox) redrawCursor() {
+	if d.promptActive {
+		d.vt100.MoveTo(d.statusRowT(), d.promptCol+1)
+		return
+	}
+	if d.hex != nil {
+		d.vt100.MoveToCoord(d.viewPortToTermCoord(d.hexCursor()))
+		return
+	}
 	tc := d.viewPortToTermCoord(d.cursorCoord)
 	d.vt100.MoveToCoord(tc)
 	d.cursorPosSanityCheck()
 }
 
+// InsertNewline starts a new line at the cursor, indented to match if
+// auto-indent is on.
 func (d *DisplayBox) InsertNewline() {
+	d.insertNewline(d.autoIndent)
+}
+
+func (d *DisplayBox) insertNewline(indent bool) {
+	if d.hex != nil {
+		return
+	}
 	d.cursorPosSanityCheck()
 	var (
-		haveSpaceBelow      = d.firstRowT+d.termOwnedRows <= d.termSize.Row
-		haveSpaceAbove      = d.firstRowT > 1
 		editableRowsForward = d.editableRows - d.cursorCoord.Y - 1
 
 		hasUnusedEitableRow bool
@@ -282,63 +947,108 @@ func (d *DisplayBox) InsertNewline() {
 		}
 	}
 
-	d.buf.Insert([]byte{'\n'})
+	newline := []byte{'\n'}
+	if indent {
+		newline = append(newline, d.newlineIndent()...)
+	}
+	d.buf.Insert(newline)
 
-	if hasUnusedEitableRow {
-		d.cursorCoord.X = 0
+	if hasUnusedEitableRow || d.growRegion() {
 		d.cursorCoord.Y++
-		d.Redraw()
-	} else if haveSpaceBelow {
-		// we can grow downward
+	}
+	d.cursorCoord.X = min(d.cursorCol(), d.viewPortWidth()-1)
+	d.Redraw()
+}
+
+// growRegion claims one more terminal row for the editable area. We
+// grow downward if there is unused space below us, otherwise we scroll
+// the terminal to grow upwards. Returns false if there is no room left.
+func (d *DisplayBox) growRegion() bool {
+	var (
+		haveSpaceBelow = d.firstRowT+d.termOwnedRows <= d.termSize.Row
+		// without scrolling we keep the existing rows and redraw the
+		// buffer within them instead
+		haveSpaceAbove = d.firstRowT > 1 && d.vt100.CanScroll()
+	)
+
+	if haveSpaceBelow {
 		d.editableRows++
 		d.termOwnedRows++
-
-		d.cursorCoord.X = 0
-		d.cursorCoord.Y++
-		d.Redraw()
+		return true
 	} else if haveSpaceAbove {
-		// we can trigger a scroll to grow upwards
-
 		d.vt100.ScrollUp()
 		d.editableRows++
 		d.termOwnedRows++
 		d.firstRowT--
-
-		d.cursorCoord.X = 0
-		d.cursorCoord.Y++
-
-		d.Redraw()
-	} else {
-		d.cursorCoord.X = 0
-		d.Redraw()
+		return true
 	}
+	return false
 }
 
 func (d *DisplayBox) Insert(p []byte) {
-	// PMS: this is not correct for unicode characters
-	// we probably should also check that b is printable
-
+	if d.hex != nil {
+		for _, r := range string(p) {
+			d.hexInput(r)
+		}
+		return
+	}
 	d.cursorPosSanityCheck()
 
 	for len(p) > 0 {
-		r, size := utf8.DecodeRune(p)
-		p = p[size:]
-		if r == '\n' {
-			d.redrawLine()
-			d.InsertNewline()
-		} else {
-			d.buf.Insert([]byte(string(r)))
-			if d.cursorCoord.X < d.viewPortWidth()-1 {
-				d.cursorCoord.X++
-			}
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i]
+		}
 
+		if len(line) > 0 {
+			col := d.cursorCol()
+			if d.overwrite {
+				d.deleteCells(len(lineCells(line, 0, d.tabWidth)))
+			}
+			d.buf.Insert(line)
+			d.cursorCoord.X = min(d.cursorCoord.X+d.cursorCol()-col, d.viewPortWidth()-1)
+			p = p[len(line):]
+		} else {
+			d.redrawLine()
+			// inserted text brings its own indentation
+			d.insertNewline(false)
+			p = p[1:]
 		}
 	}
 	d.redrawLine()
 }
 
+// SetOverwrite turns overwrite mode on or off. In overwrite mode each
+// character inserted replaces the one under the cursor. At the end of a
+// line it is appended, and newlines are still inserted, so typing never
+// joins lines.
+func (d *DisplayBox) SetOverwrite(on bool) {
+	d.overwrite = on
+}
+
+// Overwrite reports whether overwrite mode is on.
+func (d *DisplayBox) Overwrite() bool {
+	return d.overwrite
+}
+
+// deleteCells removes up to n cells after the cursor, stopping at the
+// end of the line.
+func (d *DisplayBox) deleteCells(n int) {
+	cells, _ := d.lineCells(0)
+	i := cellAtOffset(cells, d.Offset())
+	if i == len(cells) {
+		return
+	}
+	last := cells[min(i+n, len(cells))-1]
+	d.buf.DeleteForward(last.off + last.size - d.Offset())
+}
+
 // Delete character under cursor
 func (d *DisplayBox) Del() {
+	if d.hex != nil {
+		d.hexDelete(true)
+		return
+	}
 	d.cursorPosSanityCheck()
 
 	startCoord := *d.cursorCoord
@@ -354,85 +1064,109 @@ func (d *DisplayBox) Del() {
 
 // Delete previous character
 func (d *DisplayBox) Backspace() {
+	if d.hex != nil {
+		d.hexDelete(false)
+		return
+	}
 	d.cursorPosSanityCheck()
 
-	deleted := d.buf.Delete(1)
-
-	if len(deleted) < 1 {
+	if d.autoIndent && d.backspaceIndent() {
 		return
 	}
 
-	if deleted[0] == '\n' {
-		// we've deleted the previous newline. We need to redraw the previous lines and all following lines
+	prev, ok := d.prevCell()
+	if !ok {
+		deleted := d.buf.Delete(1)
+		if len(deleted) < 1 {
+			return
+		}
 
-		lineStart, _ := d.buf.GetLine(0)
-		bufPos, _ := d.buf.Seek(0, io.SeekCurrent)
-		lineOffset := bufPos - int64(lineStart)
+		// we've deleted the previous newline. We need to redraw the previous lines and all following lines
 		d.cursorCoord.Y--
-
-		d.cursorCoord.X = int(lineOffset)
+		d.cursorCoord.X = min(d.cursorCol(), d.viewPortWidth()-1)
 		d.Redraw()
 		return
 	}
 
-	d.cursorCoord.X--
+	col := d.cursorCol()
+	d.buf.Delete(d.Offset() - prev)
+	d.cursorCoord.X = max(d.cursorCoord.X-col+d.cursorCol(), 0)
 	d.redrawLine()
 }
 
 func (d *DisplayBox) Redraw() {
-	if d.borderTop > 0 {
-		// draw borderTop
-		var borderTop = defaultBorderTop
-
-		startPos, _ := d.buf.GetLine((-1 * d.cursorCoord.Y) - 1)
-		if startPos != -1 {
-			// there's more rows above the top of the terminal, indicate that
-			borderTop = overflowBorderTop
-		}
-
-		row := d.firstRowT
-		d.vt100.MoveTo(row, 1)
-		for i := 0; i < d.borderTop; i++ {
-			d.vt100.ClearToEndOfLine()
-			d.vt100.Write(borderTop)
-			row++
-			d.vt100.MoveTo(row, 1)
-		}
+	if d.hex != nil {
+		d.redrawHex()
+		return
 	}
 
+	// there's more rows above the top of the terminal
+	startPos, _ := d.buf.GetLine((-1 * d.cursorCoord.Y) - 1)
+	d.drawBorderTop(startPos != -1)
+
 	for i := 0; i < d.editableRows; i++ {
 		coord := viewPortCoord{X: 0, Y: i}
 		d.redrawLineX(&coord)
 	}
 
-	if d.borderBottom > 0 {
-		// draw borderBottom
-		var borderBottom = defaultBorderBottom
+	// there's more rows below the bottom of the terminal
+	var moreBelow bool
+	editableRowsForward := d.editableRows - d.cursorCoord.Y
+	if editableRowsForward > 0 {
+		startPos, _ := d.buf.GetLine(editableRowsForward)
+		moreBelow = startPos != -1
+	}
+	d.drawBorderBottom(moreBelow)
 
-		editableRowsForward := d.editableRows - d.cursorCoord.Y
+	d.drawStatus()
+	d.redrawCursor()
+}
 
-		if editableRowsForward > 0 {
-			startPos, _ := d.buf.GetLine(editableRowsForward)
-			if startPos != -1 {
-				// there's more rows above below terminal, indicate that
-				borderBottom = overflowBorderBottom
-			}
-		}
+// drawBorderTop draws the top border, if we have one. overflow shows
+// that there is more to see above the editable area.
+func (d *DisplayBox) drawBorderTop(overflow bool) {
+	if d.borderTop == 0 {
+		return
+	}
 
-		row := d.firstRowT + d.editableRows + 1
+	var borderTop = defaultBorderTop
+	if overflow {
+		borderTop = overflowBorderTop
+	}
+
+	row := d.firstRowT
+	d.vt100.MoveTo(row, 1)
+	for i := 0; i < d.borderTop; i++ {
+		d.vt100.ClearToEndOfLine()
+		d.vt100.Write(borderTop)
+		row++
 		d.vt100.MoveTo(row, 1)
+	}
+}
 
-		for i := 0; i < d.borderBottom; i++ {
-			d.vt100.ClearToEndOfLine()
-			d.vt100.Write(borderBottom)
-			row++
-			if i < d.borderBottom-1 {
-				d.vt100.MoveTo(row, 1)
-			}
-		}
+// drawBorderBottom draws the bottom border, if we have one. overflow
+// shows that there is more to see below the editable area.
+func (d *DisplayBox) drawBorderBottom(overflow bool) {
+	if d.borderBottom == 0 {
+		return
 	}
 
-	d.redrawCursor()
+	var borderBottom = defaultBorderBottom
+	if overflow {
+		borderBottom = overflowBorderBottom
+	}
+
+	row := d.firstRowT + d.editableRows + 1
+	d.vt100.MoveTo(row, 1)
+
+	for i := 0; i < d.borderBottom; i++ {
+		d.vt100.ClearToEndOfLine()
+		d.vt100.Write(borderBottom)
+		row++
+		if i < d.borderBottom-1 {
+			d.vt100.MoveTo(row, 1)
+		}
+	}
 }
 
 func (d *DisplayBox) TerminalResize() {
@@ -470,8 +1204,11 @@ func (d *DisplayBox) TerminalResize() {
 
 		if shrinkAmt > 0 {
 			for d.firstRowT > 1 && shrinkAmt > 0 {
-				// there's some space above us, take it
-				d.vt100.ScrollUp()
+				// there's some space above us, take it. If the terminal
+				// can't scroll the redraw below will overwrite those rows.
+				if d.vt100.CanScroll() {
+					d.vt100.ScrollUp()
+				}
 				d.firstRowT--
 				shrinkAmt--
 			}
@@ -479,8 +1216,8 @@ func (d *DisplayBox) TerminalResize() {
 			if shrinkAmt > 0 {
 
 				d.termOwnedRows -= shrinkAmt
-				if d.termOwnedRows < 1+d.borderTop+d.borderBottom {
-					stealAmt := 1 + d.borderTop + d.borderBottom - d.termOwnedRows
+				if d.termOwnedRows < 1+d.borderTop+d.borderBottom+d.statusRows {
+					stealAmt := 1 + d.borderTop + d.borderBottom + d.statusRows - d.termOwnedRows
 					d.firstRowT -= stealAmt
 					if d.firstRowT < 1 {
 						panic(fmt.Sprintf("Terminal too small: shrinkAmt=%d firstRow=%d", shrinkAmt, d.firstRowT))
@@ -540,29 +1277,15 @@ type viewPortCoord struct {
 var perfomCursorSanityCheck bool
 
 func (d *DisplayBox) cursorPosSanityCheck() {
-	if !perfomCursorSanityCheck {
+	if !perfomCursorSanityCheck || d.promptActive {
 		return
 	}
 
-	startLine, endLine := d.buf.GetLine(0)
-	bufOffset, _ := d.buf.Seek(0, io.SeekCurrent)
-
-	lineSize := endLine - startLine
-
-	lineOffsetBytes := int(bufOffset) - startLine
-
-	lineBytes := make([]byte, lineOffsetBytes)
-	d.buf.ReadAt(lineBytes, int64(startLine))
+	cells, _ := d.lineCells(0)
+	col := d.cursorCol()
 
-	var runeCount int
-	for len(lineBytes) > 0 {
-		_, size := utf8.DecodeRune(lineBytes)
-		lineBytes = lineBytes[size:]
-		runeCount++
-	}
-
-	if runeCount != d.cursorCoord.X && lineSize < d.viewPortWidth()-1 {
-		panic(fmt.Sprintf("cursor pos out of sync with buf: cursorX=%d buf=%d", d.cursorCoord.X, runeCount))
+	if col != d.cursorCoord.X && cellsWidth(cells) < d.viewPortWidth()-1 {
+		panic(fmt.Sprintf("cursor pos out of sync with buf: cursorX=%d buf=%d", d.cursorCoord.X, col))
 	}
 
 	calced := d.viewPortToTermCoord(d.cursorCoord)
@@ -593,6 +1316,21 @@ func (d *DisplayBox) viewPortToTermCoord(vp *viewPortCoord) vt100.TermCoord {
 	}
 }
 
+// termToViewPortCoord converts a terminal coordinate to a location in
+// the editable area. It returns false if tc is outside of the editable
+// area.
+func (d *DisplayBox) termToViewPortCoord(tc vt100.TermCoord) (viewPortCoord, bool) {
+	vp := viewPortCoord{
+		X: tc.Col - d.borderLeft - 1,
+		Y: tc.Row - d.firstRowT - d.borderTop,
+	}
+
+	if vp.X < 0 || vp.X >= d.viewPortWidth() || vp.Y < 0 || vp.Y >= d.editableRows {
+		return vp, false
+	}
+	return vp, true
+}
+
 func (d *DisplayBox) redrawLine() {
 	d.redrawLineX(d.cursorCoord)
 	d.redrawCursor()
@@ -610,15 +1348,32 @@ var (
 	overflowBorderRight  = []byte("▶")
 )
 
-func bytesToRunes(b []byte) []rune {
-	out := make([]rune, 0, len(b))
-	for len(b) > 0 {
-		r, size := utf8.DecodeRune(b)
-		b = b[size:]
-		out = append(out, r)
+// writeCells writes the text of cells, which start at column col of
+// their line. Cells that fall within the selection are shown in
+// reverse video, and those past the maximum line length underlined.
+func (d *DisplayBox) writeCells(cells []cell, col int) {
+	var inSel, inOver bool
+	for _, c := range cells {
+		sel := d.selActive && c.off >= d.selStart && c.off < d.selEnd
+		over := d.maxLineLength > 0 && col >= d.maxLineLength
+		if sel != inSel || over != inOver {
+			if inSel || inOver {
+				d.vt100.ResetStyle()
+			}
+			if sel {
+				d.vt100.ReverseVideo()
+			}
+			if over {
+				d.vt100.Underline()
+			}
+			inSel, inOver = sel, over
+		}
+		d.vt100.Write([]byte(c.text))
+		col += c.width
+	}
+	if inSel || inOver {
+		d.vt100.ResetStyle()
 	}
-
-	return out
 }
 
 func (d *DisplayBox) redrawLineX(coord *viewPortCoord) {
@@ -629,7 +1384,7 @@ func (d *DisplayBox) redrawLineX(coord *viewPortCoord) {
 	d.vt100.MoveTo(tc.Row, 1)
 	d.vt100.ClearToEndOfLine()
 
-	lineStart, lineEnd := d.buf.GetLine(bufOffset)
+	cells, lineStart := d.lineCells(bufOffset)
 	if lineStart == -1 {
 		if d.borderBottom > 0 {
 			d.vt100.Write(defaultBorderBottom)
@@ -637,17 +1392,14 @@ func (d *DisplayBox) redrawLineX(coord *viewPortCoord) {
 		return
 	}
 
-	lineBuf := make([]byte, lineEnd-lineStart+1)
-	i, _ := d.buf.ReadAt(lineBuf, int64(lineStart))
-	lineBuf = lineBuf[:i]
-	lineBuf = bytes.TrimRight(lineBuf, "\r\n")
-
-	lineRunes := bytesToRunes(lineBuf)
-
 	leftBorder := defaultBorderLeft
 	rightBorder := defaultBorderRight
 
-	if len(lineRunes) >= d.viewPortWidth()-1 {
+	// pad is written before the cells for the visible part of a wide
+	// cell scrolled off the left edge
+	var pad, col int
+	width := cellsWidth(cells)
+	if width >= d.viewPortWidth()-1 {
 		// our line is longer than the viewport
 
 		var startVisible int
@@ -655,32 +1407,44 @@ func (d *DisplayBox) redrawLineX(coord *viewPortCoord) {
 			// If we are redrawing the line our cursor is on,
 			// figure out the amount we need to scroll.
 			// If we are on a different line we don't scroll
-			cursorLineStart, _ := d.buf.GetLine(0)
-			bufPos, _ := d.buf.Seek(0, io.SeekCurrent)
-			posInLine := bufPos - int64(cursorLineStart)
-
-			startVisible = int(posInLine) - d.cursorCoord.X
+			startVisible = d.cursorCol() - d.cursorCoord.X
 			if startVisible > 0 {
 				leftBorder = overflowBorderLeft
 			}
 		}
 
-		lineRunes = lineRunes[startVisible:]
-		if len(lineRunes) > d.viewPortWidth()-1 {
-			lineRunes = lineRunes[:d.viewPortWidth()-1]
-			rightBorder = overflowBorderRight
+		first := cellAtCol(cells, startVisible)
+		pad = cellsWidth(cells[:min(first+1, len(cells))]) - startVisible
+		if first < len(cells) && pad < cells[first].width {
+			first++
+		} else {
+			pad = 0
+		}
+		col = cellsWidth(cells[:first])
+		cells = cells[first:]
+
+		visible := pad
+		for i, c := range cells {
+			if visible+c.width > d.viewPortWidth()-1 {
+				cells = cells[:i]
+				rightBorder = overflowBorderRight
+				break
+			}
+			visible += c.width
 		}
+		width = visible
 	}
 
 	for i := 0; i < d.borderLeft; i++ {
 		d.vt100.Write(leftBorder)
 	}
 
-	d.vt100.Write([]byte(string(lineRunes)))
+	d.vt100.Write(bytes.Repeat([]byte(" "), pad))
+	d.writeCells(cells, col)
 
 	if d.borderRight > 0 {
-		if len(lineRunes) < d.termSize.Col+d.borderLeft+d.borderRight {
-			for i := d.borderLeft + len(lineRunes); i < d.termSize.Col-1; i++ {
+		if width < d.termSize.Col+d.borderLeft+d.borderRight {
+			for i := d.borderLeft + width; i < d.termSize.Col-1; i++ {
 				d.vt100.Write([]byte(" "))
 			}
 			d.vt100.Write(rightBorder)
@@ -690,16 +1454,15 @@ func (d *DisplayBox) redrawLineX(coord *viewPortCoord) {
 
 func (d *DisplayBox) DebugInfo() string {
 
-	startLine, _ := d.buf.GetLine(0)
-	bufOffset, _ := d.buf.Seek(0, io.SeekCurrent)
-	lineOffset := int(bufOffset) - startLine
+	line, lineOffset := d.buf.LineCol(d.Offset())
 
 	return fmt.Sprintf(`DisplayBox:
 editableRows=%d
 termOwnedRows=%d
 firstRowT=%d
+bufLine=%d
 bufOffsetX=%d
 cursorX=%d
-cursorY=%d`, d.editableRows, d.termOwnedRows, d.firstRowT, lineOffset, d.cursorCoord.X, d.cursorCoord.Y)
+cursorY=%d`, d.editableRows, d.termOwnedRows, d.firstRowT, line, lineOffset, d.cursorCoord.X, d.cursorCoord.Y)
 
 }
@@ -5,10 +5,14 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/psanford/hat/gapbuffer"
+	"github.com/psanford/hat/piecetable"
 	"github.com/psanford/hat/terminal/mock"
+	"github.com/psanford/hat/textbuffer"
 	"github.com/psanford/hat/vt100"
 )
 
@@ -1707,9 +1711,12 @@ func checkResult(t *testing.T, term *mock.MockTerm, expect *bytes.Buffer) {
 }
 
 func setupMock(width, height int, showBorder bool) (*DisplayBox, *mock.MockTerm) {
+	return setupMockBuffer(width, height, showBorder, gapbuffer.New(2))
+}
+
+func setupMockBuffer(width, height int, showBorder bool, gb textbuffer.TextBuffer) (*DisplayBox, *mock.MockTerm) {
 	term := mock.NewMock(width, height)
 	vt := vt100.New(term)
-	gb := gapbuffer.New(2)
 
 	col, row := term.CursorPos()
 	cursorT := vt100.TermCoord{
@@ -1741,3 +1748,1018 @@ func setupMockPartialTerm(width, height, inuseRows int, showBorder bool) (*Displ
 }
 
 const resetSeq = "\x1b[0m"
+
+func TestMouse(t *testing.T) {
+	width := 11
+	height := 4
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height+2, true)
+
+	click := func(t *testing.T, d *DisplayBox, x, y int) {
+		t.Helper()
+		tc := d.viewPortToTermCoord(&viewPortCoord{X: x, Y: y})
+		off, ok := d.OffsetAt(tc)
+		if !ok {
+			t.Fatalf("click at %+v outside editable area", tc)
+		}
+		d.MvTo(off)
+	}
+
+	// like TestCase, but the actions can fail the test
+	testCases := []struct {
+		name       string
+		action     func(t *testing.T, d *DisplayBox)
+		expect     []string
+		withBorder []string
+	}{
+		{
+			name: "Fill screen",
+			action: func(t *testing.T, d *DisplayBox) {
+				for i := 0; i < 8; i++ {
+					d.Insert([]byte(fmt.Sprintf("l%d", i)))
+					if i < 7 {
+						d.InsertNewline()
+					}
+				}
+			},
+			expect: []string{
+				"l4         ",
+				"l5         ",
+				"l6         ",
+				"l7         ",
+			},
+			withBorder: []string{
+				"^^^^       ",
+				"~l4       ~",
+				"~l5       ~",
+				"~l6       ~",
+				"~l7       ~",
+				"~~~~       ",
+			},
+		},
+		{
+			name: "Scroll up",
+			action: func(t *testing.T, d *DisplayBox) {
+				d.Scroll(-2)
+				d.Insert([]byte("*"))
+			},
+			expect: []string{
+				"l2         ",
+				"l3         ",
+				"l4         ",
+				"l5*        ",
+			},
+			withBorder: []string{
+				"^^^^       ",
+				"~l2       ~",
+				"~l3       ~",
+				"~l4       ~",
+				"~l5*      ~",
+				"@@@@       ",
+			},
+		},
+		{
+			name: "Scroll past top",
+			action: func(t *testing.T, d *DisplayBox) {
+				d.Scroll(-10)
+				d.Insert([]byte("+"))
+			},
+			expect: []string{
+				"l0         ",
+				"l1         ",
+				"l2         ",
+				"l3+        ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~l0       ~",
+				"~l1       ~",
+				"~l2       ~",
+				"~l3+      ~",
+				"@@@@       ",
+			},
+		},
+		{
+			name: "Click",
+			action: func(t *testing.T, d *DisplayBox) {
+				click(t, d, 1, 1)
+				d.Insert([]byte("#"))
+			},
+			expect: []string{
+				"l0         ",
+				"l#1        ",
+				"l2         ",
+				"l3+        ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~l0       ~",
+				"~l#1      ~",
+				"~l2       ~",
+				"~l3+      ~",
+				"@@@@       ",
+			},
+		},
+		{
+			name: "Click past end of line",
+			action: func(t *testing.T, d *DisplayBox) {
+				click(t, d, 8, 0)
+				d.Insert([]byte("$"))
+			},
+			expect: []string{
+				"l0$        ",
+				"l#1        ",
+				"l2         ",
+				"l3+        ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~l0$      ~",
+				"~l#1      ~",
+				"~l2       ~",
+				"~l3+      ~",
+				"@@@@       ",
+			},
+		},
+		{
+			name: "Click outside editable area",
+			action: func(t *testing.T, d *DisplayBox) {
+				outside := []vt100.TermCoord{
+					{Row: d.firstRowT - 1, Col: 1},
+					{Row: d.firstRowT + d.borderTop + d.editableRows, Col: 1},
+					{Row: d.firstRowT + d.borderTop, Col: width + 1},
+				}
+				if d.borderLeft > 0 {
+					outside = append(outside, vt100.TermCoord{Row: d.firstRowT + d.borderTop, Col: 1})
+				}
+				for _, tc := range outside {
+					if _, ok := d.OffsetAt(tc); ok {
+						t.Fatalf("click at %+v should be outside editable area", tc)
+					}
+				}
+			},
+			expect: []string{
+				"l0$        ",
+				"l#1        ",
+				"l2         ",
+				"l3+        ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~l0$      ~",
+				"~l#1      ~",
+				"~l2       ~",
+				"~l3+      ~",
+				"@@@@       ",
+			},
+		},
+		{
+			name: "Scroll down",
+			action: func(t *testing.T, d *DisplayBox) {
+				d.Scroll(3)
+				d.Insert([]byte("!"))
+			},
+			expect: []string{
+				"l3+!       ",
+				"l4         ",
+				"l5*        ",
+				"l6         ",
+			},
+			withBorder: []string{
+				"^^^^       ",
+				"~l3+!     ~",
+				"~l4       ~",
+				"~l5*      ~",
+				"~l6       ~",
+				"@@@@       ",
+			},
+		},
+	}
+
+	for _, border := range []bool{false, true} {
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("%s border=%t", tc.name, border), func(t *testing.T) {
+				d, term, expect := dNoBorder, termNoBorder, tc.expect
+				if border {
+					d, term, expect = dBorder, termBorder, tc.withBorder
+				}
+
+				tc.action(t, d)
+
+				buf := new(bytes.Buffer)
+				for _, line := range expect {
+					buf.Write([]byte(line))
+					buf.Write([]byte(resetSeq))
+					buf.Write([]byte("\n"))
+				}
+				buf.Truncate(buf.Len() - 1)
+
+				checkResult(t, term, buf)
+			})
+		}
+	}
+}
+
+func TestPieceTableBackend(t *testing.T) {
+	width := 11
+	height := 5
+
+	dGap, termGap := setupMockBuffer(width, height, true, gapbuffer.New(2))
+	dPiece, termPiece := setupMockBuffer(width, height, true, piecetable.New(nil))
+
+	actions := []func(d *DisplayBox){
+		func(d *DisplayBox) { d.Insert([]byte("hello")) },
+		func(d *DisplayBox) { d.InsertNewline() },
+		func(d *DisplayBox) { d.Insert([]byte("wörld, this is long")) },
+		func(d *DisplayBox) { d.MvUp() },
+		func(d *DisplayBox) { d.MvEOL() },
+		func(d *DisplayBox) { d.Backspace() },
+		func(d *DisplayBox) { d.MvDown() },
+		func(d *DisplayBox) { d.MvBOL() },
+		func(d *DisplayBox) { d.Del() },
+		func(d *DisplayBox) {
+			for i := 0; i < 6; i++ {
+				d.InsertNewline()
+			}
+		},
+		func(d *DisplayBox) { d.MvBOF() },
+		func(d *DisplayBox) { d.Replace(0, 5, []byte("bye"), 3) },
+		func(d *DisplayBox) { d.MvEOF() },
+	}
+
+	for i, action := range actions {
+		action(dGap)
+		action(dPiece)
+
+		var gapScreen, pieceScreen bytes.Buffer
+		termGap.Render(&gapScreen)
+		termPiece.Render(&pieceScreen)
+		if !bytes.Equal(gapScreen.Bytes(), pieceScreen.Bytes()) {
+			t.Fatalf("action %d: screens differ\ngap:\n%s\npiece:\n%s", i, gapScreen.Bytes(), pieceScreen.Bytes())
+		}
+		if dGap.Offset() != dPiece.Offset() {
+			t.Fatalf("action %d: offset gap=%d piece=%d", i, dGap.Offset(), dPiece.Offset())
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	width := 11
+	height := 5
+
+	text := "line0\nline1\nline2\nline3\nline4\nline5\nline6\nline7"
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height, true)
+
+	testCases := []TestCase{
+		{
+			name: "Load at top",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				n, err := d.Load(strings.NewReader(text), 0)
+				if err != nil || n != int64(len(text)) {
+					t.Fatalf("Load got %d, %v", n, err)
+				}
+				if d.Offset() != 0 {
+					t.Fatalf("cursor at %d expected 0", d.Offset())
+				}
+				d.Insert([]byte("!"))
+			},
+			expect: []string{
+				"!line0     ",
+				"line1      ",
+				"line2      ",
+				"line3      ",
+				"line4      ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~!line0   ~",
+				"~line1    ~",
+				"~line2    ~",
+				"@@@@       ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+
+	dNoBorder, termNoBorder = setupMock(width, height, false)
+	dBorder, termBorder = setupMock(width, height, true)
+
+	testCases = []TestCase{
+		{
+			name: "Load at line",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Load(strings.NewReader(text), 6)
+				d.Insert([]byte("!"))
+			},
+			expect: []string{
+				"line3      ",
+				"line4      ",
+				"line5      ",
+				"!line6     ",
+				"line7      ",
+			},
+			withBorder: []string{
+				"^^^^       ",
+				"~line5    ~",
+				"~!line6   ~",
+				"~line7    ~",
+				"~~~~       ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+}
+
+func TestStatusInfo(t *testing.T) {
+	width := 16
+	height := 5
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height, true)
+
+	testCases := []TestCase{
+		{
+			name: "Info on the right",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.EnableStatusLine()
+				d.SetStatusInfo("latin1 crlf")
+				d.Insert([]byte("abc"))
+			},
+			expect: []string{
+				"abc             ",
+				"     latin1 crlf",
+				"                ",
+				"                ",
+				"                ",
+			},
+			withBorder: []string{
+				"~~~~            ",
+				"~abc           ~",
+				"~~~~            ",
+				"     latin1 crlf",
+				"                ",
+			},
+		},
+		{
+			name: "Message and info",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.SetStatus("ok")
+			},
+			expect: []string{
+				"abc             ",
+				"ok   latin1 crlf",
+				"                ",
+				"                ",
+				"                ",
+			},
+			withBorder: []string{
+				"~~~~            ",
+				"~abc           ~",
+				"~~~~            ",
+				"ok   latin1 crlf",
+				"                ",
+			},
+		},
+		{
+			name: "Long message hides info",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.SetStatus("file saved")
+			},
+			expect: []string{
+				"abc             ",
+				"file saved      ",
+				"                ",
+				"                ",
+				"                ",
+			},
+			withBorder: []string{
+				"~~~~            ",
+				"~abc           ~",
+				"~~~~            ",
+				"file saved      ",
+				"                ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+}
+
+func TestMultiLineStatus(t *testing.T) {
+	width := 16
+	height := 6
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height, true)
+
+	testCases := []TestCase{
+		{
+			name: "Rows for each line",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.EnableStatusLine()
+				d.SetStatusInfo("utf-8 lf")
+				d.Insert([]byte("abc"))
+				d.SetStatus("x.go:1:1: oops\nx.go:2:1: oops\n")
+			},
+			expect: []string{
+				"abc             ",
+				"x.go:1:1: oops  ",
+				"x.go:2:1: oops  ",
+				"                ",
+				"                ",
+				"                ",
+			},
+			withBorder: []string{
+				"~~~~            ",
+				"~abc           ~",
+				"~~~~            ",
+				"x.go:1:1: oops  ",
+				"x.go:2:1: oops  ",
+				"                ",
+			},
+		},
+		{
+			name: "Shrink for a shorter message",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.SetStatus("ok")
+			},
+			expect: []string{
+				"abc             ",
+				"ok      utf-8 lf",
+				"                ",
+				"                ",
+				"                ",
+				"                ",
+			},
+			withBorder: []string{
+				"~~~~            ",
+				"~abc           ~",
+				"~~~~            ",
+				"ok      utf-8 lf",
+				"                ",
+				"                ",
+			},
+		},
+		{
+			name: "Control characters are shown as placeholders",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.SetStatus("a\x1b[2Jb\tc\r")
+			},
+			expect: []string{
+				"abc             ",
+				"a^[[2Jb c^M     ",
+				"                ",
+				"                ",
+				"                ",
+				"                ",
+			},
+			withBorder: []string{
+				"~~~~            ",
+				"~abc           ~",
+				"~~~~            ",
+				"a^[[2Jb c^M     ",
+				"                ",
+				"                ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+}
+
+func TestLineCells(t *testing.T) {
+	checks := []struct {
+		line   string
+		text   []string
+		widths []int
+	}{
+		{"ab", []string{"a", "b"}, []int{1, 1}},
+		{"\x1b[2J", []string{"^[", "[", "2", "J"}, []int{2, 1, 1, 1}},
+		{"\x00\x07\x7f", []string{"^@", "^G", "^?"}, []int{2, 2, 2}},
+		{"a\xc2\x9bb", []string{"a", `\x9b`, "b"}, []int{1, 4, 1}},
+		{"\x80\xff", []string{"<80>", "<ff>"}, []int{4, 4}},
+		{"e\xcc\x81\xe2\x98\x83", []string{"e\xcc\x81", "☃"}, []int{1, 1}},
+		{"世界", []string{"世", "界"}, []int{2, 2}},
+		{"a\tb\t", []string{"a", "       ", "b", "       "}, []int{1, 7, 1, 7}},
+		{"x\r", []string{"x", "^M"}, []int{1, 2}},
+	}
+
+	for _, check := range checks {
+		cells := lineCells([]byte(check.line), 10, 8)
+		var (
+			text   []string
+			widths []int
+			off    = 10
+		)
+		for _, c := range cells {
+			if c.off != off {
+				t.Errorf("%q: cell %q at offset %d expected %d", check.line, c.text, c.off, off)
+			}
+			off += c.size
+			text = append(text, c.text)
+			widths = append(widths, c.width)
+		}
+		if off != 10+len(check.line) {
+			t.Errorf("%q: cells cover %d bytes", check.line, off-10)
+		}
+		if diff := cmp.Diff(check.text, text); diff != "" {
+			t.Errorf("%q: text mismatch (-want +got):\n%s", check.line, diff)
+		}
+		if diff := cmp.Diff(check.widths, widths); diff != "" {
+			t.Errorf("%q: width mismatch (-want +got):\n%s", check.line, diff)
+		}
+	}
+}
+
+func TestControlChars(t *testing.T) {
+	width := 11
+	height := 5
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height, true)
+
+	testCases := []TestCase{
+		{
+			name: "Insert escape sequence",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Insert([]byte("a\x1b[2Jb"))
+			},
+			expect: []string{
+				"a^[[2Jb    ",
+				"           ",
+				"           ",
+				"           ",
+				"           ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~a^[[2Jb  ~",
+				"~~~~       ",
+				"           ",
+				"           ",
+			},
+		},
+		{
+			name: "Move left over placeholder",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				for i := 0; i < 5; i++ {
+					d.MvLeft()
+				}
+				if d.cursorCoord.X != 1 || d.Offset() != 1 {
+					t.Fatalf("cursor at x=%d offset=%d expected x=1 offset=1", d.cursorCoord.X, d.Offset())
+				}
+				d.MvRight()
+				d.Backspace()
+				d.Insert([]byte("\x80\t"))
+			},
+			expect: []string{
+				"a<80>   [2 ",
+				"           ",
+				"           ",
+				"           ",
+				"           ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~a<80>    >",
+				"~~~~       ",
+				"           ",
+				"           ",
+			},
+		},
+		{
+			name: "Scroll placeholder off the left edge",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.MvEOL()
+				d.Insert([]byte("xyz"))
+			},
+			expect: []string{
+				"   [2Jbxyz ",
+				"           ",
+				"           ",
+				"           ",
+				"           ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"< [2Jbxyz ~",
+				"~~~~       ",
+				"           ",
+				"           ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+
+	if got := dNoBorder.buf.Bytes(0, dNoBorder.buf.Size()); string(got) != "a\x80\t[2Jbxyz" {
+		t.Fatalf("buffer got %q", got)
+	}
+}
+
+func TestHexMode(t *testing.T) {
+	width := 31
+	height := 6
+
+	text := "\x00\x01AB\xffxyz\n"
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height, true)
+
+	checkCursor := func(d *DisplayBox, term *mock.MockTerm, off int, x int) {
+		t.Helper()
+		if d.Offset() != off || d.hexCursor().X != x {
+			t.Fatalf("cursor at offset=%d x=%d expected offset=%d x=%d", d.Offset(), d.hexCursor().X, off, x)
+		}
+		col, row := term.CursorPos()
+		tc := d.viewPortToTermCoord(d.hexCursor())
+		if col != tc.Col || row != tc.Row {
+			t.Fatalf("terminal cursor at %d,%d expected %d,%d", col, row, tc.Col, tc.Row)
+		}
+	}
+
+	testCases := []TestCase{
+		{
+			name: "Enter hex view",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Load(strings.NewReader(text), 0)
+				d.SetHexMode(true)
+				checkCursor(d, term, 0, 10)
+			},
+			expect: []string{
+				"00000000  00 01 41 42  |..AB|  ",
+				"00000004  ff 78 79 7a  |.xyz|  ",
+				"00000008  0a           |.|     ",
+				"                               ",
+				"                               ",
+				"                               ",
+			},
+			withBorder: []string{
+				"~~~~                           ",
+				"~00000000  00 01 41 42  |..AB|~",
+				"~00000004  ff 78 79 7a  |.xyz|~",
+				"~00000008  0a           |.|   ~",
+				"~~~~                           ",
+				"                               ",
+			},
+		},
+		{
+			name: "Edit both panes",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Insert([]byte("4"))
+				checkCursor(d, term, 0, 11)
+				d.Insert([]byte("g1"))
+				d.HexSwitchPane()
+				checkCursor(d, term, 1, 25)
+				d.Insert([]byte("Z"))
+				d.MvDown()
+				checkCursor(d, term, 6, 26)
+				d.MvEOF()
+				d.Insert([]byte("!"))
+				checkCursor(d, term, 10, 26)
+			},
+			expect: []string{
+				"00000000  41 5a 41 42  |AZAB|  ",
+				"00000004  ff 78 79 7a  |.xyz|  ",
+				"00000008  0a 21        |.!|    ",
+				"                               ",
+				"                               ",
+				"                               ",
+			},
+			withBorder: []string{
+				"~~~~                           ",
+				"~00000000  41 5a 41 42  |AZAB|~",
+				"~00000004  ff 78 79 7a  |.xyz|~",
+				"~00000008  0a 21        |.!|  ~",
+				"~~~~                           ",
+				"                               ",
+			},
+		},
+		{
+			name: "Leave hex view",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Backspace()
+				d.MvUp()
+				d.SetHexMode(false)
+			},
+			expect: []string{
+				"AZAB<ff>xyz                    ",
+				"                               ",
+				"                               ",
+				"                               ",
+				"                               ",
+				"                               ",
+			},
+			withBorder: []string{
+				"~~~~                           ",
+				"~AZAB<ff>xyz                  ~",
+				"~                             ~",
+				"~~~~                           ",
+				"~~~~                           ",
+				"                               ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+
+	if got := dNoBorder.buf.Bytes(0, dNoBorder.buf.Size()); string(got) != "AZAB\xffxyz\n" {
+		t.Fatalf("buffer got %q", got)
+	}
+	if dNoBorder.Offset() != 5 {
+		t.Fatalf("cursor at %d expected 5", dNoBorder.Offset())
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	width := 11
+	height := 5
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height, true)
+
+	testCases := []TestCase{
+		{
+			name: "Replace characters",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Load(strings.NewReader("héllo\nworld"), 0)
+				d.SetOverwrite(true)
+				d.Insert([]byte("J☃"))
+			},
+			expect: []string{
+				"J☃llo      ",
+				"world      ",
+				"           ",
+				"           ",
+				"           ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~J☃llo    ~",
+				"~world    ~",
+				"~~~~       ",
+				"           ",
+			},
+		},
+		{
+			name: "Append at end of line",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Insert([]byte("abcd"))
+				if d.Offset() != 8 || d.cursorCoord.X != 6 {
+					t.Fatalf("cursor at offset=%d x=%d expected offset=8 x=6", d.Offset(), d.cursorCoord.X)
+				}
+			},
+			expect: []string{
+				"J☃abcd     ",
+				"world      ",
+				"           ",
+				"           ",
+				"           ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~J☃abcd   ~",
+				"~world    ~",
+				"~~~~       ",
+				"           ",
+			},
+		},
+		{
+			name: "Newline is inserted",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.MvLeft()
+				d.Insert([]byte("\nX"))
+				d.SetOverwrite(false)
+				d.Insert([]byte("Y"))
+			},
+			expect: []string{
+				"J☃abc      ",
+				"XY         ",
+				"world      ",
+				"           ",
+				"           ",
+			},
+			withBorder: []string{
+				"~~~~       ",
+				"~J☃abc    ~",
+				"~XY       ~",
+				"~world    ~",
+				"~~~~       ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+}
+
+func TestAutoIndent(t *testing.T) {
+	width := 15
+	height := 6
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height, true)
+	for _, d := range []*DisplayBox{dNoBorder, dBorder} {
+		d.SetAutoIndent(true)
+		d.SetIndent("  ", ":")
+	}
+
+	testCases := []TestCase{
+		{
+			name: "Copy and add indentation",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Insert([]byte("a:"))
+				d.InsertNewline()
+				d.Insert([]byte("b: 1"))
+				d.InsertNewline()
+				d.Insert([]byte("c"))
+			},
+			expect: []string{
+				"a:             ",
+				"  b: 1         ",
+				"  c            ",
+				"               ",
+				"               ",
+				"               ",
+			},
+			withBorder: []string{
+				"~~~~           ",
+				"~a:           ~",
+				"~  b: 1       ~",
+				"~  c          ~",
+				"~~~~           ",
+				"               ",
+			},
+		},
+		{
+			name: "Indent and dedent",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.MvUp()
+				d.Indent()
+				d.MvUp()
+				d.Indent()
+				d.Indent()
+				d.MvDown()
+				d.MvDown()
+				d.Dedent()
+				if d.Offset() != 17 {
+					t.Fatalf("cursor at %d expected 17", d.Offset())
+				}
+			},
+			expect: []string{
+				"    a:         ",
+				"    b: 1       ",
+				"c              ",
+				"               ",
+				"               ",
+				"               ",
+			},
+			withBorder: []string{
+				"~~~~           ",
+				"~    a:       ~",
+				"~    b: 1     ~",
+				"~c            ~",
+				"~~~~           ",
+				"               ",
+			},
+		},
+		{
+			name: "Backspace removes a level",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.MvUp()
+				d.MvBOL()
+				d.Insert([]byte("   "))
+				d.Backspace()
+				d.Insert([]byte("x"))
+			},
+			expect: []string{
+				"    a:         ",
+				"  x    b: 1    ",
+				"c              ",
+				"               ",
+				"               ",
+				"               ",
+			},
+			withBorder: []string{
+				"~~~~           ",
+				"~    a:       ~",
+				"~  x    b: 1  ~",
+				"~c            ~",
+				"~~~~           ",
+				"               ",
+			},
+		},
+		{
+			name: "Backspace leaves other whitespace alone",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.MvDown()
+				d.MvBOL()
+				d.Insert([]byte(" \t"))
+				d.Backspace()
+				d.Insert([]byte("x"))
+			},
+			expect: []string{
+				"    a:         ",
+				"  x    b: 1    ",
+				" xc            ",
+				"               ",
+				"               ",
+				"               ",
+			},
+			withBorder: []string{
+				"~~~~           ",
+				"~    a:       ~",
+				"~  x    b: 1  ~",
+				"~ xc          ~",
+				"~~~~           ",
+				"               ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+}
+
+func TestIndentSelection(t *testing.T) {
+	d, _ := setupMock(20, 6, false)
+	d.SetIndent("  ", "")
+	d.Insert([]byte("a\n\n b\nc"))
+
+	check := func(text string, selStart, selEnd int) {
+		t.Helper()
+		got := d.buf.Bytes(0, d.buf.Size())
+		start, end, _ := d.Selection()
+		if string(got) != text || start != selStart || end != selEnd {
+			t.Fatalf("got %q selection [%d, %d) expected %q [%d, %d)", got, start, end, text, selStart, selEnd)
+		}
+	}
+
+	// the selection ends at the start of the last line, so that line
+	// isn't indented, and neither is the blank line
+	d.SetSelection(0, 6)
+	d.Indent()
+	check("  a\n\n   b\nc", 0, 10)
+	d.Dedent()
+	check("a\n\n b\nc", 0, 6)
+	d.Dedent()
+	check("a\n\nb\nc", 0, 5)
+
+	if d.Offset() != 6 {
+		t.Fatalf("cursor at %d expected 6", d.Offset())
+	}
+}
+
+func TestMaxLineLength(t *testing.T) {
+	width := 11
+	height := 4
+
+	dNoBorder, termNoBorder := setupMock(width, height, false)
+	dBorder, termBorder := setupMock(width, height, true)
+	dNoBorder.SetMaxLineLength(4)
+	dBorder.SetMaxLineLength(4)
+
+	testCases := []TestCase{
+		{
+			name: "Underline past the limit",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Insert([]byte("abcdef\nab"))
+			},
+			expect: []string{
+				"\x1b[0mabcd\x1b[0m\x1b[4mef\x1b[0m     ",
+				"\x1b[0mab         ",
+				"           ",
+				"           ",
+			},
+			withBorder: []string{
+				"\x1b[0m~~~~       ",
+				"\x1b[0m~abcd\x1b[0m\x1b[4mef\x1b[0m   ~",
+				"\x1b[0m~ab       ~",
+				"\x1b[0m~~~~       ",
+			},
+		},
+		{
+			name: "Scrolled line",
+			action: func(d *DisplayBox, term *mock.MockTerm) {
+				d.Insert([]byte("cdefghijkl"))
+			},
+			expect: []string{
+				"\x1b[0mabcd\x1b[0m\x1b[4mef\x1b[0m     ",
+				"\x1b[0mcd\x1b[0m\x1b[4mefghijkl\x1b[0m ",
+				"           ",
+				"           ",
+			},
+			withBorder: []string{
+				"\x1b[0m~~~~       ",
+				"\x1b[0m~abcd\x1b[0m\x1b[4mef\x1b[0m   ~",
+				"\x1b[0m<\x1b[0m\x1b[4mefghijkl\x1b[0m ~",
+				"\x1b[0m~~~~       ",
+			},
+		},
+	}
+
+	checkResults(t, testCases, dNoBorder, dBorder, termNoBorder, termBorder)
+}
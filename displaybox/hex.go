@@ -0,0 +1,372 @@
+package displaybox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// hexView is the state of the hex view, see SetHexMode. The cursor is
+// still the buffer's cursor, which may be at any byte offset.
+type hexView struct {
+	// index of the row shown at the top of the editable area
+	top int
+	// ascii is set when typing edits the ASCII gutter rather than the
+	// hex bytes
+	ascii bool
+	// lowNibble is set when the next hex digit typed replaces the low
+	// four bits of the byte under the cursor
+	lowNibble bool
+}
+
+// hexLayout describes the columns of a hex view row:
+//
+//	00000010  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 0a 00 01  |Hello, world!...|
+type hexLayout struct {
+	perRow   int
+	offWidth int
+}
+
+func (l hexLayout) byteCol(i int) int {
+	return l.offWidth + 2 + 3*i + i/8
+}
+
+func (l hexLayout) gutterCol() int {
+	return l.byteCol(l.perRow-1) + 4
+}
+
+func (l hexLayout) width() int {
+	return l.gutterCol() + 2 + l.perRow
+}
+
+// line returns the row for the bytes b found at offset off.
+func (l hexLayout) line(off int, b []byte) []byte {
+	const digits = "0123456789abcdef"
+
+	line := bytes.Repeat([]byte(" "), l.width())
+	copy(line, fmt.Sprintf("%0*x", l.offWidth, off))
+	if len(b) == 0 {
+		return line[:l.offWidth]
+	}
+
+	g := l.gutterCol()
+	line[g] = '|'
+	for i, c := range b {
+		line[l.byteCol(i)] = digits[c>>4]
+		line[l.byteCol(i)+1] = digits[c&0xf]
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		line[g+1+i] = c
+	}
+	line[g+1+len(b)] = '|'
+	return line[:g+2+len(b)]
+}
+
+// hexLayout returns the layout for the current buffer size, with as
+// many bytes per row as fit in the view, up to 16.
+func (d *DisplayBox) hexLayout() hexLayout {
+	l := hexLayout{
+		perRow:   16,
+		offWidth: max(8, len(strconv.FormatInt(int64(d.buf.Size()), 16))),
+	}
+	for l.perRow > 1 && l.width() > d.viewPortWidth() {
+		l.perRow /= 2
+	}
+	return l
+}
+
+// SetHexMode switches between showing the buffer as text and as a hex
+// dump with an offset column, the hex bytes and an ASCII gutter. In the
+// hex view typing overwrites the byte under the cursor, either a hex
+// digit at a time or as an ASCII character, see HexSwitchPane. Typing
+// at the end of the buffer appends.
+func (d *DisplayBox) SetHexMode(on bool) {
+	if on == (d.hex != nil) {
+		return
+	}
+	d.selActive = false
+
+	if on {
+		d.hex = &hexView{}
+		for d.editableRows < d.hexRows() {
+			if !d.growRegion() {
+				break
+			}
+		}
+		d.Redraw()
+		return
+	}
+
+	d.hex = nil
+	// the hex cursor can be part way through a character
+	cells, _ := d.lineCells(0)
+	if i := cellAtOffset(cells, d.Offset()); i < len(cells) {
+		d.buf.Seek(int64(cells[i].off), io.SeekStart)
+	}
+	d.recenter()
+}
+
+// HexMode reports whether the hex view is shown.
+func (d *DisplayBox) HexMode() bool {
+	return d.hex != nil
+}
+
+// HexSwitchPane moves the cursor between the hex bytes and the ASCII
+// gutter.
+func (d *DisplayBox) HexSwitchPane() {
+	if d.hex == nil {
+		return
+	}
+	d.hex.ascii = !d.hex.ascii
+	d.hex.lowNibble = false
+	d.redrawCursor()
+}
+
+// hexRows returns the number of rows in the hex view, including the
+// row the cursor moves to to append to the buffer.
+func (d *DisplayBox) hexRows() int {
+	return d.buf.Size()/d.hexLayout().perRow + 1
+}
+
+// hexCursor returns the location of the cursor in the hex view.
+func (d *DisplayBox) hexCursor() *viewPortCoord {
+	l := d.hexLayout()
+	off := d.Offset()
+	i := off % l.perRow
+
+	c := &viewPortCoord{Y: off/l.perRow - d.hex.top}
+	if d.hex.ascii {
+		c.X = l.gutterCol() + 1 + i
+	} else {
+		c.X = l.byteCol(i)
+		if d.hex.lowNibble {
+			c.X++
+		}
+	}
+	c.X = min(c.X, d.viewPortWidth()-1)
+	return c
+}
+
+// hexScrollToCursor adjusts the top row so the cursor's row is visible.
+// It reports whether the view scrolled.
+func (d *DisplayBox) hexScrollToCursor() bool {
+	row := d.Offset() / d.hexLayout().perRow
+
+	// don't leave empty rows at the bottom if there are rows above
+	top := min(d.hex.top, max(0, d.hexRows()-d.editableRows))
+	if row < top {
+		top = row
+	} else if row >= top+d.editableRows {
+		top = row - d.editableRows + 1
+	}
+
+	scrolled := top != d.hex.top
+	d.hex.top = top
+	return scrolled
+}
+
+func (d *DisplayBox) hexMvTo(off int) {
+	off = max(0, min(off, d.buf.Size()))
+	d.buf.Seek(int64(off), io.SeekStart)
+	d.hex.lowNibble = false
+
+	if d.hexScrollToCursor() {
+		d.Redraw()
+	} else {
+		d.redrawCursor()
+	}
+}
+
+func (d *DisplayBox) hexMvLeft() {
+	if d.hex.lowNibble {
+		d.hex.lowNibble = false
+		d.redrawCursor()
+		return
+	}
+	d.hexMvTo(d.Offset() - 1)
+}
+
+// hexMvRows moves the cursor n rows up or down, to the first or last
+// row if there are fewer than n.
+func (d *DisplayBox) hexMvRows(n int) {
+	perRow := d.hexLayout().perRow
+	off := d.Offset() + n*perRow
+	if off < 0 {
+		off = d.Offset() % perRow
+	}
+	d.hexMvTo(off)
+}
+
+func (d *DisplayBox) hexMvBOL() {
+	off := d.Offset()
+	d.hexMvTo(off - off%d.hexLayout().perRow)
+}
+
+func (d *DisplayBox) hexMvEOL() {
+	perRow := d.hexLayout().perRow
+	off := d.Offset()
+	d.hexMvTo(off - off%perRow + perRow - 1)
+}
+
+// hexScroll scrolls the view n rows, moving the cursor along if it
+// would leave the view.
+func (d *DisplayBox) hexScroll(n int) {
+	perRow := d.hexLayout().perRow
+	top := max(0, min(d.hex.top+n, d.hexRows()-d.editableRows))
+
+	off := d.Offset()
+	if row := off / perRow; row < top {
+		off += (top - row) * perRow
+	} else if row >= top+d.editableRows {
+		off -= (row - top - d.editableRows + 1) * perRow
+	}
+
+	d.hex.top = top
+	d.buf.Seek(int64(min(off, d.buf.Size())), io.SeekStart)
+	d.hex.lowNibble = false
+	d.Redraw()
+}
+
+// hexOffsetAt returns the offset of the byte shown at vp, in either
+// pane.
+func (d *DisplayBox) hexOffsetAt(vp viewPortCoord) int {
+	l := d.hexLayout()
+
+	var i int
+	if vp.X >= l.gutterCol() {
+		i = vp.X - l.gutterCol() - 1
+	} else {
+		for i < l.perRow-1 && vp.X >= l.byteCol(i+1) {
+			i++
+		}
+	}
+	i = max(0, min(i, l.perRow-1))
+
+	return min((d.hex.top+vp.Y)*l.perRow+i, d.buf.Size())
+}
+
+// hexInput overwrites the byte under the cursor with r. In the hex pane
+// r is a hex digit setting half of the byte, in the gutter it is a
+// printable ASCII character. Anything else is ignored.
+func (d *DisplayBox) hexInput(r rune) {
+	off := d.Offset()
+
+	if d.hex.ascii {
+		if r < 0x20 || r > 0x7e {
+			return
+		}
+		d.hexSetByte(off, byte(r))
+		d.hexMvTo(off + 1)
+		return
+	}
+
+	v, err := strconv.ParseUint(string(r), 16, 4)
+	if err != nil {
+		return
+	}
+	var b byte
+	if off < d.buf.Size() {
+		b = d.byteAt(off)
+	}
+	if d.hex.lowNibble {
+		d.hexSetByte(off, b&0xf0|byte(v))
+		d.hexMvTo(off + 1)
+	} else {
+		d.hexSetByte(off, byte(v)<<4|b&0x0f)
+		d.hex.lowNibble = true
+		d.redrawCursor()
+	}
+}
+
+// hexSetByte replaces the byte at off, or appends b if off is the end
+// of the buffer. The cursor is left at off.
+func (d *DisplayBox) hexSetByte(off int, b byte) {
+	rows := d.hexRows()
+
+	d.buf.Seek(int64(off), io.SeekStart)
+	if off < d.buf.Size() {
+		d.buf.DeleteForward(1)
+	}
+	d.buf.Insert([]byte{b})
+	d.buf.Seek(int64(off), io.SeekStart)
+
+	if d.hexRows() != rows {
+		// appending started a new row
+		if d.editableRows < d.hexRows() {
+			d.growRegion()
+		}
+		d.Redraw()
+		return
+	}
+	d.redrawHexRow(off/d.hexLayout().perRow - d.hex.top)
+}
+
+// hexDelete removes the byte before the cursor, or the one under it if
+// forward is set.
+func (d *DisplayBox) hexDelete(forward bool) {
+	var deleted []byte
+	if forward {
+		deleted = d.buf.DeleteForward(1)
+	} else {
+		deleted = d.buf.Delete(1)
+	}
+	if len(deleted) == 0 {
+		return
+	}
+	d.hex.lowNibble = false
+	// everything after the cursor shifts
+	d.Redraw()
+}
+
+func (d *DisplayBox) redrawHex() {
+	d.hexScrollToCursor()
+
+	d.drawBorderTop(d.hex.top > 0)
+	for y := 0; y < d.editableRows; y++ {
+		d.redrawHexRow(y)
+	}
+	d.drawBorderBottom(d.hex.top+d.editableRows < d.hexRows())
+
+	d.drawStatus()
+	d.redrawCursor()
+}
+
+// redrawHexRow draws row y of the editable area.
+func (d *DisplayBox) redrawHexRow(y int) {
+	l := d.hexLayout()
+	tc := d.viewPortToTermCoord(&viewPortCoord{Y: y})
+
+	d.vt100.MoveTo(tc.Row, 1)
+	d.vt100.ClearToEndOfLine()
+
+	off := (d.hex.top + y) * l.perRow
+	if off > d.buf.Size() {
+		if d.borderBottom > 0 {
+			d.vt100.Write(defaultBorderBottom)
+		}
+		return
+	}
+
+	b := make([]byte, l.perRow)
+	n, _ := d.buf.ReadAt(b, int64(off))
+	line := l.line(off, b[:n])
+
+	rightBorder := defaultBorderRight
+	if len(line) > d.viewPortWidth() {
+		line = line[:d.viewPortWidth()]
+		rightBorder = overflowBorderRight
+	}
+
+	for i := 0; i < d.borderLeft; i++ {
+		d.vt100.Write(defaultBorderLeft)
+	}
+	d.vt100.Write(line)
+	if d.borderRight > 0 {
+		for i := d.borderLeft + len(line); i < d.termSize.Col-1; i++ {
+			d.vt100.Write([]byte(" "))
+		}
+		d.vt100.Write(rightBorder)
+	}
+}
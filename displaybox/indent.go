@@ -0,0 +1,158 @@
+package displaybox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/psanford/hat/textbuffer"
+)
+
+// SetAutoIndent turns auto-indent on or off. With auto-indent
+// InsertNewline starts the new line with the indentation of the line
+// it was split from, one level deeper if the text before the cursor
+// ends with one of the characters given to SetIndent, and Backspace in
+// leading whitespace removes a whole level.
+func (d *DisplayBox) SetAutoIndent(on bool) {
+	d.autoIndent = on
+}
+
+// SetIndent sets the text of one level of indentation, a tab or some
+// number of spaces, and the characters that open a deeper level when
+// they end a line, such as "{([" or ":".
+func (d *DisplayBox) SetIndent(unit, after string) {
+	if unit == "" {
+		unit = "\t"
+	}
+	d.indent = unit
+	d.indentAfter = after
+}
+
+// indentWidth returns the number of columns in one level of
+// indentation.
+func (d *DisplayBox) indentWidth() int {
+	return cellsWidth(lineCells([]byte(d.indent), 0, d.tabWidth))
+}
+
+// newlineIndent returns the indentation for a line started at the
+// cursor.
+func (d *DisplayBox) newlineIndent() []byte {
+	lineStart, _ := d.buf.GetLine(0)
+	before := make([]byte, d.Offset()-lineStart)
+	d.buf.ReadAt(before, int64(lineStart))
+
+	indent := before[:len(before)-len(bytes.TrimLeft(before, " \t"))]
+	text := bytes.TrimRight(before, " \t")
+	if len(text) > 0 && strings.IndexByte(d.indentAfter, text[len(text)-1]) >= 0 {
+		indent = append(indent, d.indent...)
+	}
+	return indent
+}
+
+// backspaceIndent removes whitespace before the cursor back to the
+// previous indentation level if there is only indentation made of the
+// indent unit before the cursor on its line. It reports whether it did.
+func (d *DisplayBox) backspaceIndent() bool {
+	lineStart, _ := d.buf.GetLine(0)
+	before := make([]byte, d.Offset()-lineStart)
+	d.buf.ReadAt(before, int64(lineStart))
+	// leave whitespace indented some other way, such as spaces when the
+	// unit is a tab, to the plain backspace
+	if len(before) == 0 || len(bytes.Trim(before, d.indent)) > 0 {
+		return false
+	}
+
+	width := func(b []byte) int {
+		return cellsWidth(lineCells(b, lineStart, d.tabWidth))
+	}
+
+	w := d.indentWidth()
+	target := (width(before) - 1) / w * w
+	n := len(before)
+	for n > 0 && width(before[:n]) > target {
+		n--
+	}
+
+	col := d.cursorCol()
+	d.buf.Delete(len(before) - n)
+	d.cursorCoord.X = max(d.cursorCoord.X-col+d.cursorCol(), 0)
+	d.redrawLine()
+	return true
+}
+
+// Indent adds a level of indentation to the cursor's line, or to every
+// non-blank line of the selection.
+func (d *DisplayBox) Indent() {
+	d.reindent(func(line []byte) (int, []byte) {
+		return 0, []byte(d.indent)
+	})
+}
+
+// Dedent removes a level of indentation from the cursor's line, or from
+// every line of the selection.
+func (d *DisplayBox) Dedent() {
+	w := d.indentWidth()
+	d.reindent(func(line []byte) (int, []byte) {
+		var n, col int
+		for n < len(line) && col < w {
+			switch line[n] {
+			case ' ':
+				col++
+			case '\t':
+				col += d.tabWidth - col%d.tabWidth
+			default:
+				return n, nil
+			}
+			n++
+		}
+		return n, nil
+	})
+}
+
+// reindent replaces the start of each line of the cursor's line or the
+// selection. edit returns the number of bytes to remove from the start
+// of line and the text to insert in their place. The cursor and the
+// selection stay with the text around them.
+func (d *DisplayBox) reindent(edit func(line []byte) (int, []byte)) {
+	if d.hex != nil {
+		return
+	}
+	d.cursorPosSanityCheck()
+
+	first := d.buf.LineAt(d.Offset())
+	last := first
+	if d.selActive && d.selEnd > d.selStart {
+		first = d.buf.LineAt(d.selStart)
+		// a selection ending at the start of a line doesn't include it
+		last = d.buf.LineAt(d.selEnd - 1)
+	}
+
+	cursor := d.buf.NewAnchor(d.Offset(), textbuffer.GravityRight)
+	defer d.buf.RemoveAnchor(cursor)
+	selStart := d.buf.NewAnchor(d.selStart, textbuffer.GravityLeft)
+	defer d.buf.RemoveAnchor(selStart)
+	selEnd := d.buf.NewAnchor(d.selEnd, textbuffer.GravityRight)
+	defer d.buf.RemoveAnchor(selEnd)
+
+	// work from the bottom so the earlier line numbers stay valid
+	for l := last; l >= first; l-- {
+		start, end := d.buf.LineStart(l), d.buf.LineEnd(l)
+		line := make([]byte, end-start)
+		d.buf.ReadAt(line, int64(start))
+		if first != last && len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		remove, insert := edit(line)
+		d.buf.Seek(int64(start), io.SeekStart)
+		d.buf.DeleteForward(remove)
+		d.buf.Insert(insert)
+	}
+
+	d.buf.Seek(int64(cursor.Offset()), io.SeekStart)
+	if d.selActive {
+		d.selStart, d.selEnd = selStart.Offset(), selEnd.Offset()
+	}
+	d.placeCursor(0)
+	d.Redraw()
+}
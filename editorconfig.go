@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/psanford/hat/charset"
+	"github.com/psanford/hat/editorconfig"
+	"github.com/psanford/hat/eol"
+)
+
+// applyEditorConfig applies the EditorConfig settings for the file being
+// edited on top of the file type's. Settings with values we don't
+// understand are left alone.
+func (ed *editor) applyEditorConfig() error {
+	if ed.filename == "" {
+		return nil
+	}
+	p, err := editorconfig.Lookup(ed.filename)
+	if err != nil {
+		return err
+	}
+
+	if width, ok := p.Int("tab_width"); ok {
+		ed.disp.SetTabWidth(width)
+	}
+
+	indent := ed.fileType.indent
+	switch p["indent_style"] {
+	case "tab":
+		indent = "\t"
+	case "space":
+		indent = "    "
+		if !strings.Contains(ed.fileType.indent, "\t") {
+			indent = ed.fileType.indent
+		}
+	}
+	if size, ok := p.Int("indent_size"); ok && indent != "\t" {
+		indent = strings.Repeat(" ", size)
+	}
+	ed.disp.SetIndent(indent, ed.fileType.indentAfter)
+
+	if v, ok := p.Bool("trim_trailing_whitespace"); ok {
+		ed.saveOpts.trimTrailingWhitespace = v
+	}
+	if v, ok := p.Bool("insert_final_newline"); ok {
+		ed.saveOpts.finalNewline = v
+	}
+
+	if n, ok := p.Int("max_line_length"); ok {
+		ed.disp.SetMaxLineLength(n)
+	}
+
+	if ed.binary {
+		// binary files are saved exactly as they were loaded
+		return nil
+	}
+	if v := p["end_of_line"]; v != "" {
+		style, err := eol.Parse(v)
+		if err != nil {
+			return fmt.Errorf("%s: end_of_line: %w", editorconfig.ConfigName, err)
+		}
+		ed.lineEnding = style
+		ed.saveOpts.normalizeLineEndings = true
+	}
+	if v := p["charset"]; v != "" {
+		enc, err := charset.Parse(v)
+		if err != nil {
+			return fmt.Errorf("%s: charset: %w", editorconfig.ConfigName, err)
+		}
+		ed.encoding = enc
+	}
+	return nil
+}
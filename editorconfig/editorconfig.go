@@ -0,0 +1,375 @@
+// Package editorconfig finds the EditorConfig settings that apply to a
+// file, see https://editorconfig.org.
+package editorconfig
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ConfigName is the name of the files settings are read from.
+const ConfigName = ".editorconfig"
+
+// Properties holds the settings for a file by name, such as
+// "indent_style". Names, and the values of the properties the
+// specification defines, are lower case.
+type Properties map[string]string
+
+// knownProperties have case insensitive values.
+var knownProperties = map[string]bool{
+	"root":                     true,
+	"indent_style":             true,
+	"indent_size":              true,
+	"tab_width":                true,
+	"end_of_line":              true,
+	"charset":                  true,
+	"trim_trailing_whitespace": true,
+	"insert_final_newline":     true,
+	"max_line_length":          true,
+}
+
+// Int returns the value of a numeric property.
+func (p Properties) Int(name string) (int, bool) {
+	n, err := strconv.Atoi(p[name])
+	return n, err == nil && n > 0
+}
+
+// Bool returns the value of a true or false property.
+func (p Properties) Bool(name string) (value, ok bool) {
+	switch p[name] {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+// Lookup returns the properties for the file at path. They come from the
+// ConfigName files in its directory and the ones above it, up to the
+// first that has root = true, with the nearest taking precedence.
+func Lookup(path string) (Properties, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// nearest first
+	var files []*File
+	for dir := filepath.Dir(path); ; {
+		f, err := parseFile(filepath.Join(dir, ConfigName))
+		if err == nil {
+			files = append(files, f)
+			if f.Root {
+				break
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	p := make(Properties)
+	for i := len(files) - 1; i >= 0; i-- {
+		files[i].apply(path, p)
+	}
+	p.fillDefaults()
+	return p, nil
+}
+
+// fillDefaults sets the properties the specification derives from
+// others.
+func (p Properties) fillDefaults() {
+	if p["indent_style"] == "tab" && p["indent_size"] == "" {
+		p["indent_size"] = "tab"
+	}
+	if p["indent_size"] == "tab" && p["tab_width"] != "" {
+		p["indent_size"] = p["tab_width"]
+	}
+	if _, ok := p.Int("indent_size"); ok && p["tab_width"] == "" {
+		p["tab_width"] = p["indent_size"]
+	}
+}
+
+// A File is a parsed ConfigName file.
+type File struct {
+	// Root is set if files in the directories above shouldn't be read
+	Root     bool
+	Sections []Section
+
+	// dir is the directory the file's globs are relative to
+	dir string
+}
+
+// A Section holds the properties for the files matching a glob.
+type Section struct {
+	Glob       string
+	Properties Properties
+
+	re     *regexp.Regexp
+	ranges []numRange
+}
+
+func parseFile(name string) (*File, error) {
+	r, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	f.dir = filepath.Dir(name)
+	return f, nil
+}
+
+// Parse reads a ConfigName file. Lines that can't be parsed are
+// ignored, as the specification asks.
+func Parse(r io.Reader) (*File, error) {
+	var f File
+
+	var section *Section
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			f.Sections = append(f.Sections, Section{
+				Glob:       line[1 : len(line)-1],
+				Properties: make(Properties),
+			})
+			section = &f.Sections[len(f.Sections)-1]
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if knownProperties[key] {
+			value = strings.ToLower(value)
+		}
+
+		if section == nil {
+			// the preamble can only set root
+			if key == "root" {
+				f.Root = value == "true"
+			}
+			continue
+		}
+		section.Properties[key] = value
+	}
+	return &f, s.Err()
+}
+
+// apply copies the properties of the sections matching path into p.
+func (f *File) apply(path string, p Properties) {
+	for i := range f.Sections {
+		s := &f.Sections[i]
+		if !s.match(f.dir, path) {
+			continue
+		}
+		for k, v := range s.Properties {
+			if v == "unset" {
+				delete(p, k)
+			} else {
+				p[k] = v
+			}
+		}
+	}
+}
+
+// match reports whether path matches the section's glob, which is
+// relative to dir.
+func (s *Section) match(dir, path string) bool {
+	if s.re == nil {
+		glob := s.Glob
+		if !strings.Contains(glob, "/") {
+			glob = "**/" + glob
+		}
+		glob = strings.TrimPrefix(glob, "/")
+
+		prefix := filepath.ToSlash(dir)
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+
+		var expr string
+		expr, s.ranges = translate(glob, nil)
+		re, err := regexp.Compile("^" + regexp.QuoteMeta(prefix) + expr + "$")
+		if err != nil {
+			// a glob like [z-a] doesn't match anything
+			re = neverMatch
+		}
+		s.re = re
+	}
+
+	m := s.re.FindStringSubmatch(filepath.ToSlash(path))
+	if m == nil {
+		return false
+	}
+	for i, r := range s.ranges {
+		if m[i+1] == "" {
+			// in an alternative that didn't match
+			continue
+		}
+		if n, _ := strconv.Atoi(m[i+1]); n < r.lo || n > r.hi {
+			return false
+		}
+	}
+	return true
+}
+
+// numRange is a {lo..hi} glob.
+type numRange struct {
+	lo, hi int
+}
+
+var neverMatch = regexp.MustCompile(`[^\s\S]`)
+
+var numRangeRe = regexp.MustCompile(`^([+-]?\d+)\.\.([+-]?\d+)$`)
+
+// translate converts glob to a regular expression. Each {lo..hi} in
+// glob becomes a capture group, and its range is appended to ranges in
+// the order of the groups.
+func translate(glob string, ranges []numRange) (string, []numRange) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '*':
+			switch {
+			case strings.HasPrefix(glob[i:], "**/"):
+				// any number of directories, including none
+				b.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(glob[i:], "**"):
+				b.WriteString(".*")
+				i++
+			default:
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end <= 0 || strings.Contains(glob[i+1:i+1+end], "/") {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			b.WriteByte('[')
+			if class[0] == '!' {
+				b.WriteByte('^')
+				class = class[1:]
+			}
+			for _, r := range class {
+				if r == '\\' || r == '[' || r == ']' || r == '^' {
+					b.WriteByte('\\')
+				}
+				b.WriteRune(r)
+			}
+			b.WriteByte(']')
+			i += end + 1
+		case '{':
+			end := closingBrace(glob, i)
+			if end < 0 {
+				b.WriteString(`\{`)
+				continue
+			}
+			inner := glob[i+1 : end]
+			if m := numRangeRe.FindStringSubmatch(inner); m != nil {
+				lo, _ := strconv.Atoi(m[1])
+				hi, _ := strconv.Atoi(m[2])
+				ranges = append(ranges, numRange{min(lo, hi), max(lo, hi)})
+				b.WriteString(`([+-]?\d+)`)
+			} else if alts := splitAlternatives(inner); len(alts) > 1 {
+				b.WriteString("(?:")
+				for j, alt := range alts {
+					if j > 0 {
+						b.WriteByte('|')
+					}
+					var expr string
+					expr, ranges = translate(alt, ranges)
+					b.WriteString(expr)
+				}
+				b.WriteByte(')')
+			} else {
+				// braces without a comma are literal
+				var expr string
+				expr, ranges = translate(inner, ranges)
+				b.WriteString(`\{` + expr + `\}`)
+			}
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String(), ranges
+}
+
+// closingBrace returns the index of the brace closing the one at
+// glob[open], or -1.
+func closingBrace(glob string, open int) int {
+	depth := 0
+	for i := open; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitAlternatives splits s at the commas outside of nested braces.
+func splitAlternatives(s string) []string {
+	var alts []string
+	var depth, start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alts, s[start:])
+}
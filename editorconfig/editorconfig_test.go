@@ -0,0 +1,151 @@
+package editorconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGlob(t *testing.T) {
+	checks := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"*", "/p/a.go", true},
+		{"*", "/p/sub/a.go", true},
+		{"*.go", "/p/sub/a.go", true},
+		{"*.go", "/p/a.goo", false},
+		{"/*.go", "/p/a.go", true},
+		{"/*.go", "/p/sub/a.go", false},
+		{"sub/*.go", "/p/sub/a.go", true},
+		{"sub/*.go", "/p/x/sub/a.go", false},
+		{"**/*.go", "/p/x/sub/a.go", true},
+		{"a?c", "/p/abc", true},
+		{"a?c", "/p/a/c", false},
+		{"[ab].txt", "/p/b.txt", true},
+		{"[!ab].txt", "/p/b.txt", false},
+		{"[!ab].txt", "/p/c.txt", true},
+		{"*.{js,ts}", "/p/a.ts", true},
+		{"*.{js,ts}", "/p/a.go", false},
+		{"{a,{b,c}}.md", "/p/c.md", true},
+		{"{single}.md", "/p/{single}.md", true},
+		{"file{1..10}", "/p/file7", true},
+		{"file{1..10}", "/p/file11", false},
+		{"file{-3..3}", "/p/file-2", true},
+		{"{Makefile,*.{mk,{a..b}}}", "/p/Makefile", true},
+		{"a\\*b", "/p/a*b", true},
+		{"a\\*b", "/p/axb", false},
+		{"[a", "/p/[a", true},
+		{"a.go", "/q/a.go", false},
+		{"[z-a].go", "/p/b.go", false},
+		{"[!].go", "/p/b.go", false},
+	}
+
+	for _, check := range checks {
+		s := Section{Glob: check.glob}
+		if got := s.match("/p", check.path); got != check.match {
+			t.Errorf("glob %q path %q got %t expected %t", check.glob, check.path, got, check.match)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(`
+; comment
+root = TRUE
+
+[*]
+Indent_Style = Space
+indent_size = 2
+# comment
+not a property
+custom = MixedCase
+
+[*.go]
+indent_style = tab
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Root {
+		t.Errorf("expected root")
+	}
+
+	var got []Properties
+	for _, s := range f.Sections {
+		got = append(got, s.Properties)
+	}
+	expect := []Properties{
+		{"indent_style": "space", "indent_size": "2", "custom": "MixedCase"},
+		{"indent_style": "tab"},
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("sections differ (-expect +got):\n%s", diff)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		ConfigName: `
+[*]
+charset = latin1
+end_of_line = crlf
+`,
+		"repo/" + ConfigName: `
+root = true
+
+[*]
+indent_style = space
+indent_size = 4
+insert_final_newline = true
+
+[*.go]
+indent_style = tab
+indent_size = unset
+
+[*.c]
+indent_style = tab
+indent_size = 4
+`,
+		"repo/sub/" + ConfigName: `
+[*.{go,md}]
+trim_trailing_whitespace = true
+tab_width = 8
+`,
+	}
+	for name, text := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checks := []struct {
+		path   string
+		expect Properties
+	}{
+		{"a.txt", Properties{"charset": "latin1", "end_of_line": "crlf"}},
+		{"repo/a.txt", Properties{"indent_style": "space", "indent_size": "4", "tab_width": "4", "insert_final_newline": "true"}},
+		{"repo/sub/a.go", Properties{"indent_style": "tab", "indent_size": "8", "tab_width": "8", "insert_final_newline": "true", "trim_trailing_whitespace": "true"}},
+		{"repo/other/a.go", Properties{"indent_style": "tab", "indent_size": "tab", "insert_final_newline": "true"}},
+		{"repo/a.c", Properties{"indent_style": "tab", "indent_size": "4", "tab_width": "4", "insert_final_newline": "true"}},
+	}
+
+	for _, check := range checks {
+		got, err := Lookup(filepath.Join(dir, check.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(check.expect, got); diff != "" {
+			t.Errorf("%s properties differ (-expect +got):\n%s", check.path, diff)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/psanford/hat/editorconfig"
+	"github.com/psanford/hat/terminal/mock"
+)
+
+func TestEditorConfigTabWidth(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config string
+		expect string
+	}{
+		{name: "Default", config: "[*]\n", expect: "        x"},
+		{name: "Tab width", config: "[*]\ntab_width = 2\n", expect: "  x"},
+		{name: "From indent size", config: "[*]\nindent_style = tab\nindent_size = 4\n", expect: "    x"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, editorconfig.ConfigName), []byte("root = true\n"+tc.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			ed := newTestEditor(t, "")
+			ed.filename = filepath.Join(dir, "a.txt")
+			if err := ed.applyEditorConfig(); err != nil {
+				t.Fatal(err)
+			}
+			ed.disp.Insert([]byte("\tx"))
+
+			var screen bytes.Buffer
+			if err := ed.term.(*mock.MockTerm).Render(&screen); err != nil {
+				t.Fatal(err)
+			}
+			line, _, _ := bytes.Cut(screen.Bytes(), []byte("\n"))
+			line = bytes.TrimSuffix(line, []byte("\x1b[0m"))
+			if got := string(bytes.TrimRight(line, " ")); got != tc.expect {
+				t.Errorf("got line %q expected %q", got, tc.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// eol detects and converts line ending conventions. hat keeps text in
+// its buffers with \n line endings, files using other conventions are
+// converted by a Reader on load and a Writer on save.
+package eol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Style is a line ending convention.
+type Style int
+
+const (
+	// LF ends lines with \n.
+	LF Style = iota
+	// CRLF ends lines with \r\n.
+	CRLF
+	// CR ends lines with \r.
+	CR
+)
+
+func (s Style) String() string {
+	switch s {
+	case CRLF:
+		return "crlf"
+	case CR:
+		return "cr"
+	}
+	return "lf"
+}
+
+// Parse returns the Style with the given name. The vi fileformat names
+// unix, dos and mac are accepted too.
+func Parse(name string) (Style, error) {
+	switch name {
+	case "lf", "unix":
+		return LF, nil
+	case "crlf", "dos":
+		return CRLF, nil
+	case "cr", "mac":
+		return CR, nil
+	}
+	return LF, fmt.Errorf("unknown line ending %q", name)
+}
+
+// Detect returns the line ending convention of p, typically the start
+// of a file. Text is only considered CRLF if every \n is preceded by a
+// \r, and CR if it has \r but no \n at all. Anything else, including
+// mixed line endings, is LF so the text is loaded unchanged.
+func Detect(p []byte) Style {
+	lf := bytes.Count(p, []byte("\n"))
+	switch {
+	case lf > 0 && bytes.Count(p, []byte("\r\n")) == lf:
+		return CRLF
+	case lf == 0 && bytes.IndexByte(p, '\r') >= 0:
+		return CR
+	}
+	return LF
+}
+
+// NewReader returns a reader that converts text from r with line endings
+// in style s to \n line endings. Bytes that aren't part of a line ending
+// are passed through unchanged, so a lone \r in CRLF text is kept.
+func NewReader(r io.Reader, s Style) io.Reader {
+	if s == LF {
+		return r
+	}
+	return &reader{
+		r:     r,
+		style: s,
+		in:    make([]byte, 32<<10),
+	}
+}
+
+type reader struct {
+	r     io.Reader
+	style Style
+	in    []byte
+	out   []byte
+	// pending is converted text that hasn't been read yet
+	pending []byte
+	// cr is set if the last byte read from r was a \r that might start
+	// a \r\n
+	cr  bool
+	err error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.r.Read(r.in)
+		r.err = err
+		r.pending = r.convert(r.in[:n])
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *reader) convert(p []byte) []byte {
+	out := r.out[:0]
+	if r.style == CR {
+		for _, c := range p {
+			if c == '\r' {
+				c = '\n'
+			}
+			out = append(out, c)
+		}
+		r.out = out
+		return out
+	}
+
+	for _, c := range p {
+		if r.cr {
+			r.cr = false
+			if c == '\n' {
+				out = append(out, '\n')
+				continue
+			}
+			out = append(out, '\r')
+		}
+		if c == '\r' {
+			r.cr = true
+			continue
+		}
+		out = append(out, c)
+	}
+	if r.cr && r.err != nil {
+		// the file ends with a \r
+		r.cr = false
+		out = append(out, '\r')
+	}
+	r.out = out
+	return out
+}
+
+// NewWriter returns a writer that converts the \n line endings of text
+// written to it to style s before writing it to w.
+func NewWriter(w io.Writer, s Style) io.Writer {
+	if s == LF {
+		return w
+	}
+	return &writer{w: w, style: s}
+}
+
+type writer struct {
+	w     io.Writer
+	style Style
+	buf   []byte
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), 32<<10)]
+
+		out := w.buf[:0]
+		for _, c := range chunk {
+			switch {
+			case c != '\n':
+				out = append(out, c)
+			case w.style == CR:
+				out = append(out, '\r')
+			default:
+				out = append(out, '\r', '\n')
+			}
+		}
+		w.buf = out
+
+		if _, err := w.w.Write(out); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,89 @@
+package eol
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDetect(t *testing.T) {
+	checks := []struct {
+		text   string
+		expect Style
+	}{
+		{"", LF},
+		{"no newline", LF},
+		{"one\ntwo\n", LF},
+		{"one\r\ntwo\r\n", CRLF},
+		{"one\r\ntwo", CRLF},
+		{"one\rtwo\r", CR},
+		{"one\r\ntwo\n", LF},
+		{"one\rtwo\n", LF},
+		{"a\rb\r\nc\r\n", CRLF},
+	}
+
+	for _, check := range checks {
+		if got := Detect([]byte(check.text)); got != check.expect {
+			t.Errorf("Detect(%q) got %s expected %s", check.text, got, check.expect)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	checks := []struct {
+		style Style
+		text  string
+		lf    string
+	}{
+		{CRLF, "one\r\ntwo\r\n", "one\ntwo\n"},
+		{CRLF, "one\r\ntwo", "one\ntwo"},
+		{CRLF, "a\rb\r\r\nc\r", "a\rb\r\nc\r"},
+		{CRLF, "\r\n\r\n", "\n\n"},
+		{CR, "one\rtwo\r", "one\ntwo\n"},
+		{LF, "one\r\ntwo\n", "one\r\ntwo\n"},
+	}
+
+	for _, check := range checks {
+		readers := map[string]io.Reader{
+			"whole":    strings.NewReader(check.text),
+			"one byte": iotest.OneByteReader(strings.NewReader(check.text)),
+			"data err": iotest.DataErrReader(strings.NewReader(check.text)),
+		}
+		for name, r := range readers {
+			got, err := io.ReadAll(NewReader(r, check.style))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != check.lf {
+				t.Errorf("%s %s read %q got %q expected %q", check.style, name, check.text, got, check.lf)
+			}
+		}
+
+		var buf bytes.Buffer
+		w := NewWriter(&buf, check.style)
+		n, err := w.Write([]byte(check.lf))
+		if err != nil || n != len(check.lf) {
+			t.Fatalf("Write got %d, %v", n, err)
+		}
+		if buf.String() != check.text {
+			t.Errorf("%s write %q got %q expected %q", check.style, check.lf, buf.String(), check.text)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []Style{LF, CRLF, CR} {
+		got, err := Parse(s.String())
+		if err != nil || got != s {
+			t.Errorf("Parse(%q) got %s, %v", s.String(), got, err)
+		}
+	}
+	if got, _ := Parse("dos"); got != CRLF {
+		t.Errorf("Parse(dos) got %s", got)
+	}
+	if _, err := Parse("ebcdic"); err == nil {
+		t.Errorf("Parse(ebcdic) expected an error")
+	}
+}
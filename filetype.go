@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// fileType holds the settings for editing a kind of file.
+type fileType struct {
+	name string
+	// indent is one level of indentation
+	indent string
+	// indentAfter lists the characters that open a deeper level of
+	// indentation when they end a line
+	indentAfter string
+	// save are the edits made to files of this type when they are
+	// saved with -tidy
+	save saveOptions
+	// formatter is the command the text is piped through when it is
+	// saved with -format, see editor.format
+	formatter []string
+}
+
+var (
+	// with -tidy source code gets tidied up when it is saved, other
+	// text is written out as it is
+	tidyCode = saveOptions{
+		trimTrailingWhitespace: true,
+		finalNewline:           true,
+		normalizeLineEndings:   true,
+	}
+
+	textType   = fileType{name: "text", indent: "\t"}
+	goType     = fileType{name: "go", indent: "\t", indentAfter: "{([", save: tidyCode, formatter: []string{"gofmt"}}
+	cType      = fileType{name: "c", indent: "    ", indentAfter: "{([", save: tidyCode}
+	jsType     = fileType{name: "javascript", indent: "  ", indentAfter: "{([", save: tidyCode}
+	jsonType   = fileType{name: "json", indent: "  ", indentAfter: "{[", save: tidyCode, formatter: []string{"jq", "."}}
+	pythonType = fileType{name: "python", indent: "    ", indentAfter: ":{([", save: tidyCode}
+	yamlType   = fileType{name: "yaml", indent: "  ", indentAfter: ":", save: tidyCode}
+	shellType  = fileType{name: "shell", indent: "  ", indentAfter: "{(", save: tidyCode, formatter: []string{"shfmt"}}
+	makeType   = fileType{name: "make", indent: "\t", indentAfter: ":", save: tidyCode}
+)
+
+var fileTypesByExt = map[string]fileType{
+	".go":   goType,
+	".c":    cType,
+	".h":    cType,
+	".cc":   cType,
+	".cpp":  cType,
+	".hpp":  cType,
+	".java": cType,
+	".rs":   cType,
+	".js":   jsType,
+	".ts":   jsType,
+	".jsx":  jsType,
+	".tsx":  jsType,
+	".json": jsonType,
+	".py":   pythonType,
+	".yaml": yamlType,
+	".yml":  yamlType,
+	".sh":   shellType,
+	".bash": shellType,
+	".mk":   makeType,
+}
+
+var fileTypesByName = map[string]fileType{
+	"Makefile":    makeType,
+	"makefile":    makeType,
+	"GNUmakefile": makeType,
+}
+
+// detectFileType returns the type of the file called filename, going by
+// its name.
+func detectFileType(filename string) fileType {
+	base := filepath.Base(filename)
+	if ft, ok := fileTypesByName[base]; ok {
+		return ft
+	}
+	if ft, ok := fileTypesByExt[strings.ToLower(filepath.Ext(base))]; ok {
+		return ft
+	}
+	return textType
+}
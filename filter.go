@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// shellTimeout is how long a shell command may run before it is killed.
+const shellTimeout = 10 * time.Second
+
+// filterSelection pipes the selection, or the whole buffer if nothing is
+// selected, through the shell command cmdline and replaces it with the
+// command's output.
+func (ed *editor) filterSelection(cmdline string) error {
+	start, end, ok := ed.disp.Selection()
+	if !ok || start == end {
+		return ed.filterRange(0, ed.buf.Size(), cmdline)
+	}
+	return ed.filterRange(start, end, cmdline)
+}
+
+// filterRange replaces [start, end) with the output of the shell command
+// cmdline run with that text on its stdin. If the command fails the
+// buffer is left alone and the error holds what it wrote to stderr.
+func (ed *editor) filterRange(start, end int, cmdline string) error {
+	out, err := ed.runShell(cmdline, ed.buf.Bytes(start, end))
+	if err != nil {
+		return err
+	}
+
+	off, _ := ed.buf.Seek(0, io.SeekCurrent)
+	cursor := start
+	if start == 0 && end == ed.buf.Size() {
+		// keep the cursor on the same line of the new text
+		line, col := ed.buf.LineRuneCol(int(off))
+		cursor = lineRuneColOffset(out, line, col)
+	}
+
+	ed.disp.ClearSelection()
+	ed.mouseSelection = false
+	ed.disp.Replace(start, end, out, cursor)
+	return nil
+}
+
+// insertCommandOutput inserts the output of the shell command cmdline at
+// the cursor.
+func (ed *editor) insertCommandOutput(cmdline string) error {
+	out, err := ed.runShell(cmdline, nil)
+	if err != nil {
+		return err
+	}
+
+	off, _ := ed.buf.Seek(0, io.SeekCurrent)
+	ed.disp.Replace(int(off), int(off), out, int(off)+len(out))
+	return nil
+}
+
+// runShell runs cmdline with the user's shell, with input on its stdin,
+// and returns what it writes to stdout. The terminal is out of raw mode
+// while it runs, and redrawn afterwards in case the command used it. It
+// is killed if it runs for longer than shellTimeout.
+func (ed *editor) runShell(cmdline string, input []byte) ([]byte, error) {
+	cmdline = strings.TrimSpace(cmdline)
+	if cmdline == "" {
+		return nil, errors.New("No command")
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shellTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, shell, "-c", cmdline)
+	c.Stdin = bytes.NewReader(input)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	// children of the shell may keep its output open after it is killed
+	c.WaitDelay = time.Second
+
+	ed.shellRunning.Store(true)
+	ed.vt100.Suspend()
+	err := c.Run()
+	ed.vt100.Resume()
+	ed.shellRunning.Store(false)
+	ed.disp.Redraw()
+
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) || msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("%s: %s", cmdline, msg)
+	}
+	return stdout.Bytes(), nil
+}
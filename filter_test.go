@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterRange(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		start     int
+		end       int
+		cmd       string
+		expect    string
+		expectErr string
+	}{
+		{
+			name:   "cat keeps the text",
+			input:  "abc\ndef\n",
+			start:  0,
+			end:    8,
+			cmd:    "cat",
+			expect: "abc\ndef\n",
+		},
+		{
+			name:   "Whole buffer",
+			input:  "abc\ndef\n",
+			start:  0,
+			end:    8,
+			cmd:    "tr a-z A-Z",
+			expect: "ABC\nDEF\n",
+		},
+		{
+			name:   "Part of the buffer",
+			input:  "abc\ndef\nghi\n",
+			start:  4,
+			end:    8,
+			cmd:    "tr a-z A-Z",
+			expect: "abc\nDEF\nghi\n",
+		},
+		{
+			name:   "Output of a different length",
+			input:  "abc\ndef\nghi\n",
+			start:  4,
+			end:    8,
+			cmd:    "tr -d e",
+			expect: "abc\ndf\nghi\n",
+		},
+		{
+			name:      "Failure leaves the buffer alone",
+			input:     "abc\ndef\n",
+			start:     0,
+			end:       8,
+			cmd:       "false",
+			expect:    "abc\ndef\n",
+			expectErr: "false: exit status 1",
+		},
+		{
+			name:      "Failure shows stderr",
+			input:     "abc\ndef\n",
+			start:     4,
+			end:       8,
+			cmd:       "tr",
+			expect:    "abc\ndef\n",
+			expectErr: "tr: ",
+		},
+		{
+			name:      "No command",
+			input:     "abc\n",
+			start:     0,
+			end:       4,
+			cmd:       "  ",
+			expect:    "abc\n",
+			expectErr: "No command",
+		},
+	}
+
+	t.Setenv("SHELL", "/bin/sh")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := newTestEditor(t, tc.input)
+
+			err := ed.filterRange(tc.start, tc.end, tc.cmd)
+			if tc.expectErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tc.expectErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectErr)) {
+				t.Fatalf("got error %v expected one containing %q", err, tc.expectErr)
+			}
+
+			if got := ed.text(); got != tc.expect {
+				t.Errorf("got text %q expected %q", got, tc.expect)
+			}
+		})
+	}
+}
+
+func TestInsertCommandOutput(t *testing.T) {
+	testCases := []struct {
+		name         string
+		input        string
+		cursor       int
+		cmd          string
+		expect       string
+		expectCursor int
+		expectErr    string
+	}{
+		{
+			name:         "Inserted at the cursor",
+			input:        "abcd",
+			cursor:       2,
+			cmd:          "echo hi | tr a-z A-Z",
+			expect:       "abHI\ncd",
+			expectCursor: 5,
+		},
+		{
+			name:         "cat gets no input",
+			input:        "abcd",
+			cursor:       2,
+			cmd:          "cat",
+			expect:       "abcd",
+			expectCursor: 2,
+		},
+		{
+			name:         "Failure leaves the buffer alone",
+			input:        "abcd",
+			cursor:       2,
+			cmd:          "false",
+			expect:       "abcd",
+			expectCursor: 2,
+			expectErr:    "false: exit status 1",
+		},
+	}
+
+	t.Setenv("SHELL", "/bin/sh")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := newTestEditor(t, tc.input)
+			ed.disp.MvTo(tc.cursor)
+
+			err := ed.insertCommandOutput(tc.cmd)
+			if tc.expectErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tc.expectErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectErr)) {
+				t.Fatalf("got error %v expected one containing %q", err, tc.expectErr)
+			}
+
+			if got := ed.text(); got != tc.expect {
+				t.Errorf("got text %q expected %q", got, tc.expect)
+			}
+			if got := ed.disp.Offset(); got != tc.expectCursor {
+				t.Errorf("got cursor %d expected %d", got, tc.expectCursor)
+			}
+		})
+	}
+}
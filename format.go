@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// formatTimeout is how long a formatter may take before we give up on
+// it.
+const formatTimeout = 10 * time.Second
+
+// format pipes the buffer through the file type's formatter and
+// replaces the text with its output, keeping the cursor on the same
+// line. If the formatter fails the buffer is left alone and the error
+// holds what it wrote to stderr. Formatters that aren't installed are
+// skipped.
+func (ed *editor) format() error {
+	cmd := ed.formatter
+	if len(cmd) == 0 || ed.binary || ed.largeFile {
+		return nil
+	}
+	if _, err := exec.LookPath(cmd[0]); err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), formatTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Stdin = bytes.NewReader(ed.buf.Bytes(0, ed.buf.Size()))
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) || msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("%s: %s", strings.Join(cmd, " "), msg)
+	}
+
+	text := stdout.Bytes()
+	if bytes.Equal(text, ed.buf.Bytes(0, ed.buf.Size())) {
+		return nil
+	}
+
+	off, _ := ed.buf.Seek(0, io.SeekCurrent)
+	line, col := ed.buf.LineRuneCol(int(off))
+	cursor := lineRuneColOffset(text, line, col)
+
+	if ed.disp != nil && !ed.done {
+		ed.disp.Replace(0, ed.buf.Size(), text, cursor)
+		return nil
+	}
+	ed.buf.DeleteRange(0, ed.buf.Size())
+	ed.buf.Insert(text)
+	ed.buf.Seek(int64(cursor), io.SeekStart)
+	return nil
+}
+
+// lineRuneColOffset returns the offset of the rune column col of the
+// zero based line in text, clamping both to the text.
+func lineRuneColOffset(text []byte, line, col int) int {
+	start := 0
+	for ; line > 0; line-- {
+		i := bytes.IndexByte(text[start:], '\n')
+		if i < 0 {
+			break
+		}
+		start += i + 1
+	}
+
+	off := start
+	for ; col > 0 && off < len(text) && text[off] != '\n'; col-- {
+		_, size := utf8.DecodeRune(text[off:])
+		off += size
+	}
+	return off
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	testCases := []struct {
+		name      string
+		formatter []string
+		input     string
+		// done is set to format the way it happens after run returns
+		done bool
+		// line and rune column of the cursor before and after
+		cursor       [2]int
+		expect       string
+		expectCursor [2]int
+		expectErr    string
+	}{
+		{
+			name:         "Same line and column",
+			formatter:    []string{"tr", "a-z", "A-Z"},
+			input:        "ab\ncdef\nghi\n",
+			cursor:       [2]int{1, 2},
+			expect:       "AB\nCDEF\nGHI\n",
+			expectCursor: [2]int{1, 2},
+		},
+		{
+			name:         "Column clamped to a shorter line",
+			formatter:    []string{"sed", "s/cdef/c/"},
+			input:        "ab\ncdef\nghi\n",
+			cursor:       [2]int{1, 3},
+			expect:       "ab\nc\nghi\n",
+			expectCursor: [2]int{1, 1},
+		},
+		{
+			name:         "Line clamped to shorter text",
+			formatter:    []string{"head", "-n", "1"},
+			input:        "ab\ncdef\nghi\n",
+			cursor:       [2]int{2, 1},
+			expect:       "ab\n",
+			expectCursor: [2]int{1, 0},
+		},
+		{
+			name:         "Multibyte column",
+			formatter:    []string{"sed", "s/x/y/"},
+			input:        "x\n☃☃☃x\n",
+			cursor:       [2]int{1, 2},
+			expect:       "y\n☃☃☃y\n",
+			expectCursor: [2]int{1, 2},
+		},
+		{
+			name:         "After exit",
+			formatter:    []string{"tr", "a-z", "A-Z"},
+			input:        "ab\ncdef\n",
+			done:         true,
+			cursor:       [2]int{1, 2},
+			expect:       "AB\nCDEF\n",
+			expectCursor: [2]int{1, 2},
+		},
+		{
+			name:         "Failure leaves the buffer alone",
+			formatter:    []string{"sh", "-c", "echo 'line 2: syntax error' >&2; exit 1"},
+			input:        "ab\ncdef\n",
+			cursor:       [2]int{1, 2},
+			expect:       "ab\ncdef\n",
+			expectCursor: [2]int{1, 2},
+			expectErr:    "line 2: syntax error",
+		},
+		{
+			name:         "Not installed",
+			formatter:    []string{"hat-no-such-formatter"},
+			input:        "ab\ncdef\n",
+			cursor:       [2]int{1, 2},
+			expect:       "ab\ncdef\n",
+			expectCursor: [2]int{1, 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := newTestEditor(t, tc.input)
+			ed.formatter = tc.formatter
+			ed.disp.MvTo(ed.buf.LineRuneColOffset(tc.cursor[0], tc.cursor[1]))
+			ed.done = tc.done
+
+			err := ed.format()
+			if tc.expectErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tc.expectErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectErr)) {
+				t.Fatalf("got error %v expected one containing %q", err, tc.expectErr)
+			}
+
+			if got := ed.text(); got != tc.expect {
+				t.Errorf("got text %q expected %q", got, tc.expect)
+			}
+			if line, col := ed.cursorLineCol(); [2]int{line, col} != tc.expectCursor {
+				t.Errorf("got cursor %d:%d expected %d:%d", line, col, tc.expectCursor[0], tc.expectCursor[1])
+			}
+		})
+	}
+}
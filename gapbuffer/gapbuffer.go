@@ -9,9 +9,14 @@ package gapbuffer
 // for each move.
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/psanford/hat/textbuffer"
 )
 
 type GapBuffer struct {
@@ -19,6 +24,22 @@ type GapBuffer struct {
 	frontSize int64
 	backSize  int64
 
+	// The newline index mirrors the gap: frontLines holds the offsets of
+	// the newlines before the gap in ascending order. backLines holds the
+	// newlines after the gap as distances from the end of the buffer,
+	// with the one nearest the gap last. That way inserts and deletes
+	// only touch the end of frontLines and moving the gap only moves the
+	// newlines that cross it.
+	frontLines []int
+	backLines  []int
+
+	anchors   textbuffer.Anchors
+	listeners textbuffer.Listeners
+
+	// shared is set while a snapshot may be reading buf. The next write
+	// to buf copies it first.
+	shared bool
+
 	// XXX remove
 	Debug io.Writer
 }
@@ -72,9 +93,13 @@ func (b *GapBuffer) Insert(p []byte) (int, error) {
 	if len(p) > b.gapSize() {
 		b.grow(len(p))
 	}
+	b.unshare()
 
 	copy(b.buf[b.frontSize:], p)
+	b.indexNewlines(p, int(b.frontSize))
+	b.anchors.Inserted(int(b.frontSize), len(p))
 	b.frontSize += int64(len(p))
+	b.inserted(int(b.frontSize)-len(p), int(b.frontSize))
 
 	return len(p), nil
 }
@@ -85,7 +110,73 @@ func (b *GapBuffer) Delete(n int) []byte {
 	}
 
 	b.frontSize -= int64(n)
+	b.anchors.Deleted(int(b.frontSize), int(b.frontSize)+n)
+	for len(b.frontLines) > 0 && b.frontLines[len(b.frontLines)-1] >= int(b.frontSize) {
+		b.frontLines = b.frontLines[:len(b.frontLines)-1]
+	}
+
 	out := b.buf[b.frontSize : b.frontSize+int64(n)]
+	b.deleted(int(b.frontSize), out, int(b.frontSize)+n)
+	return out
+}
+
+// DeleteForward removes up to n bytes after the cursor and returns them.
+// The returned slice is only valid until the next modification.
+func (b *GapBuffer) DeleteForward(n int) []byte {
+	return b.deleteForward(n, int(b.frontSize))
+}
+
+// deleteForward is DeleteForward for a change that started with the
+// cursor at cursorBefore.
+func (b *GapBuffer) deleteForward(n, cursorBefore int) []byte {
+	if n > int(b.backSize) {
+		n = int(b.backSize)
+	}
+
+	start := len(b.buf) - int(b.backSize)
+	b.backSize -= int64(n)
+	b.anchors.Deleted(int(b.frontSize), int(b.frontSize)+n)
+	for len(b.backLines) > 0 && b.backLines[len(b.backLines)-1] > int(b.backSize) {
+		b.backLines = b.backLines[:len(b.backLines)-1]
+	}
+
+	out := b.buf[start : start+n]
+	b.deleted(int(b.frontSize), out, cursorBefore)
+	return out
+}
+
+// DeleteRange removes the bytes in [start, end) and leaves the cursor at
+// start.
+func (b *GapBuffer) DeleteRange(start, end int) []byte {
+	start, end = b.clampOffset(start), b.clampOffset(end)
+	if start > end {
+		start, end = end, start
+	}
+	cursor := int(b.frontSize)
+	b.Seek(int64(start), io.SeekStart)
+	return b.deleteForward(end-start, cursor)
+}
+
+// Bytes returns the bytes in [start, end). If the range doesn't span the
+// gap the returned slice aliases the buffer and is only valid until the
+// next modification, otherwise it is a copy.
+func (b *GapBuffer) Bytes(start, end int) []byte {
+	start, end = b.clampOffset(start), b.clampOffset(end)
+	if start > end {
+		start, end = end, start
+	}
+
+	front := int(b.frontSize)
+	switch {
+	case end <= front:
+		return b.buf[start:end]
+	case start >= front:
+		gap := b.gapSize()
+		return b.buf[start+gap : end+gap]
+	}
+
+	out := make([]byte, end-start)
+	b.ReadAt(out, int64(start))
 	return out
 }
 
@@ -94,7 +185,10 @@ func (b *GapBuffer) ReadAt(p []byte, off int64) (int, error) {
 	tailOffset := 0
 	var tailP []byte
 
-	if tailOffset > int(b.frontSize+b.backSize) {
+	if off < 0 {
+		return 0, errors.New("GapBuffer.ReadAt: negative offset")
+	}
+	if off > b.frontSize+b.backSize {
 		return 0, io.EOF
 	}
 
@@ -128,34 +222,165 @@ func (b *GapBuffer) Read(p []byte) (int, error) {
 	return n, err
 }
 
-// searchFor searches forward for the first occurrence of c
-// starting at fromOffset (inclusive).
-func (b *GapBuffer) searchFor(c byte, fromOffset int) int {
-	buf := make([]byte, 1)
+// ReadRune reads the rune after the cursor and advances past it.
+// Invalid UTF-8 is returned as utf8.RuneError with a size of 1.
+func (b *GapBuffer) ReadRune() (r rune, size int, err error) {
+	if b.backSize == 0 {
+		return 0, 0, io.EOF
+	}
+	start := len(b.buf) - int(b.backSize)
+	r, size = utf8.DecodeRune(b.buf[start:])
+	b.moveCursor(int64(size))
+	return r, size, nil
+}
 
-	for i := int64(fromOffset); i < b.frontSize+b.backSize; i++ {
-		b.ReadAt(buf, int64(i))
-		if buf[0] == c {
-			return int(i)
-		}
+// UnreadRune moves the cursor back over the rune before it. Unlike most
+// io.RuneScanners it doesn't need a preceding ReadRune, so it can be
+// used to walk the buffer backwards.
+func (b *GapBuffer) UnreadRune() error {
+	_, size, err := b.PrevRune()
+	if err != nil {
+		return err
 	}
+	b.moveCursor(int64(-size))
+	return nil
+}
 
-	return -1
+// PrevRune returns the rune before the cursor without moving it.
+func (b *GapBuffer) PrevRune() (r rune, size int, err error) {
+	if b.frontSize == 0 {
+		return 0, 0, io.EOF
+	}
+	r, size = utf8.DecodeLastRune(b.buf[:b.frontSize])
+	return r, size, nil
 }
 
-// searchBackFor searches backwards for the first occurrence of c
-// starting at fromOffset-1. If no match is found returns -1.
-func (b *GapBuffer) searchBackFor(c byte, fromOffset int) int {
-	buf := make([]byte, 1)
+// WriteTo writes the whole buffer to w, independent of the cursor.
+func (b *GapBuffer) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(b.buf[:b.frontSize])
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(b.buf[len(b.buf)-int(b.backSize):])
+	return int64(n + m), err
+}
 
-	for i := fromOffset - 1; i >= 0; i-- {
-		b.ReadAt(buf, int64(i))
-		if buf[0] == c {
-			return i
+// ReadFrom inserts everything read from r at the cursor, reading
+// directly into the gap.
+func (b *GapBuffer) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	defer func() {
+		b.inserted(int(b.frontSize)-int(total), int(b.frontSize))
+	}()
+	for {
+		if b.gapSize() < 512 {
+			b.grow(max(512, int(b.Size())))
+		}
+		b.unshare()
+
+		n, err := r.Read(b.buf[b.frontSize : len(b.buf)-int(b.backSize)])
+		if n > 0 {
+			b.indexNewlines(b.buf[b.frontSize:b.frontSize+int64(n)], int(b.frontSize))
+			b.anchors.Inserted(int(b.frontSize), n)
+			b.frontSize += int64(n)
+			total += int64(n)
 		}
+		if err == io.EOF {
+			return total, nil
+		} else if err != nil {
+			return total, err
+		}
+	}
+}
+
+// NewAnchor returns an anchor at offset that is kept up to date as the
+// buffer is edited.
+func (b *GapBuffer) NewAnchor(offset int, g textbuffer.Gravity) *textbuffer.Anchor {
+	return b.anchors.NewAnchor(b.clampOffset(offset), g)
+}
+
+// RemoveAnchor stops updating a.
+func (b *GapBuffer) RemoveAnchor(a *textbuffer.Anchor) {
+	b.anchors.RemoveAnchor(a)
+}
+
+// Snapshot returns a read only copy of the buffer. Taking it is cheap,
+// the text is only copied by the next edit or cursor movement.
+func (b *GapBuffer) Snapshot() *textbuffer.Snapshot {
+	b.shared = true
+	s := &snapshot{
+		front: b.buf[:b.frontSize:b.frontSize],
+		back:  b.buf[len(b.buf)-int(b.backSize):],
+	}
+	return textbuffer.NewSnapshot(s, b.Size())
+}
+
+// snapshot reads the text either side of the gap as it was when the
+// snapshot was taken.
+type snapshot struct {
+	front, back []byte
+}
+
+func (s *snapshot) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	if off < int64(len(s.front)) {
+		n = copy(p, s.front[off:])
+		off = int64(len(s.front))
+	}
+	off -= int64(len(s.front))
+	if off < int64(len(s.back)) {
+		n += copy(p[n:], s.back[off:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Listen registers f to be called after every edit to the buffer.
+func (b *GapBuffer) Listen(f func(textbuffer.Change)) (cancel func()) {
+	return b.listeners.Listen(f)
+}
+
+// Edits returns the number of edits made to the buffer.
+func (b *GapBuffer) Edits() int {
+	return b.listeners.Edits()
+}
+
+// inserted notifies listeners of the text in [start, end) that was just
+// inserted, leaving the cursor at end.
+func (b *GapBuffer) inserted(start, end int) {
+	if start == end {
+		return
 	}
+	b.listeners.Edited()
+	if !b.listeners.Active() {
+		return
+	}
+	b.listeners.Notify(textbuffer.Change{
+		Offset:       start,
+		Inserted:     bytes.Clone(b.buf[start:end]),
+		CursorBefore: start,
+		CursorAfter:  end,
+	})
+}
 
-	return -1
+// deleted notifies listeners that removed was just deleted at the
+// cursor.
+func (b *GapBuffer) deleted(off int, removed []byte, cursorBefore int) {
+	if len(removed) == 0 {
+		return
+	}
+	b.listeners.Edited()
+	if !b.listeners.Active() {
+		return
+	}
+	b.listeners.Notify(textbuffer.Change{
+		Offset:       off,
+		Removed:      bytes.Clone(removed),
+		CursorBefore: cursorBefore,
+		CursorAfter:  off,
+	})
 }
 
 // GetLine returns the start and end of the nth line relative to the current position.
@@ -169,73 +394,181 @@ func (b *GapBuffer) GetLine(offset int) (startPos, endPos int) {
 		}
 	}()
 
-	pos := b.frontSize
+	// every newline in front of the gap ends a line before ours
+	line := len(b.frontLines) + offset
+	if line < 0 || line > b.newlineCount() {
+		return -1, -1
+	}
 
-	b.debugPrintf("gb: frontSize: %d\n", pos)
+	start := b.lineStart(line)
+	if line < b.newlineCount() {
+		return start, b.newlinePos(line)
+	}
 
-	if offset == 0 {
-		start := b.searchBackFor('\n', int(pos)) + 1
-		end := b.searchFor('\n', int(pos))
+	// the final line has no newline
+	if offset > 0 {
+		return start, b.Size()
+	}
+	end := b.Size() - 1
+	if start == end+1 {
+		end = start
+	}
+	return start, end
+}
 
-		if end == -1 {
-			end = int(b.frontSize + b.backSize - 1)
-			if start == end+1 {
-				end = start
-			}
-		}
-		return start, end
-	} else if offset < 0 {
-		// looking back
-		newLineCount := 0 - offset
-
-		cur := int(pos)
-		end := b.searchFor('\n', cur)
-		if end == -1 {
-			end = int(b.frontSize + b.backSize - 1)
-		}
+// LineCount returns the number of lines in the buffer. A trailing
+// newline starts a final empty line.
+func (b *GapBuffer) LineCount() int {
+	return b.newlineCount() + 1
+}
 
-		for i := 0; i < newLineCount; i++ {
-			nl := b.searchBackFor('\n', cur)
-			if nl == -1 {
-				return -1, -1
-			} else {
-				end = cur
-				cur = nl
-			}
-		}
+// LineAt returns the zero based line number containing offset.
+func (b *GapBuffer) LineAt(offset int) int {
+	return sort.Search(b.newlineCount(), func(i int) bool {
+		return b.newlinePos(i) >= offset
+	})
+}
 
-		// search back one more to find the start of the current line
-		nl := b.searchBackFor('\n', cur)
-		return nl + 1, cur
-	} else {
-		// looking forward
-		newLineCount := offset + 1
-		cur := int(pos)
+// LineStart returns the offset of the start of the zero based line, or
+// -1 if the buffer doesn't have that many lines.
+func (b *GapBuffer) LineStart(line int) int {
+	if line < 0 || line > b.newlineCount() {
+		return -1
+	}
+	return b.lineStart(line)
+}
+
+// LineEnd returns the offset of the newline ending the zero based line,
+// or the size of the buffer for the last line. It returns -1 if the
+// buffer doesn't have that many lines.
+func (b *GapBuffer) LineEnd(line int) int {
+	if line < 0 || line > b.newlineCount() {
+		return -1
+	}
+	if line == b.newlineCount() {
+		return b.Size()
+	}
+	return b.newlinePos(line)
+}
 
-		start := b.searchBackFor('\n', cur+1) + 1
+// LineCol returns the zero based line and byte column of offset.
+func (b *GapBuffer) LineCol(offset int) (line, col int) {
+	offset = b.clampOffset(offset)
+	line = b.LineAt(offset)
+	return line, offset - b.lineStart(line)
+}
 
-		if start == cur+1 {
-			// if we are starting on a new line that means we need to look for one less
-			// newline than normal
-			newLineCount--
-		}
+// LineRuneCol returns the zero based line and rune column of offset.
+func (b *GapBuffer) LineRuneCol(offset int) (line, col int) {
+	offset = b.clampOffset(offset)
+	line = b.LineAt(offset)
+	start := b.lineStart(line)
 
-		for i := 0; i < newLineCount; i++ {
-			nl := b.searchFor('\n', cur+1)
-			if nl == -1 {
-				if i == newLineCount-1 {
-					// we're on the last line and there's no newline
-					return cur + 1, b.Size()
-				}
-				return -1, -1
-			} else {
-				start = cur + 1
-				cur = nl
-			}
+	p := make([]byte, offset-start)
+	b.ReadAt(p, int64(start))
+	return line, utf8.RuneCount(p)
+}
+
+// LineColOffset returns the offset of byte column col of the zero based
+// line. Lines past the end of the buffer are clamped to the last line and
+// columns past the end of the line to the end of the line.
+func (b *GapBuffer) LineColOffset(line, col int) int {
+	line = b.clampLine(line)
+	start, end := b.lineStart(line), b.LineEnd(line)
+	if col < 0 {
+		col = 0
+	}
+	if start+col > end {
+		return end
+	}
+	return start + col
+}
+
+// LineRuneColOffset is LineColOffset with a rune column instead of a
+// byte column.
+func (b *GapBuffer) LineRuneColOffset(line, col int) int {
+	line = b.clampLine(line)
+	start, end := b.lineStart(line), b.LineEnd(line)
+
+	p := make([]byte, end-start)
+	b.ReadAt(p, int64(start))
+
+	off := start
+	for i := 0; i < col && len(p) > 0; i++ {
+		_, size := utf8.DecodeRune(p)
+		p = p[size:]
+		off += size
+	}
+	return off
+}
+
+// SeekLine moves the cursor to the start of the zero based line. Lines
+// past the end of the buffer move to the last line.
+func (b *GapBuffer) SeekLine(line int) (int64, error) {
+	return b.SeekLineCol(line, 0)
+}
+
+// SeekLineCol moves the cursor to byte column col of the zero based
+// line, clamped as in LineColOffset.
+func (b *GapBuffer) SeekLineCol(line, col int) (int64, error) {
+	if line < 0 {
+		return 0, errors.New("GapBuffer.SeekLine: negative line")
+	}
+	return b.Seek(int64(b.LineColOffset(line, col)), io.SeekStart)
+}
+
+func (b *GapBuffer) clampLine(line int) int {
+	if line < 0 {
+		return 0
+	}
+	if line > b.newlineCount() {
+		return b.newlineCount()
+	}
+	return line
+}
+
+func (b *GapBuffer) clampOffset(offset int) int {
+	if offset < 0 {
+		return 0
+	}
+	if offset > b.Size() {
+		return b.Size()
+	}
+	return offset
+}
+
+// indexNewlines adds the newlines in p, which is being inserted at off,
+// to frontLines.
+func (b *GapBuffer) indexNewlines(p []byte, off int) {
+	for i := 0; ; {
+		nl := bytes.IndexByte(p[i:], '\n')
+		if nl < 0 {
+			return
 		}
+		b.frontLines = append(b.frontLines, off+i+nl)
+		i += nl + 1
+	}
+}
+
+func (b *GapBuffer) newlineCount() int {
+	return len(b.frontLines) + len(b.backLines)
+}
 
-		return start, cur
+// newlinePos returns the offset of the ith newline in the buffer.
+func (b *GapBuffer) newlinePos(i int) int {
+	if i < len(b.frontLines) {
+		return b.frontLines[i]
 	}
+	i -= len(b.frontLines)
+	return b.Size() - b.backLines[len(b.backLines)-1-i]
+}
+
+// lineStart returns the offset of the start of the zero based line.
+func (b *GapBuffer) lineStart(line int) int {
+	if line == 0 {
+		return 0
+	}
+	return b.newlinePos(line-1) + 1
 }
 
 func (b *GapBuffer) Size() int {
@@ -253,6 +586,14 @@ func (b *GapBuffer) grow(minExpansion int) {
 	copy(newBuf[0:], b.buf[:b.frontSize])
 	copy(newBuf[len(newBuf)-int(b.backSize):], b.buf[len(b.buf)-int(b.backSize):])
 	b.buf = newBuf
+	b.shared = false
+}
+
+// unshare copies buf if a snapshot might be reading it.
+func (b *GapBuffer) unshare() {
+	if b.shared {
+		b.grow(0)
+	}
 }
 
 func (b *GapBuffer) gapSize() int {
@@ -260,6 +601,11 @@ func (b *GapBuffer) gapSize() int {
 }
 
 func (b *GapBuffer) moveCursor(relative int64) {
+	if relative == 0 {
+		return
+	}
+	b.unshare()
+
 	newFront := b.frontSize + relative
 	newBack := b.backSize - relative
 	if relative < 0 {
@@ -268,6 +614,24 @@ func (b *GapBuffer) moveCursor(relative int64) {
 		copy(b.buf[b.frontSize:], b.buf[len(b.buf)-int(b.backSize):len(b.buf)-int(newBack)])
 	}
 
+	size := b.Size()
+	if relative < 0 {
+		for len(b.frontLines) > 0 && b.frontLines[len(b.frontLines)-1] >= int(newFront) {
+			pos := b.frontLines[len(b.frontLines)-1]
+			b.frontLines = b.frontLines[:len(b.frontLines)-1]
+			b.backLines = append(b.backLines, size-pos)
+		}
+	} else {
+		for len(b.backLines) > 0 {
+			pos := size - b.backLines[len(b.backLines)-1]
+			if pos >= int(newFront) {
+				break
+			}
+			b.backLines = b.backLines[:len(b.backLines)-1]
+			b.frontLines = append(b.frontLines, pos)
+		}
+	}
+
 	b.frontSize = newFront
 	b.backSize = newBack
 }
@@ -1,14 +1,18 @@
 package gapbuffer
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"strconv"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/psanford/hat/textbuffer"
+	"github.com/psanford/hat/textbuffer/textbuffertest"
 )
 
 func TestGapbuffer(t *testing.T) {
@@ -445,3 +449,230 @@ func (c *CheckBuffer) Read(p []byte) (int, error) {
 func (c *CheckBuffer) debugInfo() debugInfo {
 	return c.buf.debugInfo()
 }
+
+// TestLineIndex checks GetLine and LineAt against a linear scan of the
+// buffer contents after random edits and cursor moves.
+func TestLineIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	buf := New(2)
+
+	chunks := []string{"a", "\n", "bc", "\n\n", "d\ne", "fgh\n", "\ni\nj\n"}
+
+	for i := 0; i < 2000; i++ {
+		switch rng.Intn(4) {
+		case 0, 1:
+			buf.Insert([]byte(chunks[rng.Intn(len(chunks))]))
+		case 2:
+			buf.Delete(rng.Intn(4))
+		case 3:
+			buf.Seek(int64(rng.Intn(buf.Size()+1)), io.SeekStart)
+		}
+
+		text := buf.DebugInfo().Bytes()
+		pos, _ := buf.Seek(0, io.SeekCurrent)
+
+		if got, expect := buf.LineCount(), bytes.Count(text, []byte("\n"))+1; got != expect {
+			t.Fatalf("step %d: LineCount got %d expected %d", i, got, expect)
+		}
+
+		for off := 0; off <= len(text); off++ {
+			expect := bytes.Count(text[:off], []byte("\n"))
+			if got := buf.LineAt(off); got != expect {
+				t.Fatalf("step %d: LineAt(%d) got %d expected %d (text=%q)", i, off, got, expect, text)
+			}
+		}
+
+		for line := -1; line <= buf.LineCount(); line++ {
+			expect := -1
+			if line == 0 {
+				expect = 0
+			} else if line > 0 && line < buf.LineCount() {
+				expect = nthIndex(text, '\n', line-1) + 1
+			}
+			if got := buf.LineStart(line); got != expect {
+				t.Fatalf("step %d: LineStart(%d) got %d expected %d (text=%q)", i, line, got, expect, text)
+			}
+		}
+
+		for offset := -5; offset <= 5; offset++ {
+			gotStart, gotEnd := buf.GetLine(offset)
+			expectStart, expectEnd := scanLine(text, int(pos), offset)
+			if gotStart != expectStart || gotEnd != expectEnd {
+				t.Fatalf("step %d: GetLine(%d) at pos %d got %d,%d expected %d,%d (text=%q)", i, offset, pos, gotStart, gotEnd, expectStart, expectEnd, text)
+			}
+		}
+	}
+}
+
+// nthIndex returns the index of the nth (zero based) occurrence of c.
+func nthIndex(b []byte, c byte, n int) int {
+	for i := range b {
+		if b[i] == c {
+			if n == 0 {
+				return i
+			}
+			n--
+		}
+	}
+	return -1
+}
+
+// scanLine is GetLine implemented by scanning for newlines.
+func scanLine(text []byte, pos, offset int) (int, int) {
+	searchFor := func(from int) int {
+		if from > len(text) {
+			return -1
+		}
+		i := bytes.IndexByte(text[from:], '\n')
+		if i < 0 {
+			return -1
+		}
+		return from + i
+	}
+	searchBackFor := func(from int) int {
+		if from > len(text) {
+			from = len(text)
+		}
+		return bytes.LastIndexByte(text[:from], '\n')
+	}
+
+	if offset == 0 {
+		start := searchBackFor(pos) + 1
+		end := searchFor(pos)
+		if end == -1 {
+			end = len(text) - 1
+			if start == end+1 {
+				end = start
+			}
+		}
+		return start, end
+	} else if offset < 0 {
+		cur := pos
+		for i := 0; i < -offset; i++ {
+			nl := searchBackFor(cur)
+			if nl == -1 {
+				return -1, -1
+			}
+			cur = nl
+		}
+		return searchBackFor(cur) + 1, cur
+	}
+
+	newLineCount := offset + 1
+	cur := pos
+	start := searchBackFor(cur+1) + 1
+	if start == cur+1 {
+		newLineCount--
+	}
+	for i := 0; i < newLineCount; i++ {
+		nl := searchFor(cur + 1)
+		if nl == -1 {
+			if i == newLineCount-1 {
+				return cur + 1, len(text)
+			}
+			return -1, -1
+		}
+		start = cur + 1
+		cur = nl
+	}
+	return start, cur
+}
+
+func TestLineCol(t *testing.T) {
+	buf := New(4)
+	buf.Insert([]byte("ab\nçé☃x\n\nlast"))
+
+	offsetCases := []struct {
+		offset  int
+		line    int
+		col     int
+		runeCol int
+	}{
+		{0, 0, 0, 0},
+		{2, 0, 2, 2},
+		{3, 1, 0, 0},
+		{5, 1, 2, 1},
+		{7, 1, 4, 2},
+		{10, 1, 7, 3},
+		{11, 1, 8, 4},
+		{12, 2, 0, 0},
+		{16, 3, 3, 3},
+		{17, 3, 4, 4},
+		{99, 3, 4, 4},
+	}
+
+	for _, tc := range offsetCases {
+		line, col := buf.LineCol(tc.offset)
+		if line != tc.line || col != tc.col {
+			t.Errorf("LineCol(%d) got %d,%d expected %d,%d", tc.offset, line, col, tc.line, tc.col)
+		}
+		line, col = buf.LineRuneCol(tc.offset)
+		if line != tc.line || col != tc.runeCol {
+			t.Errorf("LineRuneCol(%d) got %d,%d expected %d,%d", tc.offset, line, col, tc.line, tc.runeCol)
+		}
+	}
+
+	lineCases := []struct {
+		line       int
+		col        int
+		offset     int
+		runeOffset int
+	}{
+		{0, 0, 0, 0},
+		{0, 1, 1, 1},
+		{0, 5, 2, 2},
+		{1, 2, 5, 7},
+		{1, 3, 6, 10},
+		{1, 100, 11, 11},
+		{2, 3, 12, 12},
+		{3, 2, 15, 15},
+		{9, 0, 13, 13},
+		{-1, 1, 1, 1},
+	}
+
+	for _, tc := range lineCases {
+		if got := buf.LineColOffset(tc.line, tc.col); got != tc.offset {
+			t.Errorf("LineColOffset(%d, %d) got %d expected %d", tc.line, tc.col, got, tc.offset)
+		}
+		if got := buf.LineRuneColOffset(tc.line, tc.col); got != tc.runeOffset {
+			t.Errorf("LineRuneColOffset(%d, %d) got %d expected %d", tc.line, tc.col, got, tc.runeOffset)
+		}
+	}
+
+	for line, expect := range []int{2, 11, 12, 17, -1} {
+		if got := buf.LineEnd(line); got != expect {
+			t.Errorf("LineEnd(%d) got %d expected %d", line, got, expect)
+		}
+	}
+
+	pos, err := buf.SeekLine(1)
+	if err != nil || pos != 3 {
+		t.Fatalf("SeekLine(1) got %d, %v expected 3", pos, err)
+	}
+	if got := buf.LineAt(int(pos)); got != 1 {
+		t.Errorf("LineAt after SeekLine got %d expected 1", got)
+	}
+
+	pos, err = buf.SeekLineCol(3, 2)
+	if err != nil || pos != 15 {
+		t.Fatalf("SeekLineCol(3, 2) got %d, %v expected 15", pos, err)
+	}
+
+	pos, err = buf.SeekLine(50)
+	if err != nil || pos != 13 {
+		t.Fatalf("SeekLine(50) got %d, %v expected 13", pos, err)
+	}
+
+	if _, err := buf.SeekLine(-1); err == nil {
+		t.Fatalf("SeekLine(-1) expected error")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	textbuffertest.Run(t, func(initial []byte) textbuffer.TextBuffer {
+		buf := New(2)
+		buf.Insert(initial)
+		buf.Seek(0, io.SeekStart)
+		return buf
+	})
+}
@@ -7,6 +7,7 @@ toolchain go1.22.4
 require (
 	github.com/google/go-cmp v0.4.0
 	github.com/psanford/ansiterm v0.0.0-20240811023341-dd27b6fd0c7f
+	github.com/rivo/uniseg v0.4.4
 	github.com/vito/midterm v0.1.5-0.20240307214207-d0271a7ca452
 	golang.org/x/sys v0.7.0
 )
@@ -17,5 +18,4 @@ require (
 	github.com/mattn/go-isatty v0.0.18 // indirect
 	github.com/mattn/go-runewidth v0.0.14 // indirect
 	github.com/muesli/termenv v0.15.1 // indirect
-	github.com/rivo/uniseg v0.4.4 // indirect
 )
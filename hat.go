@@ -10,24 +10,56 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unicode/utf8"
 
 	"github.com/psanford/ansiterm"
 	"github.com/psanford/hat/ansiraw"
+	"github.com/psanford/hat/charset"
 	"github.com/psanford/hat/displaybox"
+	"github.com/psanford/hat/eol"
 	"github.com/psanford/hat/gapbuffer"
+	"github.com/psanford/hat/piecetable"
 	"github.com/psanford/hat/terminal"
+	"github.com/psanford/hat/textbuffer"
+	"github.com/psanford/hat/vimode"
 	"github.com/psanford/hat/vt100"
 )
 
 var border = flag.Bool("border", false, "show border")
 var debugLog = flag.Bool("debug", false, "write debug logs")
+var viMode = flag.Bool("vi", false, "vi modal editing")
+var mouse = flag.Bool("mouse", true, "enable mouse support")
+var kittyKeyboard = flag.Bool("kitty-keyboard", true, "use the kitty keyboard protocol if the terminal supports it")
+var startLine = flag.Int("line", 1, "line to place the cursor on after loading the file")
+var largeFileSize = flag.Int64("large-file", 64<<20, "read files of at least this many bytes on demand instead of loading them into memory (0 to disable)")
+var bufferBackend = flag.String("buffer", "gap", "text storage backend (gap, piece)")
+var lineEnding = flag.String("eol", "", "save with these line endings (lf, crlf, cr) instead of the file's own")
+var autoIndent = flag.Bool("autoindent", false, "indent new lines to match the line above")
+var hexView = flag.Bool("hex", false, "show the file as a hex dump, the default for binary files")
+var tidySave = flag.Bool("tidy", false, "when saving source code, trim trailing whitespace, end with one newline and normalize line endings")
+var format = flag.Bool("format", false, "pipe the text through the file type's formatter (gofmt, jq, shfmt) when saving")
+var formatter = flag.String("formatter", "", "command to pipe the text through when saving, instead of the file type's own formatter")
+var encoding = flag.String("encoding", "", "save in this encoding (utf-8, utf-8-bom, utf-16le-bom, latin1, windows-1252, ...) instead of the file's own")
 
 func main() {
 	flag.Parse()
 
+	if *lineEnding != "" {
+		if _, err := eol.Parse(*lineEnding); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *encoding != "" {
+		if _, err := charset.Parse(*encoding); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	out := os.Stdout
 
 	if err := syscall.SetNonblock(0, true); err != nil {
@@ -63,25 +95,36 @@ func main() {
 		return
 	}
 
+	// Term only holds on to the fd, keep tty referenced so the garbage
+	// collector doesn't close it out from under us
+	defer tty.Close()
 	term := terminal.NewTerm(int(tty.Fd()))
 
 	ed := newEditor(in, srcFile, term)
+	if len(args) == 1 {
+		ed.filename = args[0]
+	}
 
 	ctx := context.Background()
-	save := ed.run(ctx)
+	status, err := ed.run(ctx)
+	if err != nil {
+		// the terminal has been restored by now
+		log.Fatal(err)
+	}
 
-	if !save {
+	switch status {
+	case exitAbort:
 		log.Println("abort")
 		os.Exit(1)
+	case exitQuit:
+		return
 	}
 
-	ed.buf.Seek(0, io.SeekStart)
-
-	if len(args) == 1 {
-		out, err = os.Create(args[0])
-		if err != nil {
+	if ed.filename != "" {
+		if err := ed.save(); err != nil {
 			log.Fatal(err)
 		}
+		return
 	}
 
 	if terminal.IsTerminal(int(out.Fd())) {
@@ -89,16 +132,43 @@ func main() {
 		return
 	}
 
-	io.Copy(out, ed.buf)
+	ed.writeText(out)
 }
 
+type exitStatus int
+
+const (
+	// write the buffer out
+	exitSave exitStatus = iota
+	// exit with an error without writing the buffer
+	exitAbort
+	// exit without writing the buffer
+	exitQuit
+)
+
 type editor struct {
 	term  terminal.Terminal
 	vt100 *vt100.VT100
-	buf   *gapbuffer.GapBuffer
+	buf   textbuffer.TextBuffer
 	disp  *displaybox.DisplayBox
+	vi    *vimode.Vi
+
+	parser    *ansiterm.AnsiParser
+	eventChan chan ansiterm.AnsiEvent
+	// set when the parser has emitted ESC O and the final byte of the
+	// SS3 sequence will arrive as the next Print event
+	pendingSS3 bool
+
+	// quoted insert state, see startQuote
+	quote       quoteState
+	quoteDigits string
+	// the status line message from before the quoted insert
+	quoteStatus string
 
-	parser *ansiterm.AnsiParser
+	// mouse drag state
+	mouseDown      bool
+	mouseAnchor    int
+	mouseSelection bool
 
 	debugLog io.Writer
 
@@ -107,29 +177,78 @@ type editor struct {
 	in       *os.File
 	inReader io.Reader
 	srcFile  *os.File
+	filename string
+	fileType fileType
+	// largeFile is set if buf reads srcFile on demand
+	largeFile bool
+	// binary is set if srcFile doesn't look like text. It is loaded
+	// without any conversion and shown in the hex view.
+	binary bool
+	// encoding and lineEnding are used when saving. The buffer itself
+	// always holds UTF-8 with \n line endings.
+	encoding   charset.Encoding
+	lineEnding eol.Style
+	// saveOpts are applied to the buffer when it is saved
+	saveOpts saveOptions
+	// formatter is the command the buffer is piped through when it is
+	// saved, if any
+	formatter []string
+
+	// values of disp.Changes(), encoding and lineEnding when the buffer
+	// was last loaded or saved
+	savedChanges    int
+	savedEncoding   charset.Encoding
+	savedLineEnding eol.Style
+
+	// prompt is set while a line of text is entered on the status line
+	prompt *linePrompt
+	// shellRunning is set while a shell command has the terminal
+	shellRunning atomic.Bool
+
+	done   bool
+	status exitStatus
 }
 
 func newEditor(in, srcFile *os.File, term terminal.Terminal) *editor {
-	vt := vt100.New(term)
-	gb := gapbuffer.New(2)
-
+	// without a terminfo entry for $TERM we get xterm escape sequences
+	vt, _ := vt100.NewTerminfo(term, os.Getenv("TERM"))
 	ed := &editor{
 		in:       in,
 		inReader: in,
 		srcFile:  srcFile,
 		term:     term,
 		vt100:    vt,
-		buf:      gb,
 	}
 
 	return ed
 }
 
-func (ed *editor) run(parentCtx context.Context) (save bool) {
+func newTextBuffer(backend string) textbuffer.TextBuffer {
+	switch backend {
+	case "piece":
+		return piecetable.New(nil)
+	case "gap":
+		return gapbuffer.New(2)
+	}
+	log.Fatalf("unknown buffer backend %q", backend)
+	return nil
+}
+
+func (ed *editor) run(parentCtx context.Context) (status exitStatus, err error) {
 	ctx, cancel := context.WithCancel(parentCtx)
 	defer cancel()
 
-	save = true
+	status = exitSave
+	if ed.srcFile != nil {
+		ed.buf, ed.largeFile, err = openLarge(ed.srcFile)
+		if err != nil {
+			return status, err
+		}
+	}
+	if ed.buf == nil {
+		ed.buf = newTextBuffer(*bufferBackend)
+	}
+
 	ed.term.EnableRawMode()
 	defer ed.term.Restore()
 
@@ -145,7 +264,11 @@ func (ed *editor) run(parentCtx context.Context) (save bool) {
 		for sig := range sigChan {
 			switch sig {
 			case syscall.SIGTERM, syscall.SIGINT:
-				save = false
+				if sig == syscall.SIGINT && ed.shellRunning.Load() {
+					// meant for the shell command, which gets it too
+					continue
+				}
+				status = exitAbort
 				cancel()
 				return
 			case syscall.SIGWINCH:
@@ -159,7 +282,15 @@ func (ed *editor) run(parentCtx context.Context) (save bool) {
 
 	cursorT, extraBytes, err := ed.vt100.CursorPos()
 	if err != nil {
-		log.Fatalf("Failed to read cursor position: %s", err)
+		return status, fmt.Errorf("Failed to read cursor position: %w", err)
+	}
+
+	if *kittyKeyboard {
+		_, extra, err := ed.vt100.EnableKittyKeyboard()
+		if err != nil {
+			return status, fmt.Errorf("Failed to probe keyboard protocol: %w", err)
+		}
+		extraBytes = append(extraBytes, extra...)
 	}
 
 	if len(extraBytes) > 0 {
@@ -176,6 +307,23 @@ func (ed *editor) run(parentCtx context.Context) (save bool) {
 
 	ed.disp = displaybox.New(ed.vt100, ed.buf, *border, *cursorT)
 
+	ed.fileType = detectFileType(ed.filename)
+	ed.disp.SetIndent(ed.fileType.indent, ed.fileType.indentAfter)
+	if *tidySave {
+		ed.saveOpts = ed.fileType.save
+	}
+	if *format {
+		ed.formatter = ed.fileType.formatter
+	}
+	if *formatter != "" {
+		ed.formatter = strings.Fields(*formatter)
+	}
+	ed.disp.SetAutoIndent(*autoIndent)
+
+	if *mouse {
+		ed.vt100.EnableMouse()
+	}
+
 	defer func() {
 		// mv cursor to bottom of our controlled area so we don't mess up
 		// the terminal
@@ -184,22 +332,46 @@ func (ed *editor) run(parentCtx context.Context) (save bool) {
 	}()
 
 	if ed.srcFile != nil {
-		buf := make([]byte, 128)
-		for {
-			n, err := ed.srcFile.Read(buf)
-			if n > 0 {
-				text := buf[:n]
-				ed.disp.Insert(text)
-			}
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				log.Fatal(err)
-			}
+		if err := ed.load(*startLine - 1); err != nil {
+			return status, err
 		}
 	}
+	configErr := ed.applyEditorConfig()
+	if *lineEnding != "" {
+		ed.lineEnding, _ = eol.Parse(*lineEnding)
+	}
+	if *encoding != "" {
+		ed.encoding, _ = charset.Parse(*encoding)
+	}
+	ed.savedChanges = ed.disp.Changes()
+
+	if *viMode || ed.encoding != (charset.Encoding{}) || ed.binary {
+		// let the user know the file will be saved in another encoding
+		ed.disp.EnableStatusLine()
+	}
+	ed.updateStatusInfo()
+
+	if *hexView || ed.binary {
+		ed.disp.SetHexMode(true)
+	}
+	if ed.binary {
+		ed.disp.SetStatus("binary file, ctrl-t toggles the hex view")
+	}
+	if configErr != nil {
+		ed.disp.EnableStatusLine()
+		ed.disp.SetStatus(configErr.Error())
+	}
+
+	if *viMode {
+		ed.vi = vimode.New(ed.disp, ed.buf)
+		ed.vi.ExCommand = ed.exCommand
+	}
+	// vi mode and overwrite mode change the cursor shape, put it back if
+	// they did
+	defer ed.vt100.SetCursorStyle(vt100.CursorDefault)
 
 	eventChan := make(chan ansiterm.AnsiEvent, 10)
+	ed.eventChan = eventChan
 	var opts []ansiterm.Option
 
 	if *debugLog {
@@ -231,8 +403,7 @@ MAIN_LOOP:
 				if result.err == io.EOF {
 					return
 				}
-				log.Fatalf("read err: %s", result.err)
-				continue MAIN_LOOP
+				return status, fmt.Errorf("read err: %w", result.err)
 			}
 		case <-resizeChan:
 			ed.debugPrintf("got resize event\n")
@@ -257,94 +428,15 @@ MAIN_LOOP:
 				continue MAIN_LOOP
 			}
 
-			switch ee := e.(type) {
-			case *ansiterm.Print:
-				ed.debugPrintf("loop: is plain char <%s>\n", ee.B)
-
-				p := ee.B
-				for len(p) > 0 {
-					r, size := utf8.DecodeRune(p)
-					p = p[size:]
-					if r == 0x7F {
-						ed.disp.Backspace()
-					} else {
-						ed.disp.Insert([]byte(string(r)))
-					}
-				}
-			case *ansiterm.Execute:
-				for _, c := range ee.B {
-					if c == 0x7F { // ASCII DEL (backspace)
-						ed.disp.Backspace()
-					} else if c == '\r' {
-						ed.disp.InsertNewline()
-					} else if c == ctrlD {
-						break MAIN_LOOP
-					} else if c == ctrlA { // ctrl-a
-						ed.disp.MvBOL()
-					} else if c == ctrlE { // ctrl-e
-						ed.disp.MvEOL()
-					} else if c == ctrlL {
-						// redraw the section of the terminal we own
-						ed.disp.Redraw()
-					} else {
-						ed.debugPrintf("unsupported control char<%c>\n", c)
-					}
-				}
-			case *ansiterm.CursorUp:
-				for i := 0; i < ee.N; i++ {
-					ed.disp.MvUp()
-				}
-			case *ansiterm.CursorDown:
-				for i := 0; i < ee.N; i++ {
-					ed.disp.MvDown()
-				}
-			case *ansiterm.CursorForward:
-				for i := 0; i < ee.N; i++ {
-					ed.disp.MvRight()
-				}
-			case *ansiterm.CursorBackward:
-				for i := 0; i < ee.N; i++ {
-					ed.disp.MvLeft()
-				}
-			case *ansiterm.DeleteCharacter:
-				for i := 0; i < ee.N; i++ {
-					ed.disp.Del()
-				}
-			// case *CursorNextLine:
-			// case *CursorPreviousLine:
-			// case *CursorHorizontalAbsolute:
-			// case *VerticalLinePositionAbsolute:
-			// case *CursorPosition:
-			// case *HorizontalVerticalPosition:
-			// case *TextCursorEnableMode:
-			// case *OriginMode:
-			// case *ColumnMode:
-			// case *EraseInDisplay:
-			// case *EraseInLine:
-			// case *InsertLine:
-			// case *DeleteLine:
-			// case *InsertCharacter:
-			// case *SetGraphicsRendition:
-			// case *ScrollUp:
-			// case *ScrollDown:
-			// case *DeviceAttributes:
-			// case *SetTopAndBottomMargins:
-			// case *Index:
-			// case *ReverseIndex:
-			default:
-				switch ansiraw.ParseRaw(e.Raw()) {
-				case ansiraw.PageDown:
-					ed.disp.MvPgDown()
-				case ansiraw.PageUp:
-					ed.disp.MvPgUp()
-				default:
-					ed.debugPrintf("Unhandled event type: %T %+v\n", ee, ee)
-				}
+			ed.handleEvent(e)
+			if ed.done {
+				return ed.status, nil
 			}
 
 			if *debugLog {
-				info := ed.buf.DebugInfo()
-				os.WriteFile("/tmp/hat.current.buffer", info.Bytes(), 0600)
+				b := make([]byte, ed.buf.Size())
+				ed.buf.ReadAt(b, 0)
+				os.WriteFile("/tmp/hat.current.buffer", b, 0600)
 			}
 
 			select {
@@ -353,8 +445,414 @@ MAIN_LOOP:
 			}
 		}
 	}
+}
+
+// handleEvent handles the key presses or mouse event of a parser event.
+// It stops at a key that finishes editing.
+func (ed *editor) handleEvent(e ansiterm.AnsiEvent) {
+	if m, ok := ansiraw.ParseMouse(e.Raw()); ok {
+		ed.handleMouse(m)
+		return
+	}
+
+	for _, kp := range ed.eventKeys(e) {
+		k := kp.Key
+		if ed.prompt == nil && !usesSelection(k) {
+			ed.clearMouseSelection()
+		}
+
+		if ed.prompt != nil {
+			ed.handlePromptKey(k)
+		} else if ed.quote != quoteNone && ed.handleQuoteKey(kp) {
+			// part of a quoted insert
+		} else if ed.vi != nil && !ed.disp.HexMode() && ed.handleViKey(k) {
+			// handled by vi mode
+		} else {
+			ed.handleKey(k)
+		}
+
+		if ed.done {
+			return
+		}
+	}
+}
+
+// keyPress is a key decoded from the input along with the bytes the
+// terminal sent for it.
+type keyPress struct {
+	ansiraw.Key
+	raw []byte
+}
+
+// eventKeys converts a parser event into the key presses it represents.
+func (ed *editor) eventKeys(e ansiterm.AnsiEvent) []keyPress {
+	var keys []keyPress
+	add := func(raw []byte) {
+		keys = append(keys, keyPress{Key: ansiraw.ParseRaw(raw), raw: raw})
+	}
+
+	switch ee := e.(type) {
+	case escapeKey:
+		keys = append(keys, keyPress{Key: ansiraw.Key{Code: ansiraw.KeyEscape}, raw: ee.Raw()})
+	case *ansiterm.Print:
+		p := ee.B
+		if ed.pendingSS3 && len(p) > 0 {
+			// the parser splits SS3 sequences (ESC O x) into two events
+			ed.pendingSS3 = false
+			add([]byte{ansiraw.ESC, 'O', p[0]})
+			p = p[1:]
+		}
+		for len(p) > 0 {
+			_, size := utf8.DecodeRune(p)
+			add(p[:size])
+			p = p[size:]
+		}
+	case *ansiterm.Execute:
+		if len(ee.B) > 1 && ee.B[0] == ansiraw.ESC {
+			add(ee.B)
+			break
+		}
+		for _, c := range ee.B {
+			add([]byte{c})
+		}
+	default:
+		raw := e.Raw()
+		if bytes.Equal(raw, []byte{ansiraw.ESC, 'O'}) {
+			ed.pendingSS3 = true
+			break
+		}
+		k := ansiraw.ParseRaw(raw)
+		if k.Code == ansiraw.KeyUnknown && len(raw) > 2 && raw[0] == ansiraw.ESC && raw[1] >= 0x20 && raw[1] <= 0x2f {
+			// alt with a key such as ! sends an escape sequence
+			// intermediate byte, and the parser takes the next key
+			// press as the end of the sequence
+			add(raw[:2])
+			for p := raw[2:]; len(p) > 0; {
+				_, size := utf8.DecodeRune(p)
+				add(p[:size])
+				p = p[size:]
+			}
+			break
+		}
+		keys = append(keys, keyPress{Key: k, raw: raw})
+	}
+
+	return keys
+}
+
+func (ed *editor) handleKey(k ansiraw.Key) {
+	if k.Code == ansiraw.KeyRune && k.Mod&^ansiraw.ModShift == 0 {
+		ed.disp.Insert([]byte(string(k.Rune)))
+		return
+	}
+
+	switch k.Code {
+	case ansiraw.KeyRune:
+		if k.Mod&^ansiraw.ModShift == ansiraw.ModAlt {
+			switch k.Rune {
+			case '|':
+				ed.startPrompt("| ", ed.filterSelection)
+			case '!':
+				ed.startPrompt("! ", ed.insertCommandOutput)
+			case 's':
+				ed.startPrompt("set ", ed.setOptions)
+			default:
+				ed.debugPrintf("unsupported key <%s>\n", k)
+			}
+			return
+		}
+		if k.Mod != ansiraw.ModCtrl {
+			break
+		}
+		switch k.Rune {
+		case 'c':
+			// only reached with the kitty keyboard protocol, otherwise
+			// the tty sends us SIGINT
+			ed.quit(exitAbort)
+		case 'd':
+			ed.quit(exitSave)
+		case 'a':
+			ed.disp.MvBOL()
+		case 'e':
+			ed.disp.MvEOL()
+		case 'l':
+			// redraw the section of the terminal we own
+			ed.disp.Redraw()
+		case 't':
+			ed.disp.SetHexMode(!ed.disp.HexMode())
+		case 'v':
+			if ed.vi != nil && ed.vi.Mode() != vimode.Insert {
+				break
+			}
+			ed.startQuote()
+		default:
+			ed.debugPrintf("unsupported key <%s>\n", k)
+		}
+		return
+	case ansiraw.KeyEnter:
+		ed.disp.InsertNewline()
+		return
+	case ansiraw.KeyTab:
+		switch {
+		case ed.disp.HexMode():
+			ed.disp.HexSwitchPane()
+		case k.Mod&ansiraw.ModShift != 0:
+			ed.disp.Dedent()
+		default:
+			ed.disp.Indent()
+		}
+		return
+	case ansiraw.KeyBackspace:
+		ed.disp.Backspace()
+		return
+	case ansiraw.KeyUp:
+		ed.disp.MvUp()
+		return
+	case ansiraw.KeyDown:
+		ed.disp.MvDown()
+		return
+	case ansiraw.KeyRight:
+		ed.disp.MvRight()
+		return
+	case ansiraw.KeyLeft:
+		ed.disp.MvLeft()
+		return
+	case ansiraw.KeyHome:
+		if k.Mod&ansiraw.ModCtrl != 0 {
+			ed.disp.MvBOF()
+		} else {
+			ed.disp.MvBOL()
+		}
+		return
+	case ansiraw.KeyEnd:
+		if k.Mod&ansiraw.ModCtrl != 0 {
+			ed.disp.MvEOF()
+		} else {
+			ed.disp.MvEOL()
+		}
+		return
+	case ansiraw.KeyDelete:
+		ed.disp.Del()
+		return
+	case ansiraw.KeyInsert:
+		ed.setOverwrite(!ed.disp.Overwrite())
+		return
+	case ansiraw.KeyPageDown:
+		ed.disp.MvPgDown()
+		return
+	case ansiraw.KeyPageUp:
+		ed.disp.MvPgUp()
+		return
+	}
+
+	ed.debugPrintf("unhandled key <%s>\n", k)
+}
+
+// usesSelection reports whether k acts on the mouse selection rather
+// than clearing it.
+func usesSelection(k ansiraw.Key) bool {
+	switch {
+	case k.Code == ansiraw.KeyTab:
+		// tab indents the selection
+		return true
+	case k.Code == ansiraw.KeyRune && k.Mod&^ansiraw.ModShift == ansiraw.ModAlt:
+		// alt-| filters it
+		return k.Rune == '|'
+	}
+	return false
+}
+
+// save writes the buffer to the file we are editing.
+func (ed *editor) save() error {
+	if ed.filename == "" {
+		return errors.New("No file name")
+	}
+	if err := ed.format(); err != nil {
+		// save the text as it is rather than lose it
+		if ed.disp != nil && !ed.done {
+			ed.disp.EnableStatusLine()
+			ed.disp.SetStatus(err.Error())
+		} else {
+			log.Print(err)
+		}
+	}
+	ed.applySaveOptions()
+
+	if ed.largeFile {
+		// unchanged text is still read from the file, so we can't
+		// just truncate it
+		if err := ed.saveByRename(); err != nil {
+			return err
+		}
+	} else {
+		// find out if the text can't be encoded before truncating the
+		// file
+		if err := ed.writeText(io.Discard); err != nil {
+			return err
+		}
+
+		f, err := os.Create(ed.filename)
+		if err != nil {
+			return err
+		}
+
+		if err := ed.writeText(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	if ed.disp != nil {
+		ed.savedChanges = ed.disp.Changes()
+	}
+	ed.savedEncoding = ed.encoding
+	ed.savedLineEnding = ed.lineEnding
+	return nil
+}
+
+// saveByRename saves a large file, whose unchanged text is still read
+// from srcFile, by writing a new file next to it and renaming that over
+// it. srcFile keeps the old text readable. Files with other hard links,
+// and files whose owner we can't keep, are written in place instead.
+func (ed *editor) saveByRename() error {
+	// replace the file a symlink points to rather than the symlink
+	target, err := filepath.EvalSymlinks(ed.filename)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+
+	st, _ := fi.Sys().(*syscall.Stat_t)
+	if st != nil && st.Nlink > 1 {
+		// a new file would only replace this one of its names
+		return ed.saveInPlace(target, fi)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if st != nil {
+		if err := f.Chown(int(st.Uid), int(st.Gid)); err != nil {
+			f.Close()
+			return ed.saveInPlace(target, fi)
+		}
+	}
+	if err := ed.writeText(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(fi.Mode().Perm()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), target)
+}
+
+// saveInPlace overwrites target, a large file with info fi. If target is
+// the file the buffer reads its unchanged text from, that text is first
+// copied to a temporary file for the buffer to read instead.
+func (ed *editor) saveInPlace(target string, fi os.FileInfo) error {
+	// find out if the text can't be encoded before truncating the file
+	if err := ed.writeText(io.Discard); err != nil {
+		return err
+	}
+
+	if srcInfo, err := ed.srcFile.Stat(); err == nil && os.SameFile(srcInfo, fi) {
+		old, err := os.CreateTemp("", "hat-")
+		if err != nil {
+			return err
+		}
+		// only kept open
+		os.Remove(old.Name())
+		if _, err := io.Copy(old, io.NewSectionReader(ed.srcFile, 0, srcInfo.Size())); err != nil {
+			old.Close()
+			return err
+		}
+		pt, ok := ed.buf.(*piecetable.PieceTable)
+		if !ok {
+			old.Close()
+			return fmt.Errorf("buffer for %s doesn't read from the file", target)
+		}
+		pt.SetFile(old)
+		ed.srcFile.Close()
+		ed.srcFile = old
+	}
 
-	return
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if err := ed.writeText(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeText writes the buffer to w in the file's encoding and line
+// ending convention.
+func (ed *editor) writeText(w io.Writer) error {
+	cw := charset.NewWriter(w, ed.encoding)
+	if _, err := ed.buf.WriteTo(eol.NewWriter(cw, ed.lineEnding)); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// updateStatusInfo shows the encoding and line endings the file will
+// be saved with, and whether overwrite mode is on.
+func (ed *editor) updateStatusInfo() {
+	info := ed.encoding.String() + " " + ed.lineEnding.String()
+	if ed.disp.Overwrite() {
+		info = "OVR " + info
+	}
+	ed.disp.SetStatusInfo(info)
+}
+
+// setOverwrite turns overwrite mode on or off. Overwrite mode has an
+// underline cursor and is shown on the status line.
+func (ed *editor) setOverwrite(on bool) {
+	ed.disp.SetOverwrite(on)
+
+	style := vt100.CursorDefault
+	switch {
+	case on:
+		style = vt100.CursorSteadyUnderline
+		ed.disp.EnableStatusLine()
+	case ed.vi != nil && ed.vi.Mode() == vimode.Insert:
+		style = vt100.CursorSteadyBar
+	case ed.vi != nil:
+		style = vt100.CursorSteadyBlock
+	}
+	ed.disp.SetCursorStyle(style)
+	ed.updateStatusInfo()
+}
+
+// modified reports whether the buffer has changed since it was loaded or
+// last saved.
+func (ed *editor) modified() bool {
+	return ed.disp.Changes() != ed.savedChanges ||
+		ed.encoding != ed.savedEncoding ||
+		ed.lineEnding != ed.savedLineEnding
+}
+
+// quit stops the editor after the current event.
+func (ed *editor) quit(status exitStatus) {
+	ed.done = true
+	ed.status = status
 }
 
 func (ed *editor) debugPrintf(format string, args ...any) {
@@ -399,7 +897,11 @@ func (ed *editor) readBytes() readResult {
 		}
 	}
 
-	if total > 0 {
+	if total == 1 && b[0] == ansiraw.ESC {
+		// A lone escape byte is the escape key rather than the start
+		// of an escape sequence.
+		ed.eventChan <- escapeKey{}
+	} else if total > 0 {
 		_, err = ed.parser.Parse(b[:total])
 		if err != nil {
 			result.err = err
@@ -411,17 +913,11 @@ func (ed *editor) readBytes() readResult {
 	return result
 }
 
-const (
-	ctrlA = 0x01
-	ctrlB = 0x02
-	ctrlC = 0x03
-	ctrlD = 0x04
-	ctrlE = 0x05
-	ctrlL = 0x0C
-)
+// escapeKey is the event for a press of the escape key.
+type escapeKey struct{}
 
-func ctrlKey(c byte) byte {
-	return c & 0x1f
+func (escapeKey) Raw() []byte {
+	return []byte{ansiraw.ESC}
 }
 
 type readResult struct {
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/psanford/hat/displaybox"
+	"github.com/psanford/hat/gapbuffer"
+	"github.com/psanford/hat/terminal/mock"
+	"github.com/psanford/hat/vt100"
+)
+
+// newTestEditor returns an editor on a mock terminal holding text, with
+// the cursor at the start.
+func newTestEditor(t *testing.T, text string) *editor {
+	t.Helper()
+
+	term := mock.NewMock(40, 10)
+	vt := vt100.New(term)
+	buf := gapbuffer.New(2)
+
+	col, row := term.CursorPos()
+	ed := &editor{
+		term:  term,
+		vt100: vt,
+		buf:   buf,
+	}
+	ed.disp = displaybox.New(vt, buf, false, vt100.TermCoord{Col: col, Row: row})
+	ed.disp.Insert([]byte(text))
+	ed.disp.MvBOF()
+	return ed
+}
+
+// text returns the contents of the editor's buffer.
+func (ed *editor) text() string {
+	return string(ed.buf.Bytes(0, ed.buf.Size()))
+}
+
+// cursorLineCol returns the line and rune column of the cursor.
+func (ed *editor) cursorLineCol() (int, int) {
+	return ed.buf.LineRuneCol(ed.disp.Offset())
+}
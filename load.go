@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/psanford/hat/charset"
+	"github.com/psanford/hat/eol"
+	"github.com/psanford/hat/piecetable"
+	"github.com/psanford/hat/textbuffer"
+)
+
+// inputs at least this large show progress while loading
+const loadProgressMin = 8 << 20
+
+// detectSample is how much of a file is examined to detect its encoding
+// and line endings
+const detectSample = 64 << 10
+
+// openLarge returns a buffer that reads srcFile on demand if it is at
+// least -large-file bytes. It returns a nil buffer for smaller files.
+func openLarge(srcFile *os.File) (textbuffer.TextBuffer, bool, error) {
+	if *largeFileSize <= 0 {
+		return nil, false, nil
+	}
+	fi, err := srcFile.Stat()
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() < *largeFileSize {
+		return nil, false, nil
+	}
+
+	sample := make([]byte, detectSample)
+	n, _ := srcFile.ReadAt(sample, 0)
+	converted := charset.Detect(sample[:n]) != (charset.Encoding{}) || eol.Detect(sample[:n]) != eol.LF
+	if converted && !charset.Binary(sample[:n]) {
+		// the text has to be converted as the file is read
+		return nil, false, nil
+	}
+
+	pt, err := piecetable.NewFile(srcFile, fi.Size())
+	if err != nil {
+		return nil, false, err
+	}
+	return pt, true, nil
+}
+
+// load reads srcFile into the buffer and places the cursor at the start
+// of the zero based line.
+func (ed *editor) load(line int) error {
+	if ed.largeFile {
+		// the buffer already pages in the file itself
+		sample := make([]byte, detectSample)
+		n, _ := ed.srcFile.ReadAt(sample, 0)
+		ed.binary = charset.Binary(sample[:n])
+		ed.disp.Reset(line)
+		return nil
+	}
+
+	var r io.Reader = ed.srcFile
+
+	var size int64
+	if fi, err := ed.srcFile.Stat(); err == nil && fi.Mode().IsRegular() {
+		size = fi.Size()
+	}
+	if size >= loadProgressMin {
+		r = &progressReader{
+			r:     ed.srcFile,
+			total: size,
+			report: func(read, total int64) {
+				ed.vt100.Write([]byte("\r"))
+				ed.vt100.ClearToEndOfLine()
+				fmt.Fprintf(ed.vt100, "loading %s: %d%%", ed.filename, read*100/total)
+			},
+		}
+	}
+
+	br := bufio.NewReaderSize(r, detectSample)
+	sample, _ := br.Peek(detectSample)
+	if charset.Binary(sample) {
+		// keep every byte as it is
+		ed.binary = true
+		_, err := ed.disp.Load(br, line)
+		return err
+	}
+	ed.encoding = charset.Detect(sample)
+	ed.savedEncoding = ed.encoding
+	r = charset.NewReader(br, ed.encoding)
+
+	br = bufio.NewReaderSize(r, detectSample)
+	sample, _ = br.Peek(detectSample)
+	ed.lineEnding = eol.Detect(sample)
+	ed.savedLineEnding = ed.lineEnding
+	r = eol.NewReader(br, ed.lineEnding)
+
+	if *largeFileSize > 0 && size >= *largeFileSize {
+		// openLarge can't page in text that has to be converted
+		ed.disp.EnableStatusLine()
+		ed.disp.SetStatus(fmt.Sprintf("Large %s %s file loaded into memory", ed.encoding, ed.lineEnding))
+	}
+
+	_, err := ed.disp.Load(r, line)
+	return err
+}
+
+// progressReader calls report as data is read from r, at most every
+// progressInterval.
+type progressReader struct {
+	r      io.Reader
+	total  int64
+	read   int64
+	last   time.Time
+	report func(read, total int64)
+}
+
+const progressInterval = 100 * time.Millisecond
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= progressInterval && p.read <= p.total {
+		p.last = now
+		p.report(p.read, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/psanford/hat/ansiraw"
+	"github.com/psanford/hat/vt100"
+)
+
+// number of lines to scroll for each wheel event
+const mouseWheelLines = 3
+
+func (ed *editor) handleMouse(m ansiraw.Mouse) {
+	tc := vt100.TermCoord{
+		Row: m.Row,
+		Col: m.Col,
+	}
+
+	switch m.Action {
+	case ansiraw.MouseWheelUp:
+		ed.disp.Scroll(-mouseWheelLines)
+	case ansiraw.MouseWheelDown:
+		ed.disp.Scroll(mouseWheelLines)
+	case ansiraw.MouseWheelLeft, ansiraw.MouseWheelRight:
+		// long lines scroll with the cursor rather than on their own
+	case ansiraw.MousePress:
+		if m.Button != ansiraw.MouseLeft {
+			return
+		}
+		// we share the screen with the scrollback, so ignore clicks
+		// outside of our region
+		off, ok := ed.disp.OffsetAt(tc)
+		if !ok {
+			return
+		}
+		ed.clearMouseSelection()
+		ed.disp.MvTo(off)
+		ed.mouseAnchor = off
+		ed.mouseDown = true
+	case ansiraw.MouseDrag:
+		if !ed.mouseDown || m.Button != ansiraw.MouseLeft {
+			return
+		}
+		off, ok := ed.disp.OffsetAt(tc)
+		if !ok {
+			return
+		}
+		ed.disp.MvTo(off)
+		if off == ed.mouseAnchor {
+			ed.clearMouseSelection()
+		} else {
+			ed.disp.SetSelection(ed.mouseAnchor, off)
+			ed.mouseSelection = true
+		}
+	case ansiraw.MouseRelease:
+		ed.mouseDown = false
+	}
+}
+
+// clearMouseSelection removes a selection made by dragging the mouse.
+func (ed *editor) clearMouseSelection() {
+	if ed.mouseSelection {
+		ed.disp.ClearSelection()
+		ed.mouseSelection = false
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMouseWheel(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		// line the cursor starts on
+		line  int
+		moves bool
+	}{
+		{name: "Wheel up", input: "\x1b[<64;1;1M", line: 29, moves: true},
+		{name: "Wheel down", input: "\x1b[<65;1;1M", line: 0, moves: true},
+		{name: "Wheel left", input: "\x1b[<66;1;1M", line: 0},
+		{name: "Wheel right", input: "\x1b[<67;1;1M", line: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := newTestEditor(t, strings.Repeat("line\n", 30))
+			ed.disp.MvTo(ed.buf.LineStart(tc.line))
+			before := ed.disp.Offset()
+
+			ed.feed(tc.input)
+
+			if moved := ed.disp.Offset() != before; moved != tc.moves {
+				t.Errorf("cursor moved %t expected %t", moved, tc.moves)
+			}
+			if got := ed.text(); got != strings.Repeat("line\n", 30) {
+				t.Errorf("text changed to %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/psanford/hat/charset"
+	"github.com/psanford/hat/eol"
+)
+
+// setOptions sets each of the space separated options in text, see
+// setOption.
+func (ed *editor) setOptions(text string) error {
+	for _, opt := range strings.Fields(text) {
+		if err := ed.setOption(opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setOption sets an option given as "name=value", or shows the current
+// value for just "name". It is used by vi's ":set" and the alt-s
+// prompt.
+func (ed *editor) setOption(opt string) error {
+	name, value, assign := strings.Cut(opt, "=")
+	switch name {
+	case "eol", "ff", "fileformat":
+		if !assign {
+			ed.disp.SetStatus(name + "=" + ed.lineEnding.String())
+			return nil
+		}
+		style, err := eol.Parse(value)
+		if err != nil {
+			return err
+		}
+		ed.lineEnding = style
+	case "enc", "encoding", "fenc", "fileencoding":
+		if !assign {
+			ed.disp.SetStatus(name + "=" + ed.encoding.String())
+			return nil
+		}
+		enc, err := charset.Parse(value)
+		if err != nil {
+			return err
+		}
+		ed.encoding = enc
+	default:
+		return fmt.Errorf("Unknown option: %s", name)
+	}
+	ed.updateStatusInfo()
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/psanford/hat/eol"
+)
+
+func TestSetOptionsPrompt(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          []string
+		expectEOL      eol.Style
+		expectEncoding string
+		expectStatus   string
+	}{
+		{
+			name:           "Line endings",
+			input:          []string{"\x1bs", "ff=crlf\r"},
+			expectEOL:      eol.CRLF,
+			expectEncoding: "utf-8",
+		},
+		{
+			name:           "Several options",
+			input:          []string{"\x1bs", "eol=cr enc=utf-16le\r"},
+			expectEOL:      eol.CR,
+			expectEncoding: "utf-16le",
+		},
+		{
+			name:           "Show a value",
+			input:          []string{"\x1bs", "fenc\r"},
+			expectEOL:      eol.LF,
+			expectEncoding: "utf-8",
+			expectStatus:   "fenc=utf-8",
+		},
+		{
+			name:           "Unknown option",
+			input:          []string{"\x1bs", "ff=crlf tw=80\r"},
+			expectEOL:      eol.CRLF,
+			expectEncoding: "utf-8",
+			expectStatus:   "Unknown option: tw",
+		},
+		{
+			name:           "Bad value",
+			input:          []string{"\x1bs", "enc=klingon\r"},
+			expectEOL:      eol.LF,
+			expectEncoding: "utf-8",
+			expectStatus:   `unknown encoding "klingon"`,
+		},
+		{
+			name:           "Canceled",
+			input:          []string{"\x1bs", "ff=crlf", "\x07"},
+			expectEOL:      eol.LF,
+			expectEncoding: "utf-8",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := newTestEditor(t, "abc\n")
+			for _, in := range tc.input {
+				ed.feed(in)
+			}
+
+			if ed.prompt != nil {
+				t.Fatalf("prompt still open")
+			}
+			if ed.lineEnding != tc.expectEOL {
+				t.Errorf("got line endings %s expected %s", ed.lineEnding, tc.expectEOL)
+			}
+			if got := ed.encoding.String(); got != tc.expectEncoding {
+				t.Errorf("got encoding %s expected %s", got, tc.expectEncoding)
+			}
+			if got := ed.disp.Status(); got != tc.expectStatus {
+				t.Errorf("got status %q expected %q", got, tc.expectStatus)
+			}
+			if got := ed.text(); got != "abc\n" {
+				t.Errorf("text changed to %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package piecetable
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	pageSize = 64 << 10
+	// at most this many pages of the file are kept in memory
+	maxPages = 64
+)
+
+// pagedFile reads the original text from a file, keeping a small LRU
+// cache of the pages around the most recent reads.
+type pagedFile struct {
+	r    io.ReaderAt
+	size int
+
+	mu    sync.Mutex
+	pages map[int][]byte
+	// page numbers, least recently used first
+	lru []int
+}
+
+// NewFile creates a PieceTable whose initial contents are the first size
+// bytes of r. The text is read from r as needed rather than loaded into
+// memory, only the newline offsets and recently read pages are kept.
+// Inserted text is held in memory as usual. r must not change while the
+// PieceTable is in use.
+func NewFile(r io.ReaderAt, size int64) (*PieceTable, error) {
+	f := &pagedFile{
+		r:     r,
+		size:  int(size),
+		pages: make(map[int][]byte),
+	}
+
+	origLines, err := f.newlines()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &PieceTable{
+		file:      f,
+		origLines: origLines,
+	}
+	if size > 0 {
+		t.pieces = append(t.pieces, piece{
+			start:   0,
+			len:     int(size),
+			nlStart: 0,
+			nlCount: len(origLines),
+		})
+	}
+	t.reindex(0)
+	return t, nil
+}
+
+// SetFile makes a table created by NewFile read its original text from
+// r from now on, so that the reader it was created with can change. r
+// must hold the same bytes. It does nothing for other tables.
+func (t *PieceTable) SetFile(r io.ReaderAt) {
+	if t.file == nil {
+		return
+	}
+	t.file.mu.Lock()
+	t.file.r = r
+	t.file.mu.Unlock()
+}
+
+// newlines scans the file for newlines without keeping it in memory.
+func (f *pagedFile) newlines() ([]int, error) {
+	var idx []int
+	buf := make([]byte, pageSize)
+	for off := 0; off < f.size; off += pageSize {
+		n, err := f.r.ReadAt(buf[:min(pageSize, f.size-off)], int64(off))
+		if err != nil && !(err == io.EOF && off+n == f.size) {
+			return nil, err
+		}
+		idx = newlines(idx, buf[:n], off)
+	}
+	return idx, nil
+}
+
+// readAt copies the file at off into p.
+func (f *pagedFile) readAt(p []byte, off int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int
+	for n < len(p) && off+n < f.size {
+		pos := off + n
+		page, err := f.page(pos / pageSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], page[pos%pageSize:])
+	}
+	return n, nil
+}
+
+// writeRange streams [start, end) of the file to w, bypassing the cache.
+func (f *pagedFile) writeRange(w io.Writer, start, end int) (int64, error) {
+	return io.Copy(w, io.NewSectionReader(f.r, int64(start), int64(end-start)))
+}
+
+func (f *pagedFile) page(i int) ([]byte, error) {
+	if page, ok := f.pages[i]; ok {
+		f.touch(i)
+		return page, nil
+	}
+
+	if len(f.lru) >= maxPages {
+		delete(f.pages, f.lru[0])
+		f.lru = f.lru[1:]
+	}
+
+	start := i * pageSize
+	page := make([]byte, min(pageSize, f.size-start))
+	n, err := f.r.ReadAt(page, int64(start))
+	if n < len(page) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	f.pages[i] = page
+	f.lru = append(f.lru, i)
+	return page, nil
+}
+
+func (f *pagedFile) touch(i int) {
+	for j, p := range f.lru {
+		if p == i {
+			copy(f.lru[j:], f.lru[j+1:])
+			f.lru[len(f.lru)-1] = i
+			return
+		}
+	}
+}
+
+// cachedPages returns the number of pages currently in memory.
+func (f *pagedFile) cachedPages() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.pages)
+}
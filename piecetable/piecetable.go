@@ -0,0 +1,683 @@
+// piecetable implements a piece table text buffer.
+package piecetable
+
+// piece table basics:
+// the original text is kept read-only and everything that gets inserted
+// is appended to an add buffer. The document is a list of pieces, each
+// one a span of either buffer. Edits only split and remove pieces so the
+// cost of an edit depends on the number of pieces rather than the size
+// of the text, and a snapshot only needs a copy of the piece list.
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/psanford/hat/textbuffer"
+)
+
+type PieceTable struct {
+	orig []byte
+	add  []byte
+
+	// for tables created by NewFile the original text is read from file
+	// instead of orig
+	file *pagedFile
+
+	// offsets of the newlines in orig and add, in ascending order
+	origLines []int
+	addLines  []int
+
+	pieces []piece
+
+	// starts[i] is the offset of pieces[i] in the document and lines[i]
+	// the number of newlines before it. Both have a final entry for the
+	// end of the document.
+	starts []int
+	lines  []int
+
+	pos int
+
+	anchors   textbuffer.Anchors
+	listeners textbuffer.Listeners
+}
+
+type piece struct {
+	add   bool
+	start int
+	len   int
+
+	// the newlines in this piece are nlStart..nlStart+nlCount in the
+	// line index of its buffer
+	nlStart int
+	nlCount int
+}
+
+// New creates a PieceTable with b as its initial contents. The
+// PieceTable takes ownership of b.
+func New(b []byte) *PieceTable {
+	t := &PieceTable{
+		orig:      b,
+		origLines: newlines(nil, b, 0),
+	}
+	if len(b) > 0 {
+		t.pieces = append(t.pieces, piece{
+			start:   0,
+			len:     len(b),
+			nlStart: 0,
+			nlCount: len(t.origLines),
+		})
+	}
+	t.reindex(0)
+	return t
+}
+
+// Snapshot returns a read only copy of the text. It costs the same as
+// Clone.
+func (t *PieceTable) Snapshot() *textbuffer.Snapshot {
+	// nothing edits the clone, and the text it shares is never
+	// overwritten, so concurrent reads are safe
+	return textbuffer.NewSnapshot(t.Clone(), t.Size())
+}
+
+// Clone returns an independent copy of t. The text itself is shared so
+// the cost is proportional to the number of pieces.
+func (t *PieceTable) Clone() *PieceTable {
+	return &PieceTable{
+		orig:      t.orig,
+		file:      t.file,
+		origLines: t.origLines,
+		// cap the add buffer so appends by either table never write
+		// into memory the other one can see
+		add:      t.add[:len(t.add):len(t.add)],
+		addLines: t.addLines[:len(t.addLines):len(t.addLines)],
+		pieces:   slices.Clone(t.pieces),
+		starts:   slices.Clone(t.starts),
+		lines:    slices.Clone(t.lines),
+		pos:      t.pos,
+	}
+}
+
+func (t *PieceTable) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+
+	switch whence {
+	case io.SeekCurrent:
+		abs = int64(t.pos) + offset
+	case io.SeekStart:
+		abs = offset
+	case io.SeekEnd:
+		abs = int64(t.Size()) - offset
+	default:
+		return 0, errors.New("PieceTable.Seek: invalid whence")
+	}
+
+	if abs < 0 {
+		return 0, errors.New("PieceTable.Seek: negative position")
+	}
+
+	if abs > int64(t.Size()) {
+		abs = int64(t.Size())
+	}
+
+	t.pos = int(abs)
+	return abs, nil
+}
+
+func (t *PieceTable) Insert(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	start := len(t.add)
+	t.add = append(t.add, p...)
+	t.addPiece(start)
+
+	return len(p), nil
+}
+
+// ReadFrom inserts everything read from r at the cursor, reading
+// directly into the add buffer.
+func (t *PieceTable) ReadFrom(r io.Reader) (int64, error) {
+	start := len(t.add)
+	for {
+		if cap(t.add)-len(t.add) < 512 {
+			t.add = slices.Grow(t.add, max(512, len(t.add)-start))
+		}
+
+		n, err := r.Read(t.add[len(t.add):cap(t.add)])
+		t.add = t.add[:len(t.add)+n]
+		if err != nil {
+			t.addPiece(start)
+			if err == io.EOF {
+				err = nil
+			}
+			return int64(len(t.add) - start), err
+		}
+	}
+}
+
+// addPiece inserts a piece at the cursor for add[start:], which was
+// just appended, and moves the cursor past it.
+func (t *PieceTable) addPiece(start int) {
+	size := len(t.add) - start
+	if size == 0 {
+		return
+	}
+	defer t.inserted(start)
+
+	nlStart := len(t.addLines)
+	t.addLines = newlines(t.addLines, t.add[start:], start)
+	nlCount := len(t.addLines) - nlStart
+
+	i := t.split(t.pos)
+	if i > 0 {
+		// typing appends to the piece we just inserted, so extend it
+		// rather than adding a piece per keystroke
+		prev := &t.pieces[i-1]
+		if prev.add && prev.start+prev.len == start {
+			prev.len += size
+			prev.nlCount += nlCount
+			t.reindex(i - 1)
+			t.anchors.Inserted(t.pos, size)
+			t.pos += size
+			return
+		}
+	}
+
+	t.pieces = slices.Insert(t.pieces, i, piece{
+		add:     true,
+		start:   start,
+		len:     size,
+		nlStart: nlStart,
+		nlCount: nlCount,
+	})
+	t.reindex(i)
+	t.anchors.Inserted(t.pos, size)
+	t.pos += size
+}
+
+// inserted notifies listeners of add[start:], which was just inserted
+// before the cursor.
+func (t *PieceTable) inserted(start int) {
+	t.listeners.Edited()
+	if !t.listeners.Active() {
+		return
+	}
+	size := len(t.add) - start
+	t.listeners.Notify(textbuffer.Change{
+		Offset: t.pos - size,
+		// the add buffer is only ever appended to, so listeners can
+		// keep this without a copy
+		Inserted:     t.add[start:len(t.add):len(t.add)],
+		CursorBefore: t.pos - size,
+		CursorAfter:  t.pos,
+	})
+}
+
+// Delete removes up to n bytes before the cursor and returns them.
+func (t *PieceTable) Delete(n int) []byte {
+	if n > t.pos {
+		n = t.pos
+	}
+	return t.DeleteRange(t.pos-n, t.pos)
+}
+
+// DeleteForward removes up to n bytes after the cursor and returns them.
+func (t *PieceTable) DeleteForward(n int) []byte {
+	return t.DeleteRange(t.pos, t.pos+n)
+}
+
+// DeleteRange removes the bytes in [start, end) and leaves the cursor at
+// start.
+func (t *PieceTable) DeleteRange(start, end int) []byte {
+	start, end = t.clampOffset(start), t.clampOffset(end)
+	if start > end {
+		start, end = end, start
+	}
+
+	out := make([]byte, end-start)
+	t.ReadAt(out, int64(start))
+
+	cursor := t.pos
+	t.pos = start
+	if start < end {
+		first := t.split(start)
+		last := t.split(end)
+		t.pieces = slices.Delete(t.pieces, first, last)
+		t.reindex(first)
+		t.anchors.Deleted(start, end)
+		t.listeners.Edited()
+		if t.listeners.Active() {
+			t.listeners.Notify(textbuffer.Change{
+				Offset:       start,
+				Removed:      out,
+				CursorBefore: cursor,
+				CursorAfter:  start,
+			})
+		}
+	}
+
+	return out
+}
+
+func (t *PieceTable) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("PieceTable.ReadAt: negative offset")
+	}
+	if off > int64(t.Size()) {
+		return 0, io.EOF
+	}
+
+	var n int
+	for i := t.pieceAt(int(off)); i < len(t.pieces) && n < len(p); i++ {
+		pc := t.pieces[i]
+		skip := int(off) + n - t.starts[i]
+		m, err := t.readPiece(p[n:], pc, skip)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Bytes returns the bytes in [start, end). If the range is within a
+// single piece held in memory the returned slice aliases the text,
+// otherwise it is a copy. It must not be modified.
+func (t *PieceTable) Bytes(start, end int) []byte {
+	start, end = t.clampOffset(start), t.clampOffset(end)
+	if start > end {
+		start, end = end, start
+	}
+
+	if i := t.pieceAt(start); i < len(t.pieces) && end <= t.starts[i+1] {
+		pc := t.pieces[i]
+		if text, ok := t.memText(pc); ok {
+			return text[start-t.starts[i] : end-t.starts[i]]
+		}
+	}
+
+	out := make([]byte, end-start)
+	t.ReadAt(out, int64(start))
+	return out
+}
+
+// WriteTo writes the whole text to w, independent of the cursor. Text
+// that is still in the file given to NewFile is streamed from it.
+func (t *PieceTable) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, pc := range t.pieces {
+		var (
+			n   int64
+			err error
+		)
+		if text, ok := t.memText(pc); ok {
+			var m int
+			m, err = w.Write(text)
+			n = int64(m)
+		} else {
+			n, err = t.file.writeRange(w, pc.start, pc.start+pc.len)
+		}
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// ReadRune reads the rune after the cursor and advances past it.
+// Invalid UTF-8 is returned as utf8.RuneError with a size of 1.
+func (t *PieceTable) ReadRune() (r rune, size int, err error) {
+	var b [utf8.UTFMax]byte
+	n, _ := t.ReadAt(b[:], int64(t.pos))
+	if n == 0 {
+		return 0, 0, io.EOF
+	}
+	r, size = utf8.DecodeRune(b[:n])
+	t.pos += size
+	return r, size, nil
+}
+
+// UnreadRune moves the cursor back over the rune before it. Unlike most
+// io.RuneScanners it doesn't need a preceding ReadRune, so it can be
+// used to walk the text backwards.
+func (t *PieceTable) UnreadRune() error {
+	_, size, err := t.PrevRune()
+	if err != nil {
+		return err
+	}
+	t.pos -= size
+	return nil
+}
+
+// PrevRune returns the rune before the cursor without moving it.
+func (t *PieceTable) PrevRune() (r rune, size int, err error) {
+	if t.pos == 0 {
+		return 0, 0, io.EOF
+	}
+	start := max(0, t.pos-utf8.UTFMax)
+	b := make([]byte, t.pos-start)
+	t.ReadAt(b, int64(start))
+	r, size = utf8.DecodeLastRune(b)
+	return r, size, nil
+}
+
+func (t *PieceTable) Read(p []byte) (int, error) {
+	n, err := t.ReadAt(p, int64(t.pos))
+	t.pos += n
+	return n, err
+}
+
+func (t *PieceTable) Size() int {
+	return t.starts[len(t.pieces)]
+}
+
+// NewAnchor returns an anchor at offset that is kept up to date as the
+// text is edited.
+func (t *PieceTable) NewAnchor(offset int, g textbuffer.Gravity) *textbuffer.Anchor {
+	return t.anchors.NewAnchor(t.clampOffset(offset), g)
+}
+
+// RemoveAnchor stops updating a.
+func (t *PieceTable) RemoveAnchor(a *textbuffer.Anchor) {
+	t.anchors.RemoveAnchor(a)
+}
+
+// Listen registers f to be called after every edit to the table.
+func (t *PieceTable) Listen(f func(textbuffer.Change)) (cancel func()) {
+	return t.listeners.Listen(f)
+}
+
+// Edits returns the number of edits made to the table.
+func (t *PieceTable) Edits() int {
+	return t.listeners.Edits()
+}
+
+// GetLine returns the start and end of the nth line relative to the current position.
+// endPos will be the pos of the new line character unless it is the final line
+// with no newline character.
+// If offset is out of bounds startPos and endPost will be -1
+func (t *PieceTable) GetLine(offset int) (startPos, endPos int) {
+	line := t.LineAt(t.pos) + offset
+	if line < 0 || line > t.newlineCount() {
+		return -1, -1
+	}
+
+	start := t.lineStart(line)
+	if line < t.newlineCount() {
+		return start, t.newlinePos(line)
+	}
+
+	// the final line has no newline
+	if offset > 0 {
+		return start, t.Size()
+	}
+	end := t.Size() - 1
+	if start == end+1 {
+		end = start
+	}
+	return start, end
+}
+
+// LineCount returns the number of lines in the buffer. A trailing
+// newline starts a final empty line.
+func (t *PieceTable) LineCount() int {
+	return t.newlineCount() + 1
+}
+
+// LineAt returns the zero based line number containing offset.
+func (t *PieceTable) LineAt(offset int) int {
+	if offset <= 0 {
+		return 0
+	}
+	if offset >= t.Size() {
+		return t.newlineCount()
+	}
+
+	i := t.pieceAt(offset)
+	pc := t.pieces[i]
+	idx := t.lineIndex(pc)
+	bufOff := pc.start + offset - t.starts[i]
+	return t.lines[i] + sort.SearchInts(idx, bufOff)
+}
+
+// LineStart returns the offset of the start of the zero based line, or
+// -1 if the buffer doesn't have that many lines.
+func (t *PieceTable) LineStart(line int) int {
+	if line < 0 || line > t.newlineCount() {
+		return -1
+	}
+	return t.lineStart(line)
+}
+
+// LineEnd returns the offset of the newline ending the zero based line,
+// or the size of the buffer for the last line. It returns -1 if the
+// buffer doesn't have that many lines.
+func (t *PieceTable) LineEnd(line int) int {
+	if line < 0 || line > t.newlineCount() {
+		return -1
+	}
+	if line == t.newlineCount() {
+		return t.Size()
+	}
+	return t.newlinePos(line)
+}
+
+// LineCol returns the zero based line and byte column of offset.
+func (t *PieceTable) LineCol(offset int) (line, col int) {
+	offset = t.clampOffset(offset)
+	line = t.LineAt(offset)
+	return line, offset - t.lineStart(line)
+}
+
+// LineRuneCol returns the zero based line and rune column of offset.
+func (t *PieceTable) LineRuneCol(offset int) (line, col int) {
+	offset = t.clampOffset(offset)
+	line = t.LineAt(offset)
+	start := t.lineStart(line)
+
+	p := make([]byte, offset-start)
+	t.ReadAt(p, int64(start))
+	return line, utf8.RuneCount(p)
+}
+
+// LineColOffset returns the offset of byte column col of the zero based
+// line. Lines past the end of the buffer are clamped to the last line and
+// columns past the end of the line to the end of the line.
+func (t *PieceTable) LineColOffset(line, col int) int {
+	line = t.clampLine(line)
+	start, end := t.lineStart(line), t.LineEnd(line)
+	if col < 0 {
+		col = 0
+	}
+	if start+col > end {
+		return end
+	}
+	return start + col
+}
+
+// LineRuneColOffset is LineColOffset with a rune column instead of a
+// byte column.
+func (t *PieceTable) LineRuneColOffset(line, col int) int {
+	line = t.clampLine(line)
+	start, end := t.lineStart(line), t.LineEnd(line)
+
+	p := make([]byte, end-start)
+	t.ReadAt(p, int64(start))
+
+	off := start
+	for i := 0; i < col && len(p) > 0; i++ {
+		_, size := utf8.DecodeRune(p)
+		p = p[size:]
+		off += size
+	}
+	return off
+}
+
+// SeekLine moves the cursor to the start of the zero based line. Lines
+// past the end of the buffer move to the last line.
+func (t *PieceTable) SeekLine(line int) (int64, error) {
+	return t.SeekLineCol(line, 0)
+}
+
+// SeekLineCol moves the cursor to byte column col of the zero based
+// line, clamped as in LineColOffset.
+func (t *PieceTable) SeekLineCol(line, col int) (int64, error) {
+	if line < 0 {
+		return 0, errors.New("PieceTable.SeekLine: negative line")
+	}
+	return t.Seek(int64(t.LineColOffset(line, col)), io.SeekStart)
+}
+
+// Pieces returns the number of pieces the text is split into.
+func (t *PieceTable) Pieces() int {
+	return len(t.pieces)
+}
+
+// split makes sure a piece starts at off and returns its index, or
+// len(t.pieces) if off is the end of the document.
+func (t *PieceTable) split(off int) int {
+	i := t.pieceAt(off)
+	if i == len(t.pieces) || t.starts[i] == off {
+		return i
+	}
+
+	pc := t.pieces[i]
+	at := off - t.starts[i]
+	leftCount := sort.SearchInts(t.lineIndex(pc), pc.start+at)
+
+	left := pc
+	left.len = at
+	left.nlCount = leftCount
+
+	right := pc
+	right.start += at
+	right.len -= at
+	right.nlStart += leftCount
+	right.nlCount -= leftCount
+
+	t.pieces[i] = left
+	t.pieces = slices.Insert(t.pieces, i+1, right)
+	t.reindex(i)
+	return i + 1
+}
+
+// pieceAt returns the index of the piece containing off, or
+// len(t.pieces) if off is the end of the document.
+func (t *PieceTable) pieceAt(off int) int {
+	return sort.Search(len(t.pieces), func(i int) bool {
+		return t.starts[i+1] > off
+	})
+}
+
+// reindex recomputes starts and lines from piece i onwards.
+func (t *PieceTable) reindex(i int) {
+	n := len(t.pieces) + 1
+	if cap(t.starts) < n {
+		t.starts = slices.Grow(t.starts[:0], n)
+		t.lines = slices.Grow(t.lines[:0], n)
+		i = 0
+	}
+	t.starts = t.starts[:n]
+	t.lines = t.lines[:n]
+
+	if i == 0 {
+		t.starts[0] = 0
+		t.lines[0] = 0
+	}
+	for ; i < len(t.pieces); i++ {
+		t.starts[i+1] = t.starts[i] + t.pieces[i].len
+		t.lines[i+1] = t.lines[i] + t.pieces[i].nlCount
+	}
+}
+
+// memText returns the text of pc if it is held in memory.
+func (t *PieceTable) memText(pc piece) ([]byte, bool) {
+	if pc.add {
+		return t.add[pc.start : pc.start+pc.len], true
+	}
+	if t.file != nil {
+		return nil, false
+	}
+	return t.orig[pc.start : pc.start+pc.len], true
+}
+
+// readPiece copies the text of pc starting skip bytes in to p.
+func (t *PieceTable) readPiece(p []byte, pc piece, skip int) (int, error) {
+	if text, ok := t.memText(pc); ok {
+		return copy(p, text[skip:]), nil
+	}
+	p = p[:min(len(p), pc.len-skip)]
+	return t.file.readAt(p, pc.start+skip)
+}
+
+// lineIndex returns the buffer offsets of the newlines in pc.
+func (t *PieceTable) lineIndex(pc piece) []int {
+	idx := t.origLines
+	if pc.add {
+		idx = t.addLines
+	}
+	return idx[pc.nlStart : pc.nlStart+pc.nlCount]
+}
+
+func (t *PieceTable) newlineCount() int {
+	return t.lines[len(t.pieces)]
+}
+
+// newlinePos returns the offset of the ith newline in the document.
+func (t *PieceTable) newlinePos(i int) int {
+	j := sort.Search(len(t.pieces), func(j int) bool {
+		return t.lines[j+1] > i
+	})
+	pc := t.pieces[j]
+	return t.starts[j] + t.lineIndex(pc)[i-t.lines[j]] - pc.start
+}
+
+func (t *PieceTable) lineStart(line int) int {
+	if line == 0 {
+		return 0
+	}
+	return t.newlinePos(line-1) + 1
+}
+
+func (t *PieceTable) clampLine(line int) int {
+	if line < 0 {
+		return 0
+	}
+	if line > t.newlineCount() {
+		return t.newlineCount()
+	}
+	return line
+}
+
+func (t *PieceTable) clampOffset(offset int) int {
+	if offset < 0 {
+		return 0
+	}
+	if offset > t.Size() {
+		return t.Size()
+	}
+	return offset
+}
+
+// newlines appends the offsets of the newlines in p, shifted by base, to
+// idx.
+func newlines(idx []int, p []byte, base int) []int {
+	for i := 0; ; {
+		nl := bytes.IndexByte(p[i:], '\n')
+		if nl < 0 {
+			return idx
+		}
+		idx = append(idx, base+i+nl)
+		i += nl + 1
+	}
+}
@@ -0,0 +1,230 @@
+package piecetable
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/psanford/hat/textbuffer"
+	"github.com/psanford/hat/textbuffer/textbuffertest"
+)
+
+func TestConformance(t *testing.T) {
+	textbuffertest.Run(t, func(initial []byte) textbuffer.TextBuffer {
+		return New(initial)
+	})
+}
+
+func TestFileConformance(t *testing.T) {
+	textbuffertest.Run(t, func(initial []byte) textbuffer.TextBuffer {
+		pt, err := NewFile(bytes.NewReader(initial), int64(len(initial)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pt
+	})
+}
+
+// patternFile is a large file that is never held in memory.
+type patternFile struct {
+	size  int
+	reads int
+}
+
+func (f *patternFile) byteAt(i int) byte {
+	if i%80 == 79 {
+		return '\n'
+	}
+	return 'a' + byte(i%26)
+}
+
+func (f *patternFile) ReadAt(p []byte, off int64) (int, error) {
+	f.reads++
+	n := 0
+	for ; n < len(p) && int(off)+n < f.size; n++ {
+		p[n] = f.byteAt(int(off) + n)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestFileWindowed(t *testing.T) {
+	f := &patternFile{size: 100 << 20}
+	pt, err := NewFile(f, int64(f.size))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, expect := pt.LineCount(), f.size/80+1; got != expect {
+		t.Fatalf("LineCount got %d expected %d", got, expect)
+	}
+
+	// jump around the file like a viewport would
+	for _, line := range []int{0, 1000000, 5, 1300000, 700000} {
+		start := pt.LineStart(line)
+		got := pt.Bytes(start, pt.LineEnd(line)+1)
+		if len(got) != 80 || got[79] != '\n' || got[0] != f.byteAt(start) {
+			t.Fatalf("line %d got %q", line, got)
+		}
+	}
+	if got := pt.file.cachedPages(); got > maxPages {
+		t.Fatalf("%d pages cached, expected at most %d", got, maxPages)
+	}
+
+	pt.SeekLine(1000000)
+	pt.Insert([]byte("edit\n"))
+	pt.DeleteRange(10, 20)
+
+	out := checkWriter{bad: -1}
+	out.expect = func(i int) byte {
+		switch {
+		case i < 10:
+			return f.byteAt(i)
+		case i < 80000000-10:
+			return f.byteAt(i + 10)
+		case i < 80000000-5:
+			return "edit\n"[i-(80000000-10)]
+		}
+		return f.byteAt(i + 5)
+	}
+	n, err := pt.WriteTo(&out)
+	if err != nil || n != int64(f.size-5) {
+		t.Fatalf("WriteTo got %d, %v expected %d", n, err, f.size-5)
+	}
+	if out.bad >= 0 {
+		t.Fatalf("WriteTo output differs at %d", out.bad)
+	}
+}
+
+func TestFileSetFile(t *testing.T) {
+	old := &patternFile{size: 8000000}
+	pt, err := NewFile(old, int64(old.size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt.SeekLine(10)
+	pt.Insert([]byte("edit\n"))
+
+	f := &patternFile{size: old.size}
+	pt.SetFile(f)
+	reads := old.reads
+
+	start := pt.LineStart(90000)
+	if got := pt.Bytes(start, pt.LineEnd(90000)+1); len(got) != 80 || got[0] != f.byteAt(start-5) {
+		t.Fatalf("got %q", got)
+	}
+	out := checkWriter{bad: -1}
+	out.expect = func(i int) byte {
+		switch {
+		case i < 800:
+			return f.byteAt(i)
+		case i < 805:
+			return "edit\n"[i-800]
+		}
+		return f.byteAt(i - 5)
+	}
+	if _, err := pt.WriteTo(&out); err != nil || out.bad >= 0 {
+		t.Fatalf("WriteTo got %v, output differs at %d", err, out.bad)
+	}
+
+	if old.reads != reads {
+		t.Errorf("%d reads from the old file after SetFile", old.reads-reads)
+	}
+	if f.reads == 0 {
+		t.Errorf("no reads from the new file")
+	}
+}
+
+// checkWriter compares what is written to it against expect, recording
+// the offset of the first difference in bad.
+type checkWriter struct {
+	n      int
+	bad    int
+	expect func(int) byte
+}
+
+func (w *checkWriter) Write(p []byte) (int, error) {
+	for i, c := range p {
+		if w.bad < 0 && c != w.expect(w.n+i) {
+			w.bad = w.n + i
+		}
+	}
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestTypingCoalesces(t *testing.T) {
+	pt := New([]byte("hello world"))
+	pt.Seek(5, io.SeekStart)
+
+	for _, c := range ", there" {
+		pt.Insert([]byte(string(c)))
+	}
+
+	if got := pt.Pieces(); got != 3 {
+		t.Fatalf("got %d pieces expected 3", got)
+	}
+	expectText(t, pt, "hello, there world")
+}
+
+func TestClone(t *testing.T) {
+	pt := New([]byte("one\ntwo\n"))
+	pt.Seek(0, io.SeekEnd)
+	pt.Insert([]byte("three"))
+
+	snap := pt.Clone()
+
+	pt.Insert([]byte("\nfour"))
+	pt.DeleteRange(0, 4)
+
+	snap.Seek(0, io.SeekEnd)
+	snap.Insert([]byte("!"))
+
+	expectText(t, pt, "two\nthree\nfour")
+	expectText(t, snap, "one\ntwo\nthree!")
+
+	if got := snap.LineCount(); got != 3 {
+		t.Errorf("snapshot LineCount got %d expected 3", got)
+	}
+	if got := pt.LineCount(); got != 3 {
+		t.Errorf("LineCount got %d expected 3", got)
+	}
+}
+
+func TestScatteredEdits(t *testing.T) {
+	orig := make([]byte, 1<<20)
+	for i := range orig {
+		orig[i] = 'a' + byte(i%26)
+		if i%80 == 79 {
+			orig[i] = '\n'
+		}
+	}
+
+	pt := New(orig)
+	lines := pt.LineCount()
+
+	for i := 0; i < 1000; i++ {
+		off := (i * 7919) % pt.Size()
+		pt.Seek(int64(off), io.SeekStart)
+		pt.Insert([]byte("x\n"))
+	}
+
+	if got := pt.LineCount(); got != lines+1000 {
+		t.Fatalf("LineCount got %d expected %d", got, lines+1000)
+	}
+	if pt.Size() != len(orig)+2000 {
+		t.Fatalf("Size got %d expected %d", pt.Size(), len(orig)+2000)
+	}
+}
+
+func expectText(t *testing.T, pt *PieceTable, expect string) {
+	t.Helper()
+
+	got := make([]byte, pt.Size())
+	pt.ReadAt(got, 0)
+	if string(got) != expect {
+		t.Fatalf("got %q expected %q", got, expect)
+	}
+}
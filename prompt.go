@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/psanford/hat/ansiraw"
+)
+
+// linePrompt is a line of text being entered on the status line.
+type linePrompt struct {
+	label string
+	text  []rune
+	// done is called with the text when enter is pressed. A non-nil
+	// error is shown on the status line.
+	done func(text string) error
+}
+
+// startPrompt asks for a line of text on the status line, showing label
+// before it.
+func (ed *editor) startPrompt(label string, done func(text string) error) {
+	ed.prompt = &linePrompt{label: label, done: done}
+	ed.disp.EnableStatusLine()
+	ed.drawPrompt()
+}
+
+func (ed *editor) drawPrompt() {
+	p := ed.prompt
+	ed.disp.SetPrompt(p.label+string(p.text), len([]rune(p.label))+len(p.text))
+}
+
+// handlePromptKey edits the text of the prompt. Enter finishes it,
+// escape and ctrl-g cancel it, as does backspace when it is empty.
+func (ed *editor) handlePromptKey(k ansiraw.Key) {
+	p := ed.prompt
+
+	switch {
+	case k.Code == ansiraw.KeyEnter:
+		ed.prompt = nil
+		ed.disp.ClearPrompt()
+		if err := p.done(string(p.text)); err != nil {
+			ed.disp.SetStatus(err.Error())
+		}
+	case k.Code == ansiraw.KeyEscape,
+		k.Code == ansiraw.KeyRune && k.Mod == ansiraw.ModCtrl && k.Rune == 'g',
+		k.Code == ansiraw.KeyBackspace && len(p.text) == 0:
+		ed.prompt = nil
+		ed.disp.ClearPrompt()
+	case k.Code == ansiraw.KeyBackspace:
+		p.text = p.text[:len(p.text)-1]
+		ed.drawPrompt()
+	case k.Code == ansiraw.KeyRune && k.Mod&^ansiraw.ModShift == 0:
+		p.text = append(p.text, k.Rune)
+		ed.drawPrompt()
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/psanford/hat/ansiraw"
+)
+
+// quoteState tracks a quoted insert started with ctrl-v.
+type quoteState int
+
+const (
+	quoteNone quoteState = iota
+	// the next key is inserted as is
+	quoteNext
+	// the hex digits of a code point are being typed after ctrl-v u
+	quoteCodePoint
+)
+
+// ctrl-v u takes at most this many hex digits
+const maxCodePointDigits = 6
+
+// startQuote starts a quoted insert. The next key is inserted verbatim,
+// or if it is u, the hex digits that follow are inserted as a code
+// point.
+func (ed *editor) startQuote() {
+	ed.quote = quoteNext
+	ed.quoteStatus = ed.disp.Status()
+	ed.disp.SetStatus("^V")
+}
+
+// endQuote finishes a quoted insert, showing msg or restoring the
+// status from before it started.
+func (ed *editor) endQuote(msg string) {
+	ed.quote = quoteNone
+	ed.quoteDigits = ""
+	if msg == "" {
+		msg = ed.quoteStatus
+	}
+	ed.disp.SetStatus(msg)
+}
+
+// insertQuoted inserts raw, the bytes of the key pressed after ctrl-v.
+func (ed *editor) insertQuoted(raw []byte) {
+	if bytes.HasPrefix(raw, []byte{ansiraw.ESC, '['}) && bytes.HasSuffix(raw, []byte("u")) {
+		// the kitty keyboard protocol reports keys like escape and
+		// ctrl-letter as CSI u sequences, insert what they stand for
+		if b, ok := keyBytes(ansiraw.ParseRaw(raw)); ok {
+			raw = b
+		}
+	}
+
+	if string(raw) == "u" {
+		ed.quote = quoteCodePoint
+		ed.disp.SetStatus("U+")
+		return
+	}
+
+	ed.endQuote("")
+	ed.disp.Insert(raw)
+}
+
+// handleQuoteKey handles a key pressed while a quoted insert is
+// pending. It returns false for keys that should get the usual
+// handling.
+func (ed *editor) handleQuoteKey(k keyPress) bool {
+	if ed.quote == quoteNext {
+		// escape sequences and control characters reach the buffer
+		// the way the terminal sent them
+		ed.insertQuoted(k.raw)
+		return true
+	}
+
+	if k.Code == ansiraw.KeyRune && k.Mod == 0 && strings.ContainsRune("0123456789abcdefABCDEF", k.Rune) {
+		ed.quoteDigits += string(k.Rune)
+		if len(ed.quoteDigits) == maxCodePointDigits {
+			ed.insertCodePoint()
+		} else {
+			ed.disp.SetStatus("U+" + strings.ToUpper(ed.quoteDigits))
+		}
+		return true
+	}
+
+	// any other key ends the code point. Enter only does that, other
+	// keys also do what they normally do.
+	ed.insertCodePoint()
+	return k.Code == ansiraw.KeyEnter
+}
+
+// insertCodePoint inserts the character whose code point was typed
+// after ctrl-v u.
+func (ed *editor) insertCodePoint() {
+	digits := ed.quoteDigits
+	if digits == "" {
+		ed.endQuote("")
+		return
+	}
+
+	v, _ := strconv.ParseUint(digits, 16, 32)
+	r := rune(v)
+	if !utf8.ValidRune(r) {
+		ed.endQuote(fmt.Sprintf("Invalid code point U+%s", strings.ToUpper(digits)))
+		return
+	}
+	ed.endQuote("")
+	ed.disp.Insert([]byte(string(r)))
+}
+
+// keyBytes returns what a terminal sends for k without any keyboard
+// protocol extensions. It returns false for keys that are sent as
+// escape sequences.
+func keyBytes(k ansiraw.Key) ([]byte, bool) {
+	switch k.Code {
+	case ansiraw.KeyEnter:
+		return []byte{'\r'}, true
+	case ansiraw.KeyTab:
+		return []byte{'\t'}, true
+	case ansiraw.KeyBackspace:
+		return []byte{0x7f}, true
+	case ansiraw.KeyEscape:
+		return []byte{ansiraw.ESC}, true
+	case ansiraw.KeyRune:
+		switch k.Mod &^ ansiraw.ModShift {
+		case 0:
+			return []byte(string(k.Rune)), true
+		case ansiraw.ModCtrl:
+			switch {
+			case k.Rune == ' ':
+				return []byte{0}, true
+			case k.Rune == '?':
+				return []byte{0x7f}, true
+			case k.Rune >= '@' && k.Rune <= 'z':
+				return []byte{byte(k.Rune) & 0x1f}, true
+			}
+		}
+	}
+	return nil, false
+}
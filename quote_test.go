@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/psanford/ansiterm"
+	"github.com/psanford/hat/ansiraw"
+)
+
+// feed parses input as if it came in one read from the terminal and
+// handles the events.
+func (ed *editor) feed(input string) {
+	if ed.parser == nil {
+		ed.eventChan = make(chan ansiterm.AnsiEvent, 64)
+		ed.parser = ansiterm.CreateParser(ed.eventChan)
+	}
+	ed.parser.Parse([]byte(input))
+	for len(ed.eventChan) > 0 {
+		ed.handleEvent(<-ed.eventChan)
+	}
+}
+
+func TestKeyBytes(t *testing.T) {
+	testCases := []struct {
+		name   string
+		key    ansiraw.Key
+		expect []byte
+		ok     bool
+	}{
+		{"Rune", ansiraw.Key{Code: ansiraw.KeyRune, Rune: 'a'}, []byte("a"), true},
+		{"Shifted rune", ansiraw.Key{Code: ansiraw.KeyRune, Rune: 'A', Mod: ansiraw.ModShift}, []byte("A"), true},
+		{"Multibyte rune", ansiraw.Key{Code: ansiraw.KeyRune, Rune: 'é'}, []byte("é"), true},
+		{"Enter", ansiraw.Key{Code: ansiraw.KeyEnter}, []byte{'\r'}, true},
+		{"Tab", ansiraw.Key{Code: ansiraw.KeyTab}, []byte{'\t'}, true},
+		{"Backspace", ansiraw.Key{Code: ansiraw.KeyBackspace}, []byte{0x7f}, true},
+		{"Escape", ansiraw.Key{Code: ansiraw.KeyEscape}, []byte{0x1b}, true},
+		{"Ctrl letter", ansiraw.Key{Code: ansiraw.KeyRune, Rune: 'c', Mod: ansiraw.ModCtrl}, []byte{0x03}, true},
+		{"Ctrl shifted letter", ansiraw.Key{Code: ansiraw.KeyRune, Rune: 'C', Mod: ansiraw.ModCtrl | ansiraw.ModShift}, []byte{0x03}, true},
+		{"Ctrl space", ansiraw.Key{Code: ansiraw.KeyRune, Rune: ' ', Mod: ansiraw.ModCtrl}, []byte{0x00}, true},
+		{"Ctrl question mark", ansiraw.Key{Code: ansiraw.KeyRune, Rune: '?', Mod: ansiraw.ModCtrl}, []byte{0x7f}, true},
+		{"Ctrl bracket", ansiraw.Key{Code: ansiraw.KeyRune, Rune: '[', Mod: ansiraw.ModCtrl}, []byte{0x1b}, true},
+		{"Ctrl digit", ansiraw.Key{Code: ansiraw.KeyRune, Rune: '1', Mod: ansiraw.ModCtrl}, nil, false},
+		{"Alt rune", ansiraw.Key{Code: ansiraw.KeyRune, Rune: 'a', Mod: ansiraw.ModAlt}, nil, false},
+		{"Arrow", ansiraw.Key{Code: ansiraw.KeyUp}, nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := keyBytes(tc.key)
+			if ok != tc.ok || !bytes.Equal(got, tc.expect) {
+				t.Errorf("got %q, %t expected %q, %t", got, ok, tc.expect, tc.ok)
+			}
+		})
+	}
+}
+
+func TestInsertCodePoint(t *testing.T) {
+	testCases := []struct {
+		name         string
+		digits       string
+		expect       string
+		expectStatus string
+	}{
+		{name: "Ascii", digits: "41", expect: "A"},
+		{name: "Upper case digits", digits: "E9", expect: "é"},
+		{name: "Lower case digits", digits: "e9", expect: "é"},
+		{name: "Leading zeros", digits: "000041", expect: "A"},
+		{name: "Outside the BMP", digits: "1f600", expect: "😀"},
+		{name: "Control character", digits: "1b", expect: "\x1b"},
+		{name: "No digits", digits: "", expect: ""},
+		{name: "Surrogate", digits: "d800", expect: "", expectStatus: "Invalid code point U+D800"},
+		{name: "Too large", digits: "110000", expect: "", expectStatus: "Invalid code point U+110000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := newTestEditor(t, "")
+			ed.quote = quoteCodePoint
+			ed.quoteDigits = tc.digits
+
+			ed.insertCodePoint()
+
+			if got := ed.text(); got != tc.expect {
+				t.Errorf("got text %q expected %q", got, tc.expect)
+			}
+			if got := ed.disp.Status(); got != tc.expectStatus {
+				t.Errorf("got status %q expected %q", got, tc.expectStatus)
+			}
+			if ed.quote != quoteNone || ed.quoteDigits != "" {
+				t.Errorf("quote still pending: %d %q", ed.quote, ed.quoteDigits)
+			}
+		})
+	}
+}
+
+func TestInsertQuoted(t *testing.T) {
+	testCases := []struct {
+		name        string
+		raw         string
+		expect      string
+		expectQuote quoteState
+	}{
+		{name: "Plain byte", raw: "a", expect: "a"},
+		{name: "Control character", raw: "\x03", expect: "\x03"},
+		{name: "Escape sequence", raw: "\x1b[A", expect: "\x1b[A"},
+		{name: "u starts a code point", raw: "u", expect: "", expectQuote: quoteCodePoint},
+		{name: "Kitty escape", raw: "\x1b[27u", expect: "\x1b"},
+		{name: "Kitty enter", raw: "\x1b[13u", expect: "\r"},
+		{name: "Kitty ctrl letter", raw: "\x1b[97;5u", expect: "\x01"},
+		{name: "Kitty shifted letter", raw: "\x1b[97;2u", expect: "a"},
+		{name: "Kitty u", raw: "\x1b[117u", expect: "", expectQuote: quoteCodePoint},
+		{name: "Kitty key without a plain form", raw: "\x1b[97;3u", expect: "\x1b[97;3u"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := newTestEditor(t, "")
+			ed.startQuote()
+
+			ed.insertQuoted([]byte(tc.raw))
+
+			if got := ed.text(); got != tc.expect {
+				t.Errorf("got text %q expected %q", got, tc.expect)
+			}
+			if ed.quote != tc.expectQuote {
+				t.Errorf("got quote state %d expected %d", ed.quote, tc.expectQuote)
+			}
+		})
+	}
+}
+
+func TestQuotedInsertKeys(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  []string
+		expect string
+	}{
+		{
+			name:   "Arrow in the same read",
+			input:  []string{"\x16\x1b[A"},
+			expect: "\x1b[A",
+		},
+		{
+			name:   "Arrow in the next read",
+			input:  []string{"\x16", "\x1b[A"},
+			expect: "\x1b[A",
+		},
+		{
+			name:   "Only the next key is quoted",
+			input:  []string{"a\x16\tb\x1b[D"},
+			expect: "a\tb",
+		},
+		{
+			name:   "Control character",
+			input:  []string{"\x16\x03"},
+			expect: "\x03",
+		},
+		{
+			name:   "Code point ended by enter",
+			input:  []string{"\x16u41\r"},
+			expect: "A",
+		},
+		{
+			name:   "Code point ended by another key",
+			input:  []string{"\x16u", "1f600x"},
+			expect: "😀x",
+		},
+		{
+			name:   "Code point ended by its last digit",
+			input:  []string{"\x16u0000e9e"},
+			expect: "ée",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := newTestEditor(t, "")
+			for _, in := range tc.input {
+				ed.feed(in)
+			}
+
+			if got := ed.text(); got != tc.expect {
+				t.Errorf("got text %q expected %q", got, tc.expect)
+			}
+			if ed.quote != quoteNone {
+				t.Errorf("quote still pending: %d", ed.quote)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/psanford/hat/piecetable"
+)
+
+func TestSaveLargeFile(t *testing.T) {
+	testCases := []struct {
+		name string
+		// link is how the file is reached: directly, by a symlink, or
+		// by one of two hard links
+		link string
+		// sameInode is set if the file is written in place
+		sameInode bool
+		// files is how many names should be in the directory after
+		files int
+	}{
+		{name: "Renamed into place", link: "", files: 1},
+		{name: "Symlink kept", link: "sym", files: 2},
+		{name: "Hard link written in place", link: "hard", sameInode: true, files: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "big.txt")
+			if err := os.WriteFile(target, []byte("one\ntwo\nthree\n"), 0640); err != nil {
+				t.Fatal(err)
+			}
+
+			name := target
+			switch tc.link {
+			case "sym":
+				name = filepath.Join(dir, "sym.txt")
+				if err := os.Symlink("big.txt", name); err != nil {
+					t.Fatal(err)
+				}
+			case "hard":
+				name = filepath.Join(dir, "hard.txt")
+				if err := os.Link(target, name); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, err := os.Stat(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srcFile, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { srcFile.Close() })
+			buf, err := piecetable.NewFile(srcFile, before.Size())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ed := &editor{
+				filename:  name,
+				srcFile:   srcFile,
+				buf:       buf,
+				largeFile: true,
+			}
+
+			// the second save reads the unchanged text from wherever
+			// the first left it
+			for _, edit := range []string{"1 ", "2 "} {
+				ed.buf.Seek(4, io.SeekStart)
+				ed.buf.Insert([]byte(edit))
+				if err := ed.save(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expect := "one\n2 1 two\nthree\n"
+			for _, p := range []string{target, name} {
+				got, err := os.ReadFile(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != expect {
+					t.Errorf("%s got %q expected %q", p, got, expect)
+				}
+			}
+			if got := string(ed.buf.Bytes(0, ed.buf.Size())); got != expect {
+				t.Errorf("buffer got %q expected %q", got, expect)
+			}
+
+			after, err := os.Stat(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if os.SameFile(before, after) != tc.sameInode {
+				t.Errorf("same file got %t expected %t", os.SameFile(before, after), tc.sameInode)
+			}
+			if after.Mode() != before.Mode() {
+				t.Errorf("mode got %s expected %s", after.Mode(), before.Mode())
+			}
+			if fi, err := os.Lstat(name); err != nil || (tc.link == "sym") != (fi.Mode()&os.ModeSymlink != 0) {
+				t.Errorf("%s symlink got %v expected %t", name, fi, tc.link == "sym")
+			}
+
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != tc.files {
+				t.Errorf("temporary files left behind: %v", entries)
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ type MockTerm struct {
 
 	readBuf *bytes.Buffer
 	ctrlCh  chan []byte
+
+	restoreSeqs [][]byte
 }
 
 func NewMock(cols, rows int) *MockTerm {
@@ -72,7 +74,21 @@ func NewMock(cols, rows int) *MockTerm {
 func (t *MockTerm) EnableRawMode() {
 }
 
+func (t *MockTerm) OnRestore(seq []byte) {
+	t.restoreSeqs = append(t.restoreSeqs, seq)
+}
+
 func (t *MockTerm) Restore() {
+	for i := len(t.restoreSeqs) - 1; i >= 0; i-- {
+		t.term.Write(t.restoreSeqs[i])
+	}
+	t.restoreSeqs = nil
+}
+
+// RestoreSeqs returns the escape sequences that will be written by
+// Restore.
+func (t *MockTerm) RestoreSeqs() [][]byte {
+	return t.restoreSeqs
 }
 
 func (t *MockTerm) ReadControl() ([]byte, error) {
@@ -50,3 +50,29 @@ func TestMock(t *testing.T) {
 		t.Fatal(cmp.Diff(screenBuf.Bytes(), expect.Bytes()))
 	}
 }
+
+func TestKittyKeyboard(t *testing.T) {
+	term := NewMock(10, 5)
+	vt := vt100.New(term)
+
+	supported, extra, err := vt.EnableKittyKeyboard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !supported {
+		t.Errorf("expected kitty keyboard to be supported")
+	}
+	if len(extra) != 0 {
+		t.Errorf("unexpected extra bytes %q", extra)
+	}
+
+	expect := [][]byte{[]byte("\x1b[<u")}
+	if !cmp.Equal(term.RestoreSeqs(), expect) {
+		t.Errorf("restore sequences: %s", cmp.Diff(term.RestoreSeqs(), expect))
+	}
+
+	term.Restore()
+	if len(term.RestoreSeqs()) != 0 {
+		t.Errorf("restore sequences not cleared after restore: %q", term.RestoreSeqs())
+	}
+}
@@ -11,6 +11,9 @@ type Terminal interface {
 	EnableRawMode()
 	// Restore terminal to original settings
 	Restore()
+	// OnRestore registers an escape sequence to write when the terminal
+	// is restored. Sequences are written in reverse order of registration.
+	OnRestore(seq []byte)
 	// Size returns the terminal size in number of columns, rows
 	Size() (int, int)
 	Write([]byte) (int, error)
@@ -22,6 +25,8 @@ type Term struct {
 	termios *unix.Termios
 	orig    unix.Termios
 
+	restoreSeqs [][]byte
+
 	fd int
 }
 
@@ -60,7 +65,16 @@ func (t *Term) UnsafeRead(b []byte) (int, error) {
 	return t.File.Read(b)
 }
 
+func (t *Term) OnRestore(seq []byte) {
+	t.restoreSeqs = append(t.restoreSeqs, seq)
+}
+
 func (t *Term) Restore() {
+	for i := len(t.restoreSeqs) - 1; i >= 0; i-- {
+		t.File.Write(t.restoreSeqs[i])
+	}
+	t.restoreSeqs = nil
+
 	if err := unix.IoctlSetTermios(t.fd, ioctlWriteTermios, &t.orig); err != nil {
 		panic(err)
 	}
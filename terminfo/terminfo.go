@@ -0,0 +1,349 @@
+// Package terminfo reads compiled terminfo entries and expands their
+// parameterized capabilities.
+package terminfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Terminfo holds the capabilities of a terminal, keyed by their short
+// terminfo names (el, cup, Ss, ...).
+type Terminfo struct {
+	Names   []string
+	Bools   map[string]bool
+	Numbers map[string]int
+	Strings map[string]string
+}
+
+// Has reports whether the string capability name is present.
+func (t *Terminfo) Has(name string) bool {
+	_, ok := t.Strings[name]
+	return ok
+}
+
+var ErrNotFound = errors.New("terminfo: entry not found")
+
+// Load finds and parses the terminfo entry for the terminal name. The
+// standard ncurses locations are searched.
+func Load(name string) (*Terminfo, error) {
+	if name == "" {
+		return nil, ErrNotFound
+	}
+	if strings.ContainsRune(name, '/') {
+		return nil, fmt.Errorf("terminfo: invalid terminal name %q", name)
+	}
+
+	for _, dir := range searchDirs() {
+		// entries are stored under their first letter, or the hex value
+		// of it on case-insensitive filesystems such as macOS
+		for _, sub := range []string{name[:1], fmt.Sprintf("%x", name[0])} {
+			b, err := os.ReadFile(filepath.Join(dir, sub, name))
+			if err != nil {
+				continue
+			}
+			return Parse(b)
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func searchDirs() []string {
+	var dirs []string
+	if d := os.Getenv("TERMINFO"); d != "" {
+		dirs = append(dirs, d)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".terminfo"))
+	}
+	if d := os.Getenv("TERMINFO_DIRS"); d != "" {
+		for _, dir := range filepath.SplitList(d) {
+			if dir == "" {
+				dir = "/usr/share/terminfo"
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs,
+		"/etc/terminfo",
+		"/lib/terminfo",
+		"/usr/share/terminfo",
+		"/usr/lib/terminfo",
+		"/usr/share/lib/terminfo",
+	)
+}
+
+const (
+	magicLegacy = 0432
+	// numbers are 32 bits instead of 16
+	magic32bit = 01036
+)
+
+// Parse decodes a compiled terminfo entry, including the ncurses
+// extended capabilities section if present.
+func Parse(b []byte) (*Terminfo, error) {
+	r := &reader{b: b}
+
+	magic := r.short()
+	numSize := 2
+	switch magic {
+	case magicLegacy:
+	case magic32bit:
+		numSize = 4
+	default:
+		return nil, fmt.Errorf("terminfo: bad magic number %#o", magic)
+	}
+
+	namesSize := r.short()
+	boolCount := r.short()
+	numCount := r.short()
+	strCount := r.short()
+	tableSize := r.short()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	ti := &Terminfo{
+		Bools:   make(map[string]bool),
+		Numbers: make(map[string]int),
+		Strings: make(map[string]string),
+	}
+
+	names := strings.TrimRight(string(r.bytes(namesSize)), "\x00")
+	ti.Names = strings.Split(names, "|")
+
+	bools := r.bytes(boolCount)
+	r.align()
+	nums := r.numbers(numCount, numSize)
+	offsets := r.numbers(strCount, 2)
+	table := r.bytes(tableSize)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	for i, v := range bools {
+		if name, ok := boolCaps[i]; ok && v == 1 {
+			ti.Bools[name] = true
+		}
+	}
+	for i, v := range nums {
+		if name, ok := numCaps[i]; ok && v >= 0 {
+			ti.Numbers[name] = v
+		}
+	}
+	for i, off := range offsets {
+		if name, ok := stringCaps[i]; ok && off >= 0 {
+			if s, ok := tableString(table, off); ok {
+				ti.Strings[name] = s
+			}
+		}
+	}
+
+	r.align()
+	if r.pos < len(b) {
+		if err := parseExtended(r, ti, numSize); err != nil {
+			return nil, err
+		}
+	}
+
+	return ti, nil
+}
+
+// parseExtended decodes the user defined capabilities that follow the
+// standard ones. Unlike the standard capabilities, these carry their
+// names in the file.
+func parseExtended(r *reader, ti *Terminfo, numSize int) error {
+	boolCount := r.short()
+	numCount := r.short()
+	strCount := r.short()
+	_ = r.short() // number of entries in the string table
+	tableSize := r.short()
+	if r.err != nil {
+		return r.err
+	}
+
+	bools := r.bytes(boolCount)
+	r.align()
+	nums := r.numbers(numCount, numSize)
+	valueOffsets := r.numbers(strCount, 2)
+	nameOffsets := r.numbers(boolCount+numCount+strCount, 2)
+	table := r.bytes(tableSize)
+	if r.err != nil {
+		return r.err
+	}
+
+	// the names are stored after the last string value
+	var namesStart int
+	for _, off := range valueOffsets {
+		if s, ok := tableString(table, off); ok && off+len(s)+1 > namesStart {
+			namesStart = off + len(s) + 1
+		}
+	}
+	if namesStart > len(table) {
+		return errors.New("terminfo: bad extended string table")
+	}
+	names := table[namesStart:]
+
+	name := func(i int) (string, bool) {
+		return tableString(names, nameOffsets[i])
+	}
+
+	for i, v := range bools {
+		if n, ok := name(i); ok && v == 1 {
+			ti.Bools[n] = true
+		}
+	}
+	for i, v := range nums {
+		if n, ok := name(boolCount + i); ok && v >= 0 {
+			ti.Numbers[n] = v
+		}
+	}
+	for i, off := range valueOffsets {
+		n, ok := name(boolCount + numCount + i)
+		if !ok || off < 0 {
+			continue
+		}
+		if s, ok := tableString(table, off); ok {
+			ti.Strings[n] = s
+		}
+	}
+
+	return nil
+}
+
+// tableString returns the nul terminated string at off.
+func tableString(table []byte, off int) (string, bool) {
+	if off < 0 || off >= len(table) {
+		return "", false
+	}
+	end := bytes.IndexByte(table[off:], 0)
+	if end < 0 {
+		return "", false
+	}
+	return string(table[off : off+end]), true
+}
+
+type reader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+var errShort = errors.New("terminfo: entry truncated")
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.b) {
+		r.err = errShort
+		return nil
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) short() int {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(int16(binary.LittleEndian.Uint16(b)))
+}
+
+func (r *reader) numbers(count, size int) []int {
+	b := r.bytes(count * size)
+	if b == nil {
+		return nil
+	}
+	out := make([]int, count)
+	for i := range out {
+		if size == 4 {
+			out[i] = int(int32(binary.LittleEndian.Uint32(b[i*4:])))
+		} else {
+			out[i] = int(int16(binary.LittleEndian.Uint16(b[i*2:])))
+		}
+	}
+	return out
+}
+
+// align skips a padding byte so the next read starts on an even offset.
+func (r *reader) align() {
+	if r.pos%2 == 1 && r.pos < len(r.b) {
+		r.pos++
+	}
+}
+
+// The standard capabilities are stored by index. We only name the ones
+// hat has a use for.
+var boolCaps = map[int]string{
+	1:  "am",
+	28: "bce",
+}
+
+var numCaps = map[int]string{
+	0:  "cols",
+	2:  "lines",
+	13: "colors",
+}
+
+var stringCaps = map[int]string{
+	1:   "bel",
+	2:   "cr",
+	3:   "csr",
+	5:   "clear",
+	6:   "el",
+	7:   "ed",
+	8:   "hpa",
+	10:  "cup",
+	11:  "cud1",
+	12:  "home",
+	13:  "civis",
+	14:  "cub1",
+	16:  "cnorm",
+	17:  "cuf1",
+	19:  "cuu1",
+	20:  "cvvis",
+	21:  "dch1",
+	22:  "dl1",
+	27:  "bold",
+	28:  "smcup",
+	30:  "dim",
+	34:  "rev",
+	35:  "smso",
+	36:  "smul",
+	37:  "ech",
+	39:  "sgr0",
+	40:  "rmcup",
+	43:  "rmso",
+	44:  "rmul",
+	53:  "il1",
+	88:  "rmkx",
+	89:  "smkx",
+	105: "dch",
+	106: "dl",
+	107: "cud",
+	108: "ich",
+	109: "indn",
+	110: "il",
+	111: "cub",
+	112: "cuf",
+	113: "rin",
+	114: "cuu",
+	126: "rc",
+	128: "sc",
+	129: "ind",
+	130: "ri",
+	293: "u6",
+	294: "u7",
+	297: "op",
+	359: "setaf",
+	360: "setab",
+}
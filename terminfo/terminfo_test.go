@@ -0,0 +1,127 @@
+package terminfo
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	t.Setenv("TERMINFO", "testdata")
+	t.Setenv("HOME", t.TempDir())
+
+	xterm, err := Load("xterm-256color")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if xterm.Names[0] != "xterm-256color" {
+		t.Errorf("got names %q", xterm.Names)
+	}
+
+	expectStrings := map[string]string{
+		"el":    "\x1b[K",
+		"cup":   "\x1b[%i%p1%d;%p2%dH",
+		"sc":    "\x1b7",
+		"rc":    "\x1b8",
+		"indn":  "\x1b[%p1%dS",
+		"ind":   "\n",
+		"civis": "\x1b[?25l",
+		"csr":   "\x1b[%i%p1%d;%p2%dr",
+		"il":    "\x1b[%p1%dL",
+		"dl":    "\x1b[%p1%dM",
+		"rev":   "\x1b[7m",
+		"u7":    "\x1b[6n",
+		// extended capabilities
+		"Ss": "\x1b[%p1%d q",
+		"Se": "\x1b[2 q",
+	}
+	for name, expect := range expectStrings {
+		if got := xterm.Strings[name]; got != expect {
+			t.Errorf("%s: got %q expected %q", name, got, expect)
+		}
+	}
+
+	if got := xterm.Numbers["colors"]; got != 256 {
+		t.Errorf("colors: got %d expected 256", got)
+	}
+	if got := xterm.Numbers["cols"]; got != 80 {
+		t.Errorf("cols: got %d expected 80", got)
+	}
+	if !xterm.Bools["am"] {
+		t.Errorf("expected am to be set")
+	}
+
+	dumb, err := Load("dumb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cup", "el", "indn", "csr"} {
+		if dumb.Has(name) {
+			t.Errorf("dumb should not have %s", name)
+		}
+	}
+	if got := dumb.Strings["ind"]; got != "\n" {
+		t.Errorf("dumb ind: got %q", got)
+	}
+
+	_, err = Load("no-such-terminal")
+	if err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	b, err := os.ReadFile("testdata/x/xterm-256color")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{0, 5, 12, 100, 1000} {
+		if _, err := Parse(b[:n]); err == nil {
+			t.Errorf("expected error parsing truncated entry of %d bytes", n)
+		}
+	}
+
+	if _, err := Parse([]byte("not a terminfo file")); err == nil {
+		t.Errorf("expected error for bad magic")
+	}
+}
+
+func TestTparm(t *testing.T) {
+	setaf := "\x1b[%?%p1%{8}%<%t3%p1%d%e%p1%{16}%<%t9%p1%{8}%-%d%e38;5;%p1%d%;m"
+
+	testCases := []struct {
+		cap    string
+		params []int
+		expect string
+	}{
+		{"\x1b[K", nil, "\x1b[K"},
+		{"\x1b[%i%p1%d;%p2%dH", []int{0, 0}, "\x1b[1;1H"},
+		{"\x1b[%i%p1%d;%p2%dH", []int{9, 19}, "\x1b[10;20H"},
+		{"\x1b[%p1%dS", []int{3}, "\x1b[3S"},
+		{setaf, []int{1}, "\x1b[31m"},
+		{setaf, []int{9}, "\x1b[91m"},
+		{setaf, []int{200}, "\x1b[38;5;200m"},
+		{"%p1%02d", []int{7}, "07"},
+		{"%p1%:-3d|", []int{7}, "7  |"},
+		{"%p1%x %p1%X %p1%o", []int{255}, "ff FF 377"},
+		{"%p1%c", []int{'A'}, "A"},
+		{"%'a'%c", nil, "a"},
+		{"%p1%Pa%ga%ga%+%d", []int{4}, "8"},
+		{"%p1%p2%*%d", []int{6, 7}, "42"},
+		{"%?%p1%t1%e%?%p2%t2%e3%;%;", []int{0, 1}, "2"},
+		{"%?%p1%t1%e%?%p2%t2%e3%;%;", []int{0, 0}, "3"},
+		{"%?%p1%t1%e%?%p2%t2%e3%;%;", []int{1, 0}, "1"},
+		{"100%%", nil, "100%"},
+		{"\x1b[K$<3>", nil, "\x1b[K"},
+		{"\x1b[%i%p1%d;%p2%dH$<5>", []int{0, 0}, "\x1b[1;1H"},
+		{"\x1b[J$<50/>x$<2.5*>", nil, "\x1b[Jx"},
+		{"$<*>$<x>$5", nil, "$<*>$<x>$5"},
+	}
+
+	for _, tc := range testCases {
+		if got := Tparm(tc.cap, tc.params...); got != tc.expect {
+			t.Errorf("Tparm(%q, %v) got %q expected %q", tc.cap, tc.params, got, tc.expect)
+		}
+	}
+}
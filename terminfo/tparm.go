@@ -0,0 +1,304 @@
+package terminfo
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Tparm expands the parameterized capability s with params, following
+// the terminfo(5) % escape language. String parameters are not
+// supported. Padding such as $<5> is removed, terminals that need the
+// delays are too slow to matter now.
+func Tparm(s string, params ...int) string {
+	var (
+		out   strings.Builder
+		stack []int
+		p     [9]int
+		// static (A-Z) and dynamic (a-z) variables
+		vars [52]int
+	)
+	copy(p[:], params)
+
+	push := func(v int) {
+		stack = append(stack, v)
+	}
+	pop := func() int {
+		if len(stack) == 0 {
+			return 0
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	varIndex := func(c byte) int {
+		switch {
+		case 'A' <= c && c <= 'Z':
+			return int(c - 'A')
+		case 'a' <= c && c <= 'z':
+			return 26 + int(c-'a')
+		}
+		return -1
+	}
+	boolInt := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			if n := paddingLen(s[i:]); n > 0 {
+				i += n - 1
+				continue
+			}
+		}
+		if c != '%' || i+1 >= len(s) {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+		c = s[i]
+
+		switch c {
+		case '%':
+			out.WriteByte('%')
+		case 'c':
+			out.WriteByte(byte(pop()))
+		case 'p':
+			if i+1 < len(s) && s[i+1] >= '1' && s[i+1] <= '9' {
+				i++
+				push(p[s[i]-'1'])
+			}
+		case 'P':
+			if i+1 < len(s) {
+				i++
+				if v := varIndex(s[i]); v >= 0 {
+					vars[v] = pop()
+				}
+			}
+		case 'g':
+			if i+1 < len(s) {
+				i++
+				if v := varIndex(s[i]); v >= 0 {
+					push(vars[v])
+				}
+			}
+		case '\'':
+			// character constant %'c'
+			if i+2 < len(s) {
+				push(int(s[i+1]))
+				i += 2
+			}
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return out.String()
+			}
+			n, _ := strconv.Atoi(s[i+1 : i+end])
+			push(n)
+			i += end
+		case 'l':
+			// strlen of a string parameter
+			pop()
+			push(0)
+		case 'i':
+			p[0]++
+			p[1]++
+		case '+', '-', '*', '/', 'm', '&', '|', '^', '=', '<', '>', 'A', 'O':
+			b, a := pop(), pop()
+			var v int
+			switch c {
+			case '+':
+				v = a + b
+			case '-':
+				v = a - b
+			case '*':
+				v = a * b
+			case '/':
+				if b != 0 {
+					v = a / b
+				}
+			case 'm':
+				if b != 0 {
+					v = a % b
+				}
+			case '&':
+				v = a & b
+			case '|':
+				v = a | b
+			case '^':
+				v = a ^ b
+			case '=':
+				v = boolInt(a == b)
+			case '<':
+				v = boolInt(a < b)
+			case '>':
+				v = boolInt(a > b)
+			case 'A':
+				v = boolInt(a != 0 && b != 0)
+			case 'O':
+				v = boolInt(a != 0 || b != 0)
+			}
+			push(v)
+		case '!':
+			push(boolInt(pop() == 0))
+		case '~':
+			push(^pop())
+		case '?', ';':
+		case 't':
+			if pop() == 0 {
+				i = skipConditional(s, i, true)
+			}
+		case 'e':
+			// we only get here after taking a then branch
+			i = skipConditional(s, i, false)
+		default:
+			// printf style %[[:]flags][width[.precision]][doxXs]
+			end := i
+			for end < len(s) && strings.IndexByte(":-+# .0123456789", s[end]) >= 0 {
+				end++
+			}
+			if end >= len(s) || strings.IndexByte("doxXs", s[end]) < 0 {
+				out.WriteByte('%')
+				out.WriteByte(c)
+				continue
+			}
+			out.WriteString(format(strings.TrimPrefix(s[i:end], ":"), s[end], pop()))
+			i = end
+		}
+	}
+
+	return out.String()
+}
+
+// skipConditional advances past the current branch of a %? %t %e %;
+// conditional, returning the index of the last byte skipped. If toElse
+// is set we stop after a %e at the same nesting level, otherwise we
+// skip to the closing %;.
+func skipConditional(s string, i int, toElse bool) int {
+	depth := 0
+	for i++; i < len(s); i++ {
+		if s[i] != '%' || i+1 >= len(s) {
+			continue
+		}
+		i++
+		switch s[i] {
+		case '?':
+			depth++
+		case ';':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case 'e':
+			if depth == 0 && toElse {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+func format(flags string, verb byte, v int) string {
+	var (
+		leftAlign bool
+		zeroPad   bool
+		plus      bool
+		space     bool
+		alt       bool
+	)
+
+	i := 0
+flagLoop:
+	for ; i < len(flags); i++ {
+		switch flags[i] {
+		case '-':
+			leftAlign = true
+		case '0':
+			zeroPad = true
+		case '+':
+			plus = true
+		case ' ':
+			space = true
+		case '#':
+			alt = true
+		default:
+			break flagLoop
+		}
+	}
+
+	widthStr, precStr, _ := strings.Cut(flags[i:], ".")
+	width, _ := strconv.Atoi(widthStr)
+	prec, _ := strconv.Atoi(precStr)
+
+	var body string
+	switch verb {
+	case 'd', 's':
+		neg := v < 0
+		if neg {
+			v = -v
+		}
+		body = strconv.Itoa(v)
+		for len(body) < prec {
+			body = "0" + body
+		}
+		if neg {
+			body = "-" + body
+		} else if plus {
+			body = "+" + body
+		} else if space {
+			body = " " + body
+		}
+	case 'o':
+		body = strconv.FormatInt(int64(v), 8)
+		if alt {
+			body = "0" + body
+		}
+	case 'x', 'X':
+		body = strconv.FormatInt(int64(v), 16)
+		for len(body) < prec {
+			body = "0" + body
+		}
+		if alt {
+			body = "0x" + body
+		}
+		if verb == 'X' {
+			body = strings.ToUpper(body)
+		}
+	}
+
+	for len(body) < width {
+		switch {
+		case leftAlign:
+			body += " "
+		case zeroPad:
+			body = "0" + body
+		default:
+			body = " " + body
+		}
+	}
+
+	return body
+}
+
+// paddingLen returns the length of the padding specification, like
+// $<5>, $<3.5*> or $<20/>, that s starts with, or 0 if it doesn't start
+// with one.
+func paddingLen(s string) int {
+	if !strings.HasPrefix(s, "$<") {
+		return 0
+	}
+	i := 2
+	digits := 0
+	for ; i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.'); i++ {
+		digits++
+	}
+	for ; i < len(s) && (s[i] == '*' || s[i] == '/'); i++ {
+	}
+	if digits == 0 || i >= len(s) || s[i] != '>' {
+		return 0
+	}
+	return i + 1
+}
@@ -0,0 +1,97 @@
+package textbuffer
+
+import (
+	"slices"
+	"sort"
+)
+
+// Gravity decides which way an anchor moves when text is inserted at its
+// offset.
+type Gravity int
+
+const (
+	// GravityLeft anchors stay before text inserted at their offset.
+	GravityLeft Gravity = iota
+	// GravityRight anchors move past text inserted at their offset.
+	GravityRight
+)
+
+// An Anchor is a buffer offset that follows the text around it as the
+// buffer is edited. If the text containing it is deleted the anchor
+// moves to the start of the deleted range.
+type Anchor struct {
+	offset  int
+	gravity Gravity
+}
+
+// Offset returns the current offset of the anchor.
+func (a *Anchor) Offset() int {
+	return a.offset
+}
+
+// Gravity returns the gravity the anchor was created with.
+func (a *Anchor) Gravity() Gravity {
+	return a.gravity
+}
+
+// Anchors keeps a set of anchors up to date. TextBuffer implementations
+// hold one and call Inserted and Deleted on every edit.
+type Anchors struct {
+	// list is sorted by offset so an edit only visits the anchors
+	// after it
+	list []*Anchor
+}
+
+// search returns the index of the first anchor at or after offset.
+func (s *Anchors) search(offset int) int {
+	return sort.Search(len(s.list), func(i int) bool {
+		return s.list[i].offset >= offset
+	})
+}
+
+// NewAnchor registers an anchor at offset. The caller is responsible
+// for keeping offset within the buffer.
+func (s *Anchors) NewAnchor(offset int, g Gravity) *Anchor {
+	a := &Anchor{offset: offset, gravity: g}
+	s.list = slices.Insert(s.list, s.search(offset+1), a)
+	return a
+}
+
+// RemoveAnchor stops updating a.
+func (s *Anchors) RemoveAnchor(a *Anchor) {
+	for i := s.search(a.offset); i < len(s.list) && s.list[i].offset == a.offset; i++ {
+		if s.list[i] == a {
+			s.list = slices.Delete(s.list, i, i+1)
+			return
+		}
+	}
+}
+
+// Inserted updates the anchors for n bytes inserted at off.
+func (s *Anchors) Inserted(off, n int) {
+	i := s.search(off)
+	// the anchors at off that stay must come before the ones that
+	// move past the new text
+	j := i
+	for k := i; k < len(s.list) && s.list[k].offset == off; k++ {
+		if s.list[k].gravity == GravityLeft {
+			s.list[j], s.list[k] = s.list[k], s.list[j]
+			j++
+		}
+	}
+	for _, a := range s.list[j:] {
+		a.offset += n
+	}
+}
+
+// Deleted updates the anchors for the bytes in [start, end) being
+// deleted.
+func (s *Anchors) Deleted(start, end int) {
+	for _, a := range s.list[s.search(start+1):] {
+		if a.offset >= end {
+			a.offset -= end - start
+		} else {
+			a.offset = start
+		}
+	}
+}
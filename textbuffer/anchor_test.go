@@ -0,0 +1,61 @@
+package textbuffer
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestAnchorsStaySorted(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var s Anchors
+	size := 1000
+	var all []*Anchor
+	for i := 0; i < 200; i++ {
+		all = append(all, s.NewAnchor(rng.Intn(size+1), Gravity(rng.Intn(2))))
+	}
+
+	for i := 0; i < 2000; i++ {
+		switch rng.Intn(3) {
+		case 0:
+			n := rng.Intn(10) + 1
+			s.Inserted(rng.Intn(size+1), n)
+			size += n
+		case 1:
+			start := rng.Intn(size + 1)
+			end := min(start+rng.Intn(20), size)
+			s.Deleted(start, end)
+			size -= end - start
+		case 2:
+			j := rng.Intn(len(all))
+			s.RemoveAnchor(all[j])
+			all[j] = s.NewAnchor(rng.Intn(size+1), Gravity(rng.Intn(2)))
+		}
+
+		if len(s.list) != len(all) {
+			t.Fatalf("step %d: %d anchors expected %d", i, len(s.list), len(all))
+		}
+		for j := 1; j < len(s.list); j++ {
+			if s.list[j-1].offset > s.list[j].offset {
+				t.Fatalf("step %d: anchor %d at %d after one at %d", i, j, s.list[j].offset, s.list[j-1].offset)
+			}
+		}
+	}
+}
+
+func BenchmarkAnchors(b *testing.B) {
+	var s Anchors
+	size := 1 << 20
+	for i := 0; i < 500; i++ {
+		s.NewAnchor(i*size/500, GravityRight)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// typing near the end of the buffer, as when appending
+		off := size - 100
+		s.Inserted(off, 1)
+		s.Deleted(off, off+1)
+		a := s.NewAnchor(off, GravityLeft)
+		s.RemoveAnchor(a)
+	}
+}
@@ -0,0 +1,71 @@
+package textbuffer
+
+// A Change describes a single edit to a buffer. Offset is where the edit
+// happened, Removed is the text that was there and Inserted the text
+// that replaced it. Either may be empty but not both. CursorBefore and
+// CursorAfter are the buffer cursor before and after the edit.
+//
+// Removed and Inserted belong to the listener and may be kept, but
+// must not be modified.
+type Change struct {
+	Offset       int
+	Removed      []byte
+	Inserted     []byte
+	CursorBefore int
+	CursorAfter  int
+}
+
+type listener struct {
+	id int
+	f  func(Change)
+}
+
+// Listeners is a set of functions to call on every change to a buffer.
+// TextBuffer implementations hold one and call Edited after each edit,
+// then Notify if anyone is listening.
+type Listeners struct {
+	nextID int
+	list   []listener
+	// edits counts the calls to Edited
+	edits int
+}
+
+// Listen registers f to be called after every change. Calling the
+// returned function unregisters it.
+func (s *Listeners) Listen(f func(Change)) (cancel func()) {
+	s.nextID++
+	id := s.nextID
+	s.list = append(s.list, listener{id: id, f: f})
+	return func() {
+		for i, l := range s.list {
+			if l.id == id {
+				s.list = append(s.list[:i:i], s.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Edited counts an edit to the buffer, whether or not anyone is
+// listening.
+func (s *Listeners) Edited() {
+	s.edits++
+}
+
+// Edits returns the number of edits counted by Edited.
+func (s *Listeners) Edits() int {
+	return s.edits
+}
+
+// Active reports whether anyone is listening. Buffers use it to avoid
+// copying text for events nobody will see.
+func (s *Listeners) Active() bool {
+	return len(s.list) > 0
+}
+
+// Notify calls every listener with c.
+func (s *Listeners) Notify(c Change) {
+	for _, l := range s.list {
+		l.f(c)
+	}
+}
@@ -0,0 +1,19 @@
+package textbuffer
+
+import "io"
+
+// A Snapshot is a read only copy of a buffer's text at the time it was
+// taken. Later edits to the buffer don't change it, so it can be handed
+// to another goroutine to save, lex or diff while editing continues.
+//
+// ReadAt is safe for concurrent use. Read and Seek share an offset, so
+// like a bytes.Reader they need a single reader or their own locking.
+type Snapshot struct {
+	*io.SectionReader
+}
+
+// NewSnapshot returns a Snapshot of the first size bytes of r. r must
+// never change and must support concurrent ReadAt calls.
+func NewSnapshot(r io.ReaderAt, size int) *Snapshot {
+	return &Snapshot{io.NewSectionReader(r, 0, int64(size))}
+}
@@ -0,0 +1,90 @@
+// Package textbuffer defines the interface between the editor and the
+// data structure holding the text being edited.
+package textbuffer
+
+import "io"
+
+// TextBuffer is an editable sequence of bytes with a cursor. Inserts and
+// deletes happen at the cursor, which Seek moves. Offsets are byte
+// offsets and lines are zero based and separated by '\n'.
+type TextBuffer interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.WriterTo
+	io.ReaderFrom
+	io.RuneScanner
+
+	// PrevRune returns the rune before the cursor without moving it.
+	// UnreadRune moves back over it, so together with ReadRune the
+	// buffer can be walked a rune at a time in either direction.
+	PrevRune() (r rune, size int, err error)
+
+	// Insert writes p at the cursor and leaves the cursor after it.
+	Insert(p []byte) (int, error)
+	// Delete removes up to n bytes before the cursor and returns them.
+	// The returned slice is only valid until the next modification.
+	Delete(n int) []byte
+	// DeleteForward removes up to n bytes after the cursor and returns
+	// them, with the same lifetime as Delete.
+	DeleteForward(n int) []byte
+	// DeleteRange removes the bytes in [start, end) and leaves the
+	// cursor at start.
+	DeleteRange(start, end int) []byte
+
+	// Bytes returns the bytes in [start, end). The slice may alias the
+	// buffer so it must not be modified and is only valid until the
+	// next modification.
+	Bytes(start, end int) []byte
+
+	// Size returns the length of the buffer in bytes.
+	Size() int
+
+	// GetLine returns the start and end of the nth line relative to the
+	// line containing the cursor. endPos is the position of the newline
+	// unless it is the final line. If offset is out of bounds both
+	// positions are -1.
+	GetLine(offset int) (startPos, endPos int)
+
+	// LineCount returns the number of lines. A trailing newline starts
+	// a final empty line.
+	LineCount() int
+	// LineAt returns the line containing offset.
+	LineAt(offset int) int
+	// LineStart returns the offset of the first byte of line, or -1.
+	LineStart(line int) int
+	// LineEnd returns the offset of the newline ending line, the size
+	// of the buffer for the last line, or -1.
+	LineEnd(line int) int
+
+	// LineCol and LineRuneCol convert an offset to a line and a byte or
+	// rune column.
+	LineCol(offset int) (line, col int)
+	LineRuneCol(offset int) (line, col int)
+	// LineColOffset and LineRuneColOffset convert a line and column to
+	// an offset, clamping both to the buffer.
+	LineColOffset(line, col int) int
+	LineRuneColOffset(line, col int) int
+
+	// NewAnchor returns an anchor at offset that follows the text as
+	// the buffer is edited. RemoveAnchor stops updating it.
+	NewAnchor(offset int, g Gravity) *Anchor
+	RemoveAnchor(a *Anchor)
+
+	// Listen registers f to be called after every edit to the buffer
+	// and returns a function that unregisters it.
+	Listen(f func(Change)) (cancel func())
+	// Edits returns the number of edits made to the buffer. Comparing
+	// two values tells you if it was modified in between, without the
+	// cost of listening.
+	Edits() int
+
+	// Snapshot returns a read only copy of the text that is safe to
+	// read from other goroutines while the buffer is edited.
+	Snapshot() *Snapshot
+
+	// SeekLine and SeekLineCol move the cursor to a line and byte
+	// column.
+	SeekLine(line int) (int64, error)
+	SeekLineCol(line, col int) (int64, error)
+}
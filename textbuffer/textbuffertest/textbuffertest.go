@@ -0,0 +1,714 @@
+// Package textbuffertest implements a conformance suite for
+// textbuffer.TextBuffer implementations.
+package textbuffertest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+
+	"github.com/psanford/hat/textbuffer"
+)
+
+// NewFunc creates a buffer containing initial with the cursor at the
+// start.
+type NewFunc func(initial []byte) textbuffer.TextBuffer
+
+// Run runs the conformance suite against the buffers created by newBuf.
+func Run(t *testing.T, newBuf NewFunc) {
+	t.Run("Edit", func(t *testing.T) { testEdit(t, newBuf) })
+	t.Run("ReadAt", func(t *testing.T) { testReadAt(t, newBuf) })
+	t.Run("Seek", func(t *testing.T) { testSeek(t, newBuf) })
+	t.Run("Runes", func(t *testing.T) { testRunes(t, newBuf) })
+	t.Run("ReadWrite", func(t *testing.T) { testReadWrite(t, newBuf) })
+	t.Run("Lines", func(t *testing.T) { testLines(t, newBuf) })
+	t.Run("Anchors", func(t *testing.T) { testAnchors(t, newBuf) })
+	t.Run("Listen", func(t *testing.T) { testListen(t, newBuf) })
+	t.Run("Edits", func(t *testing.T) { testEdits(t, newBuf) })
+	t.Run("Snapshot", func(t *testing.T) { testSnapshot(t, newBuf) })
+	t.Run("Random", func(t *testing.T) { testRandom(t, newBuf) })
+}
+
+func testEdit(t *testing.T, newBuf NewFunc) {
+	buf := newBuf([]byte("hello world"))
+
+	buf.Seek(5, io.SeekStart)
+	buf.Insert([]byte(","))
+	expectContent(t, buf, "hello, world")
+	expectPos(t, buf, 6)
+
+	buf.Seek(0, io.SeekEnd)
+	buf.Insert([]byte("!\n"))
+	expectContent(t, buf, "hello, world!\n")
+
+	if got := string(buf.Delete(2)); got != "!\n" {
+		t.Errorf("Delete(2) got %q expected %q", got, "!\n")
+	}
+	expectContent(t, buf, "hello, world")
+
+	if got := string(buf.DeleteRange(0, 7)); got != "hello, " {
+		t.Errorf("DeleteRange(0, 7) got %q expected %q", got, "hello, ")
+	}
+	expectContent(t, buf, "world")
+	expectPos(t, buf, 0)
+
+	// deleting before the start of the buffer is a no-op
+	if got := buf.Delete(3); len(got) != 0 {
+		t.Errorf("Delete at start got %q expected nothing", got)
+	}
+
+	// reversed and out of range bounds are clamped
+	if got := string(buf.DeleteRange(100, 3)); got != "ld" {
+		t.Errorf("DeleteRange(100, 3) got %q expected %q", got, "ld")
+	}
+	expectContent(t, buf, "wor")
+	expectPos(t, buf, 3)
+
+	buf = newBuf([]byte("0123456789"))
+	buf.Seek(3, io.SeekStart)
+	if got := string(buf.DeleteForward(2)); got != "34" {
+		t.Errorf("DeleteForward(2) got %q expected %q", got, "34")
+	}
+	expectContent(t, buf, "01256789")
+	expectPos(t, buf, 3)
+	if got := string(buf.DeleteForward(100)); got != "56789" {
+		t.Errorf("DeleteForward(100) got %q expected %q", got, "56789")
+	}
+	expectContent(t, buf, "012")
+
+	buf = newBuf(nil)
+	if buf.Size() != 0 {
+		t.Errorf("empty buffer has size %d", buf.Size())
+	}
+	buf.Insert([]byte("a"))
+	buf.Insert([]byte("b"))
+	buf.Seek(1, io.SeekStart)
+	buf.Insert([]byte("☃"))
+	expectContent(t, buf, "a☃b")
+}
+
+func testReadAt(t *testing.T, newBuf NewFunc) {
+	buf := newBuf([]byte("AB123456"))
+	buf.Seek(0, io.SeekEnd)
+	buf.Insert([]byte("CDE"))
+	buf.Seek(4, io.SeekStart)
+
+	cases := []struct {
+		size   int
+		offset int
+		expect string
+		err    error
+	}{
+		{2, 0, "AB", nil},
+		{2, 7, "6C", nil},
+		{2, 9, "DE", nil},
+		{5, 8, "CDE", io.EOF},
+		{2, 10, "E", io.EOF},
+		{15, 0, "AB123456CDE", io.EOF},
+		{1, 11, "", io.EOF},
+		{1, 20, "", io.EOF},
+		{0, 11, "", nil},
+	}
+
+	for _, tc := range cases {
+		b := make([]byte, tc.size)
+		n, err := buf.ReadAt(b, int64(tc.offset))
+		if string(b[:n]) != tc.expect || err != tc.err {
+			t.Errorf("ReadAt(size=%d, off=%d) got %q, %v expected %q, %v", tc.size, tc.offset, b[:n], err, tc.expect, tc.err)
+		}
+	}
+
+	if _, err := buf.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Errorf("ReadAt(-1) expected error")
+	}
+
+	got, err := io.ReadAll(buf)
+	if err != nil || string(got) != "3456CDE" {
+		t.Errorf("ReadAll from 4 got %q, %v expected %q", got, err, "3456CDE")
+	}
+	expectPos(t, buf, 11)
+}
+
+func testRunes(t *testing.T, newBuf NewFunc) {
+	text := "a☃\xffé\n"
+	buf := newBuf([]byte(text))
+
+	type runeSize struct {
+		r    rune
+		size int
+	}
+	expect := []runeSize{{'a', 1}, {'☃', 3}, {utf8.RuneError, 1}, {'é', 2}, {'\n', 1}}
+
+	for i, e := range expect {
+		r, size, err := buf.ReadRune()
+		if r != e.r || size != e.size || err != nil {
+			t.Fatalf("ReadRune %d got %q,%d,%v expected %q,%d", i, r, size, err, e.r, e.size)
+		}
+	}
+	if _, _, err := buf.ReadRune(); err != io.EOF {
+		t.Fatalf("ReadRune at end got err=%v expected EOF", err)
+	}
+
+	for i := len(expect) - 1; i >= 0; i-- {
+		e := expect[i]
+		r, size, err := buf.PrevRune()
+		if r != e.r || size != e.size || err != nil {
+			t.Fatalf("PrevRune %d got %q,%d,%v expected %q,%d", i, r, size, err, e.r, e.size)
+		}
+		if err := buf.UnreadRune(); err != nil {
+			t.Fatalf("UnreadRune %d: %s", i, err)
+		}
+	}
+	expectPos(t, buf, 0)
+
+	if _, _, err := buf.PrevRune(); err != io.EOF {
+		t.Fatalf("PrevRune at start got err=%v expected EOF", err)
+	}
+	if err := buf.UnreadRune(); err == nil {
+		t.Fatalf("UnreadRune at start expected error")
+	}
+}
+
+func testReadWrite(t *testing.T, newBuf NewFunc) {
+	buf := newBuf([]byte("start end"))
+	buf.Seek(6, io.SeekStart)
+
+	// larger than any internal chunk size
+	middle := bytes.Repeat([]byte("middle\n"), 1000)
+	n, err := buf.ReadFrom(iotest.HalfReader(bytes.NewReader(middle)))
+	if err != nil || n != int64(len(middle)) {
+		t.Fatalf("ReadFrom got %d, %v expected %d", n, err, len(middle))
+	}
+	expect := "start " + string(middle) + "end"
+	expectContent(t, buf, expect)
+	expectPos(t, buf, 6+len(middle))
+	checkLines(t, buf, []byte(expect), 6+len(middle))
+
+	var out bytes.Buffer
+	n, err = buf.WriteTo(&out)
+	if err != nil || n != int64(len(expect)) || out.String() != expect {
+		t.Fatalf("WriteTo got %d, %v expected %d", n, err, len(expect))
+	}
+	expectPos(t, buf, 6+len(middle))
+
+	errRead := errors.New("read failed")
+	n, err = buf.ReadFrom(iotest.DataErrReader(iotest.ErrReader(errRead)))
+	if err != errRead || n != 0 {
+		t.Fatalf("ReadFrom error got %d, %v expected %v", n, err, errRead)
+	}
+
+	for _, r := range [][2]int{{0, 5}, {3, 20}, {len(expect) - 3, len(expect)}, {4, 4}, {len(expect) - 1, len(expect) + 10}} {
+		want := expect[r[0]:min(r[1], len(expect))]
+		if got := string(buf.Bytes(r[0], r[1])); got != want {
+			t.Errorf("Bytes(%d, %d) got %q expected %q", r[0], r[1], got, want)
+		}
+	}
+}
+
+func testSeek(t *testing.T, newBuf NewFunc) {
+	buf := newBuf([]byte("0123456789"))
+
+	cases := []struct {
+		offset int64
+		whence int
+		expect int64
+		err    bool
+	}{
+		{3, io.SeekStart, 3, false},
+		{2, io.SeekCurrent, 5, false},
+		{-1, io.SeekCurrent, 4, false},
+		{2, io.SeekEnd, 8, false},
+		{0, io.SeekEnd, 10, false},
+		{50, io.SeekStart, 10, false},
+		{-1, io.SeekStart, 0, true},
+		{0, 99, 0, true},
+	}
+
+	for _, tc := range cases {
+		got, err := buf.Seek(tc.offset, tc.whence)
+		if (err != nil) != tc.err {
+			t.Errorf("Seek(%d, %d) err=%v expected err=%t", tc.offset, tc.whence, err, tc.err)
+			continue
+		}
+		if !tc.err && got != tc.expect {
+			t.Errorf("Seek(%d, %d) got %d expected %d", tc.offset, tc.whence, got, tc.expect)
+		}
+	}
+
+	buf = newBuf([]byte("ab\nçé☃x\n\nlast"))
+
+	pos, err := buf.SeekLine(1)
+	if err != nil || pos != 3 {
+		t.Errorf("SeekLine(1) got %d, %v expected 3", pos, err)
+	}
+	pos, err = buf.SeekLineCol(3, 2)
+	if err != nil || pos != 15 {
+		t.Errorf("SeekLineCol(3, 2) got %d, %v expected 15", pos, err)
+	}
+	pos, err = buf.SeekLine(50)
+	if err != nil || pos != 13 {
+		t.Errorf("SeekLine(50) got %d, %v expected 13", pos, err)
+	}
+	if _, err := buf.SeekLine(-1); err == nil {
+		t.Errorf("SeekLine(-1) expected error")
+	}
+}
+
+func testLines(t *testing.T, newBuf NewFunc) {
+	texts := []string{
+		"",
+		"\n",
+		"\n\n\n\n",
+		"no newline",
+		"one\ntwo\nthree",
+		"trailing\nnewline\n",
+		"ab\nçé☃x\n\nlast",
+	}
+
+	for _, text := range texts {
+		buf := newBuf([]byte(text))
+		for pos := 0; pos <= len(text); pos++ {
+			buf.Seek(int64(pos), io.SeekStart)
+			checkLines(t, buf, []byte(text), pos)
+		}
+	}
+}
+
+func testAnchors(t *testing.T, newBuf NewFunc) {
+	buf := newBuf([]byte("hello world"))
+
+	left := buf.NewAnchor(5, textbuffer.GravityLeft)
+	right := buf.NewAnchor(5, textbuffer.GravityRight)
+	end := buf.NewAnchor(100, textbuffer.GravityRight)
+	removed := buf.NewAnchor(8, textbuffer.GravityLeft)
+	buf.RemoveAnchor(removed)
+
+	expect := func(step string, l, r, e int) {
+		t.Helper()
+		if left.Offset() != l || right.Offset() != r || end.Offset() != e {
+			t.Fatalf("%s: anchors at %d,%d,%d expected %d,%d,%d", step, left.Offset(), right.Offset(), end.Offset(), l, r, e)
+		}
+	}
+	expect("new", 5, 5, 11)
+
+	buf.Seek(5, io.SeekStart)
+	buf.Insert([]byte(","))
+	expect("insert at anchors", 5, 6, 12)
+	if removed.Offset() != 8 {
+		t.Fatalf("removed anchor moved to %d", removed.Offset())
+	}
+
+	buf.Seek(0, io.SeekStart)
+	buf.Insert([]byte(">> "))
+	expect("insert before", 8, 9, 15)
+
+	buf.Seek(0, io.SeekEnd)
+	buf.Insert([]byte("!"))
+	expect("insert at end", 8, 9, 16)
+
+	buf.DeleteRange(6, 9)
+	expect("delete around", 6, 6, 13)
+
+	buf.Seek(2, io.SeekStart)
+	buf.Delete(2)
+	expect("delete before", 4, 4, 11)
+
+	buf.DeleteForward(100)
+	expect("delete after", 0, 0, 0)
+}
+
+func testListen(t *testing.T, newBuf NewFunc) {
+	buf := newBuf([]byte("hello world"))
+
+	var got []textbuffer.Change
+	cancel := buf.Listen(func(c textbuffer.Change) {
+		got = append(got, c)
+	})
+	var count int
+	buf.Listen(func(textbuffer.Change) {
+		count++
+	})
+
+	expect := func(step string, want ...textbuffer.Change) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d changes expected %d: %+v", step, len(got), len(want), got)
+		}
+		for i := range want {
+			g, w := got[i], want[i]
+			if g.Offset != w.Offset || string(g.Removed) != string(w.Removed) || string(g.Inserted) != string(w.Inserted) ||
+				g.CursorBefore != w.CursorBefore || g.CursorAfter != w.CursorAfter {
+				t.Fatalf("%s: change %d got %+v expected %+v", step, i, g, w)
+			}
+		}
+		got = nil
+	}
+
+	buf.Seek(5, io.SeekStart)
+	buf.Insert([]byte(","))
+	expect("insert", textbuffer.Change{Offset: 5, Inserted: []byte(","), CursorBefore: 5, CursorAfter: 6})
+
+	buf.Insert(nil)
+	buf.Delete(3)
+	expect("delete", textbuffer.Change{Offset: 3, Removed: []byte("lo,"), CursorBefore: 6, CursorAfter: 3})
+
+	buf.DeleteForward(3)
+	expect("delete forward", textbuffer.Change{Offset: 3, Removed: []byte(" wo"), CursorBefore: 3, CursorAfter: 3})
+
+	buf.Seek(0, io.SeekEnd)
+	buf.DeleteRange(0, 2)
+	expect("delete range", textbuffer.Change{Offset: 0, Removed: []byte("he"), CursorBefore: 6, CursorAfter: 0})
+
+	buf.DeleteRange(1, 1)
+	buf.Seek(0, io.SeekStart)
+	buf.Delete(1)
+	expect("empty deletes")
+
+	buf.Seek(1, io.SeekStart)
+	buf.ReadFrom(iotest.OneByteReader(bytes.NewReader([]byte("abc"))))
+	expect("read from", textbuffer.Change{Offset: 1, Inserted: []byte("abc"), CursorBefore: 1, CursorAfter: 4})
+
+	cancel()
+	buf.Insert([]byte("x"))
+	expect("cancelled")
+	expectContent(t, buf, "labcxrld")
+
+	if count != 6 {
+		t.Fatalf("second listener saw %d changes expected 6", count)
+	}
+}
+
+func testEdits(t *testing.T, newBuf NewFunc) {
+	buf := newBuf([]byte("hello world"))
+	start := buf.Edits()
+
+	expect := func(step string, want int) {
+		t.Helper()
+		if got := buf.Edits() - start; got != want {
+			t.Fatalf("%s: got %d edits expected %d", step, got, want)
+		}
+	}
+
+	buf.Seek(5, io.SeekStart)
+	buf.Insert([]byte(","))
+	expect("insert", 1)
+
+	buf.Insert(nil)
+	buf.DeleteRange(2, 2)
+	buf.ReadFrom(bytes.NewReader(nil))
+	expect("empty edits", 1)
+
+	buf.Delete(1)
+	buf.DeleteForward(1)
+	buf.DeleteRange(0, 2)
+	expect("deletes", 4)
+
+	buf.ReadFrom(bytes.NewReader([]byte("abc")))
+	expect("read from", 5)
+}
+
+func testSnapshot(t *testing.T, newBuf NewFunc) {
+	buf := newBuf([]byte("one\ntwo\n"))
+	buf.Seek(4, io.SeekStart)
+
+	snap := buf.Snapshot()
+	if snap.Size() != 8 {
+		t.Fatalf("Size got %d expected 8", snap.Size())
+	}
+
+	buf.Insert([]byte("1.5\n"))
+	buf.Seek(0, io.SeekStart)
+	buf.DeleteForward(2)
+	buf.Seek(0, io.SeekEnd)
+	buf.Insert([]byte("three"))
+	expectContent(t, buf, "e\n1.5\ntwo\nthree")
+
+	got, err := io.ReadAll(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "one\ntwo\n" {
+		t.Fatalf("snapshot got %q expected %q", got, "one\ntwo\n")
+	}
+
+	p := make([]byte, 5)
+	n, err := snap.ReadAt(p, 2)
+	if n != 5 || err != nil || string(p) != "e\ntwo" {
+		t.Fatalf("ReadAt got %d %v %q", n, err, p)
+	}
+	n, err = snap.ReadAt(p, 6)
+	if n != 2 || err != io.EOF || string(p[:n]) != "o\n" {
+		t.Fatalf("ReadAt at end got %d %v %q", n, err, p[:n])
+	}
+
+	// readers in other goroutines see the text as of the snapshot while
+	// the buffer keeps changing
+	var (
+		text  = bytes.Repeat([]byte("0123456789\n"), 1000)
+		snaps []*textbuffer.Snapshot
+		wants []string
+	)
+	buf = newBuf(bytes.Clone(text))
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		snaps = append(snaps, buf.Snapshot())
+		wants = append(wants, string(text))
+
+		buf.Seek(int64(i*1000), io.SeekStart)
+		buf.Insert([]byte("edit"))
+		buf.Seek(0, io.SeekEnd)
+		buf.Delete(7)
+		text = slices.Insert(text, i*1000, []byte("edit")...)
+		text = text[:len(text)-7]
+	}
+	for i := range snaps {
+		go func(snap *textbuffer.Snapshot, want string) {
+			var b bytes.Buffer
+			_, err := b.ReadFrom(snap)
+			if err == nil && b.String() != want {
+				err = errors.New("snapshot changed")
+			}
+			done <- err
+		}(snaps[i], wants[i])
+	}
+	for i := 0; i < 200; i++ {
+		buf.Seek(int64(i*37), io.SeekStart)
+		buf.Insert([]byte("x"))
+		buf.Seek(int64(i*53), io.SeekStart)
+		buf.DeleteForward(1)
+	}
+	for range snaps {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var chunks = []string{"a", "\n", "bc", "\n\n", "d\ne", "fgh\n", "\ni\nj\n", "☃", "é\n"}
+
+func testRandom(t *testing.T, newBuf NewFunc) {
+	rng := rand.New(rand.NewSource(1))
+
+	model := []byte("initial\ncontent\n")
+	buf := newBuf(bytes.Clone(model))
+	pos := 0
+
+	type modelAnchor struct {
+		a      *textbuffer.Anchor
+		offset int
+		right  bool
+	}
+	var anchors []*modelAnchor
+	for off := 0; off <= len(model); off += 4 {
+		anchors = append(anchors,
+			&modelAnchor{buf.NewAnchor(off, textbuffer.GravityLeft), off, false},
+			&modelAnchor{buf.NewAnchor(off, textbuffer.GravityRight), off, true})
+	}
+	inserted := func(off, n int) {
+		for _, a := range anchors {
+			if a.offset > off || a.offset == off && a.right {
+				a.offset += n
+			}
+		}
+	}
+	deleted := func(start, end int) {
+		for _, a := range anchors {
+			if a.offset >= end {
+				a.offset -= end - start
+			} else if a.offset > start {
+				a.offset = start
+			}
+		}
+	}
+
+	// replaying the changes onto a copy should track the buffer
+	replica := bytes.Clone(model)
+	var replicaPos int
+	buf.Listen(func(c textbuffer.Change) {
+		if c.CursorBefore != replicaPos {
+			t.Fatalf("change %+v: cursor before %d expected %d", c, c.CursorBefore, replicaPos)
+		}
+		replica = slices.Replace(replica, c.Offset, c.Offset+len(c.Removed), c.Inserted...)
+		replicaPos = c.CursorAfter
+	})
+
+	for i := 0; i < 1000; i++ {
+		replicaPos = pos
+		switch rng.Intn(7) {
+		case 0, 1:
+			p := []byte(chunks[rng.Intn(len(chunks))])
+			buf.Insert(p)
+			model = append(model[:pos], append(p, model[pos:]...)...)
+			inserted(pos, len(p))
+			pos += len(p)
+		case 2:
+			n := min(rng.Intn(4), pos)
+			buf.Delete(n)
+			model = append(model[:pos-n], model[pos:]...)
+			deleted(pos-n, pos)
+			pos -= n
+		case 3:
+			start := rng.Intn(len(model) + 1)
+			end := start + rng.Intn(len(model)-start+1)
+			buf.DeleteRange(start, end)
+			model = append(model[:start], model[end:]...)
+			deleted(start, end)
+			pos = start
+		case 4:
+			pos = rng.Intn(len(model) + 1)
+			buf.Seek(int64(pos), io.SeekStart)
+		case 5:
+			n := min(rng.Intn(4), len(model)-pos)
+			buf.DeleteForward(n)
+			model = append(model[:pos], model[pos+n:]...)
+			deleted(pos, pos+n)
+		case 6:
+			start := rng.Intn(len(model) + 1)
+			end := start + rng.Intn(len(model)-start+1)
+			if got := buf.Bytes(start, end); !bytes.Equal(got, model[start:end]) {
+				t.Fatalf("step %d: Bytes(%d, %d) got %q expected %q", i, start, end, got, model[start:end])
+			}
+		}
+
+		if t.Failed() {
+			t.Fatalf("step %d failed", i)
+		}
+		expectContent(t, buf, string(model))
+		expectPos(t, buf, pos)
+		checkLines(t, buf, model, pos)
+		if string(replica) != string(model) {
+			t.Fatalf("step %d: replayed changes give %q expected %q", i, replica, model)
+		}
+		for j, a := range anchors {
+			if a.a.Offset() != a.offset {
+				t.Fatalf("step %d: anchor %d at %d expected %d", i, j, a.a.Offset(), a.offset)
+			}
+		}
+	}
+}
+
+// checkLines compares every line query against text, with the cursor at
+// pos.
+func checkLines(t *testing.T, buf textbuffer.TextBuffer, text []byte, pos int) {
+	t.Helper()
+
+	lineStarts := []int{0}
+	for i, c := range text {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	lineEnd := func(line int) int {
+		if line == len(lineStarts)-1 {
+			return len(text)
+		}
+		return lineStarts[line+1] - 1
+	}
+
+	if got := buf.LineCount(); got != len(lineStarts) {
+		t.Fatalf("LineCount got %d expected %d (text=%q)", got, len(lineStarts), text)
+	}
+
+	for line := -1; line <= len(lineStarts); line++ {
+		expectStart, expectEnd := -1, -1
+		if line >= 0 && line < len(lineStarts) {
+			expectStart, expectEnd = lineStarts[line], lineEnd(line)
+		}
+		if got := buf.LineStart(line); got != expectStart {
+			t.Fatalf("LineStart(%d) got %d expected %d (text=%q)", line, got, expectStart, text)
+		}
+		if got := buf.LineEnd(line); got != expectEnd {
+			t.Fatalf("LineEnd(%d) got %d expected %d (text=%q)", line, got, expectEnd, text)
+		}
+	}
+
+	for off := 0; off <= len(text); off++ {
+		line := bytes.Count(text[:off], []byte("\n"))
+		if got := buf.LineAt(off); got != line {
+			t.Fatalf("LineAt(%d) got %d expected %d (text=%q)", off, got, line, text)
+		}
+
+		col := off - lineStarts[line]
+		gotLine, gotCol := buf.LineCol(off)
+		if gotLine != line || gotCol != col {
+			t.Fatalf("LineCol(%d) got %d,%d expected %d,%d (text=%q)", off, gotLine, gotCol, line, col, text)
+		}
+		if got := buf.LineColOffset(line, col); got != off {
+			t.Fatalf("LineColOffset(%d, %d) got %d expected %d (text=%q)", line, col, got, off, text)
+		}
+
+		if !utf8.RuneStart(byteAt(text, off)) {
+			continue
+		}
+		runeCol := utf8.RuneCount(text[lineStarts[line]:off])
+		gotLine, gotCol = buf.LineRuneCol(off)
+		if gotLine != line || gotCol != runeCol {
+			t.Fatalf("LineRuneCol(%d) got %d,%d expected %d,%d (text=%q)", off, gotLine, gotCol, line, runeCol, text)
+		}
+		if got := buf.LineRuneColOffset(line, runeCol); got != off {
+			t.Fatalf("LineRuneColOffset(%d, %d) got %d expected %d (text=%q)", line, runeCol, got, off, text)
+		}
+	}
+
+	last := len(lineStarts) - 1
+	if got := buf.LineColOffset(last+5, 1000); got != len(text) {
+		t.Fatalf("LineColOffset past the end got %d expected %d (text=%q)", got, len(text), text)
+	}
+	if got := buf.LineRuneColOffset(0, 1000); got != lineEnd(0) {
+		t.Fatalf("LineRuneColOffset(0, 1000) got %d expected %d (text=%q)", got, lineEnd(0), text)
+	}
+
+	curLine := bytes.Count(text[:pos], []byte("\n"))
+	for offset := -3; offset <= 3; offset++ {
+		expectStart, expectEnd := -1, -1
+		line := curLine + offset
+		switch {
+		case line < 0 || line > last:
+		case line < last:
+			expectStart, expectEnd = lineStarts[line], lineEnd(line)
+		case offset > 0:
+			expectStart, expectEnd = lineStarts[line], len(text)
+		default:
+			// the final line on the cursor ends at the last byte
+			expectStart, expectEnd = lineStarts[line], max(len(text)-1, lineStarts[line])
+		}
+		gotStart, gotEnd := buf.GetLine(offset)
+		if gotStart != expectStart || gotEnd != expectEnd {
+			t.Fatalf("GetLine(%d) at %d got %d,%d expected %d,%d (text=%q)", offset, pos, gotStart, gotEnd, expectStart, expectEnd, text)
+		}
+	}
+}
+
+func byteAt(b []byte, off int) byte {
+	if off >= len(b) {
+		return 0
+	}
+	return b[off]
+}
+
+func expectContent(t *testing.T, buf textbuffer.TextBuffer, expect string) {
+	t.Helper()
+
+	if buf.Size() != len(expect) {
+		t.Fatalf("Size got %d expected %d", buf.Size(), len(expect))
+	}
+	got := make([]byte, buf.Size())
+	n, _ := buf.ReadAt(got, 0)
+	if string(got[:n]) != expect {
+		t.Fatalf("content got %q expected %q", got[:n], expect)
+	}
+}
+
+func expectPos(t *testing.T, buf textbuffer.TextBuffer, expect int) {
+	t.Helper()
+
+	got, _ := buf.Seek(0, io.SeekCurrent)
+	if int(got) != expect {
+		t.Fatalf("cursor at %d expected %d", got, expect)
+	}
+}
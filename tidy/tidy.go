@@ -0,0 +1,77 @@
+// Package tidy makes the whitespace edits that can be applied to a
+// buffer when it is saved.
+package tidy
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/psanford/hat/textbuffer"
+)
+
+// NormalizeLineEndings removes the \r of every \r\n in buf and replaces
+// the other \r with \n. It reports whether buf changed.
+func NormalizeLineEndings(buf textbuffer.TextBuffer) bool {
+	changed := false
+	// work from the bottom so the earlier line numbers stay valid
+	for l := buf.LineCount() - 1; l >= 0; l-- {
+		start, end := buf.LineStart(l), buf.LineEnd(l)
+		// a copy, Bytes is only valid until the buffer changes
+		line := append([]byte(nil), buf.Bytes(start, end)...)
+		// the last line has no \n of its own
+		lastLine := end == buf.Size()
+		// right to left so the offsets of the earlier bytes stay valid
+		for i := len(line) - 1; i >= 0; i-- {
+			if line[i] != '\r' {
+				continue
+			}
+			buf.DeleteRange(start+i, start+i+1)
+			if i < len(line)-1 || lastLine {
+				// not followed by the line's \n, so it ends a line of
+				// its own
+				buf.Insert([]byte("\n"))
+			}
+			changed = true
+		}
+	}
+	return changed
+}
+
+// TrimTrailingWhitespace removes the spaces and tabs at the end of each
+// line of buf. It reports whether buf changed.
+func TrimTrailingWhitespace(buf textbuffer.TextBuffer) bool {
+	changed := false
+	for l := buf.LineCount() - 1; l >= 0; l-- {
+		start, end := buf.LineStart(l), buf.LineEnd(l)
+		line := buf.Bytes(start, end)
+		if n := len(bytes.TrimRight(line, " \t")); n < len(line) {
+			buf.DeleteRange(start+n, end)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// EnsureFinalNewline makes non-empty text in buf end with exactly one
+// newline. It reports whether buf changed.
+func EnsureFinalNewline(buf textbuffer.TextBuffer) bool {
+	size := buf.Size()
+	if size == 0 {
+		return false
+	}
+
+	end := size
+	for end > 0 && buf.Bytes(end-1, end)[0] == '\n' {
+		end--
+	}
+	switch {
+	case end == size:
+		buf.Seek(0, io.SeekEnd)
+		buf.Insert([]byte("\n"))
+	case end < size-1:
+		buf.DeleteRange(end+1, size)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package tidy
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/psanford/hat/gapbuffer"
+	"github.com/psanford/hat/piecetable"
+	"github.com/psanford/hat/textbuffer"
+)
+
+var backends = []struct {
+	name   string
+	newBuf func(t *testing.T, initial []byte) textbuffer.TextBuffer
+}{
+	{"gap", func(t *testing.T, initial []byte) textbuffer.TextBuffer {
+		buf := gapbuffer.New(2)
+		buf.Insert(initial)
+		buf.Seek(0, io.SeekStart)
+		return buf
+	}},
+	{"piece", func(t *testing.T, initial []byte) textbuffer.TextBuffer {
+		return piecetable.New(initial)
+	}},
+	{"piece-file", func(t *testing.T, initial []byte) textbuffer.TextBuffer {
+		pt, err := piecetable.NewFile(bytes.NewReader(initial), int64(len(initial)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pt
+	}},
+}
+
+type testCase struct {
+	name    string
+	input   string
+	expect  string
+	changed bool
+}
+
+func runCases(t *testing.T, f func(textbuffer.TextBuffer) bool, testCases []testCase) {
+	t.Helper()
+	for _, b := range backends {
+		for _, tc := range testCases {
+			t.Run(b.name+"/"+tc.name, func(t *testing.T) {
+				buf := b.newBuf(t, []byte(tc.input))
+				changed := f(buf)
+				if got := string(buf.Bytes(0, buf.Size())); got != tc.expect {
+					t.Errorf("got %q expected %q", got, tc.expect)
+				}
+				if changed != tc.changed {
+					t.Errorf("got changed %t expected %t", changed, tc.changed)
+				}
+			})
+		}
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	runCases(t, NormalizeLineEndings, []testCase{
+		{"empty", "", "", false},
+		{"lf", "a\nb\n", "a\nb\n", false},
+		{"crlf", "a\r\nb\r\n", "a\nb\n", true},
+		{"cr", "a\rb\r", "a\nb\n", true},
+		{"mixed", "a\r\nb\rc\nd", "a\nb\nc\nd", true},
+		{"cr cr", "a\r\rb", "a\n\nb", true},
+		{"cr crlf", "a\r\r\nb", "a\n\nb", true},
+		{"crlf cr", "a\r\n\rb", "a\n\nb", true},
+		{"trailing cr", "a\r", "a\n", true},
+		{"only crs", "\r\r\r", "\n\n\n", true},
+	})
+}
+
+func TestTrimTrailingWhitespace(t *testing.T) {
+	runCases(t, TrimTrailingWhitespace, []testCase{
+		{"empty", "", "", false},
+		{"clean", "a\n\tb\n", "a\n\tb\n", false},
+		{"spaces and tabs", "a  \nb\t \t\nc", "a\nb\nc", true},
+		{"last line", "a\nb  ", "a\nb", true},
+		{"blank lines", "  \n\t\n", "\n\n", true},
+		{"keeps leading", "  a  \n", "  a\n", true},
+		{"keeps cr", "a \r\n", "a \r\n", false},
+	})
+}
+
+func TestEnsureFinalNewline(t *testing.T) {
+	runCases(t, EnsureFinalNewline, []testCase{
+		{"empty", "", "", false},
+		{"one", "a\n", "a\n", false},
+		{"none", "a", "a\n", true},
+		{"many", "a\n\n\n", "a\n", true},
+		{"only newlines", "\n\n", "\n", true},
+		{"blank last line kept", "a\n \n", "a\n \n", false},
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+
+	"github.com/psanford/hat/textbuffer"
+	"github.com/psanford/hat/tidy"
+)
+
+// saveOptions are the edits made to the buffer whenever it is saved.
+// They are off unless -tidy is given or an EditorConfig file asks for
+// them.
+type saveOptions struct {
+	// trimTrailingWhitespace removes spaces and tabs from the end of
+	// every line
+	trimTrailingWhitespace bool
+	// finalNewline makes the text end with exactly one newline
+	finalNewline bool
+	// normalizeLineEndings turns every \r\n and lone \r in the buffer
+	// into \n, so the file is saved with only the file's line ending
+	normalizeLineEndings bool
+}
+
+// applySaveOptions makes the edits the file's save options ask for
+// before it is written out. The cursor stays with the text around it.
+func (ed *editor) applySaveOptions() {
+	opts := ed.saveOpts
+	if ed.binary || opts == (saveOptions{}) {
+		return
+	}
+
+	off, _ := ed.buf.Seek(0, io.SeekCurrent)
+	cursor := ed.buf.NewAnchor(int(off), textbuffer.GravityRight)
+	defer ed.buf.RemoveAnchor(cursor)
+
+	changed := false
+	if opts.normalizeLineEndings {
+		changed = tidy.NormalizeLineEndings(ed.buf) || changed
+	}
+	if opts.trimTrailingWhitespace {
+		changed = tidy.TrimTrailingWhitespace(ed.buf) || changed
+	}
+	if opts.finalNewline {
+		changed = tidy.EnsureFinalNewline(ed.buf) || changed
+	}
+
+	ed.buf.Seek(int64(cursor.Offset()), io.SeekStart)
+	if changed && ed.disp != nil && !ed.done {
+		// after run returns the terminal is no longer ours
+		ed.disp.Refresh()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/psanford/hat/ansiraw"
+	"github.com/psanford/hat/vimode"
+)
+
+// handleViKey passes key presses to vi mode. It returns false for keys
+// that should get the default handling.
+func (ed *editor) handleViKey(k ansiraw.Key) bool {
+	insert := ed.vi.Mode() == vimode.Insert
+
+	switch k.Code {
+	case ansiraw.KeyEscape:
+		ed.vi.Key(vimode.KeyEsc)
+	case ansiraw.KeyEnter:
+		ed.vi.Key(vimode.KeyEnter)
+	case ansiraw.KeyBackspace:
+		ed.vi.Key(vimode.KeyBackspace)
+	case ansiraw.KeyTab:
+		ed.vi.Key('\t')
+	case ansiraw.KeyRune:
+		switch {
+		case k.Mod&^ansiraw.ModShift == 0:
+			ed.vi.Key(k.Rune)
+		case k.Is('r', ansiraw.ModCtrl):
+			ed.vi.Key(vimode.KeyCtrlR)
+		default:
+			return false
+		}
+	case ansiraw.KeyUp:
+		return !insert && ed.viKey('k')
+	case ansiraw.KeyDown:
+		return !insert && ed.viKey('j')
+	case ansiraw.KeyRight:
+		return !insert && ed.viKey('l')
+	case ansiraw.KeyLeft:
+		return !insert && ed.viKey('h')
+	case ansiraw.KeyDelete:
+		return !insert && ed.viKey('x')
+	case ansiraw.KeyInsert:
+		// toggles overwrite mode in insert mode, like vi's replace mode
+		return !insert && ed.viKey('i')
+	default:
+		return false
+	}
+
+	if ed.disp.Overwrite() && ed.vi.Mode() != vimode.Insert {
+		// overwriting ends with insert mode
+		ed.setOverwrite(false)
+	}
+	return true
+}
+
+func (ed *editor) viKey(r rune) bool {
+	ed.vi.Key(r)
+	return true
+}
+
+// exCommand runs a command entered at vi's ':' prompt.
+func (ed *editor) exCommand(cmd string) error {
+	cmd = strings.TrimSpace(cmd)
+	if opt, ok := strings.CutPrefix(cmd, "set "); ok {
+		return ed.setOptions(opt)
+	}
+	if shell, ok := strings.CutPrefix(cmd, "%!"); ok {
+		return ed.filterRange(0, ed.buf.Size(), shell)
+	}
+	if shell, ok := strings.CutPrefix(cmd, "'<,'>!"); ok {
+		start, end, ok := ed.vi.VisualMarks()
+		if !ok {
+			return errors.New("Mark not set")
+		}
+		return ed.filterRange(start, end, shell)
+	}
+	if rest, ok := strings.CutPrefix(cmd, "r"); ok {
+		if shell, ok := strings.CutPrefix(strings.TrimSpace(rest), "!"); ok {
+			return ed.insertCommandOutput(shell)
+		}
+	}
+
+	switch cmd {
+	case "":
+	case "w":
+		return ed.save()
+	case "q":
+		if ed.modified() {
+			return errors.New("No write since last change (add ! to override)")
+		}
+		ed.quit(exitQuit)
+	case "q!":
+		ed.quit(exitQuit)
+	case "wq", "x":
+		ed.quit(exitSave)
+	default:
+		return fmt.Errorf("Not an editor command: %s", cmd)
+	}
+	return nil
+}
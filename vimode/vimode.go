@@ -0,0 +1,863 @@
+// Package vimode implements vi style modal editing on top of a DisplayBox.
+package vimode
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/psanford/hat/displaybox"
+	"github.com/psanford/hat/textbuffer"
+	"github.com/psanford/hat/vt100"
+)
+
+type Mode int
+
+const (
+	Normal Mode = iota
+	Insert
+	Visual
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Insert:
+		return "insert"
+	case Visual:
+		return "visual"
+	}
+	return "normal"
+}
+
+// Keys that are not printable runes.
+const (
+	KeyEsc       = 0x1b
+	KeyEnter     = '\r'
+	KeyBackspace = 0x7f
+	KeyCtrlR     = 0x12
+)
+
+// maxUndo is the number of undo steps we keep.
+const maxUndo = 100
+
+type Vi struct {
+	d   *displaybox.DisplayBox
+	buf textbuffer.TextBuffer
+
+	// ExCommand is called with the text entered at the ':' prompt.
+	// A non-nil error is shown on the status line.
+	ExCommand func(cmd string) error
+
+	mode Mode
+
+	count  int
+	op     rune // pending operator: d, c or y
+	opCnt  int  // count given before the operator
+	prefix rune // pending 'g' prefix
+
+	// start of the visual selection
+	anchor int
+	// the last visual selection, see VisualMarks
+	visualStart *textbuffer.Anchor
+	visualEnd   *textbuffer.Anchor
+
+	reg         []byte
+	regLinewise bool
+
+	undo []*undoStep
+	redo []*undoStep
+	// undoing is set while undo or redo edits the buffer
+	undoing bool
+	// external is set while edits made outside of vi's commands are
+	// being recorded as an undo step, until the next key
+	external bool
+
+	// keys of the command currently being recorded for '.'
+	keys       []rune
+	lastChange []rune
+	replaying  bool
+	// changed is set when the current command modifies the buffer
+	changed bool
+
+	inEx bool
+	ex   []rune
+}
+
+// undoStep is the edits made by one command, in the order they were
+// made.
+type undoStep struct {
+	changes []textbuffer.Change
+	// cursor is where to put the cursor after the step is undone, or
+	// redone once it has been undone
+	cursor int
+}
+
+func New(d *displaybox.DisplayBox, buf textbuffer.TextBuffer) *Vi {
+	v := &Vi{
+		d:   d,
+		buf: buf,
+	}
+	buf.Listen(v.record)
+	v.setMode(Normal)
+	return v
+}
+
+// Mode returns the current editing mode.
+func (v *Vi) Mode() Mode {
+	return v.mode
+}
+
+// Key handles a single keypress.
+func (v *Vi) Key(r rune) {
+	v.external = false
+
+	if v.inEx {
+		v.exKey(r)
+		return
+	}
+
+	if v.mode == Insert {
+		v.insertKey(r)
+		return
+	}
+
+	if r == '.' && v.op == 0 && v.prefix == 0 && v.mode == Normal {
+		v.repeat()
+		return
+	}
+
+	if !v.replaying {
+		v.keys = append(v.keys, r)
+	}
+
+	v.command(r)
+
+	if v.mode == Normal && !v.inEx {
+		v.clampCursor()
+	}
+
+	if v.pending() || v.mode != Normal {
+		return
+	}
+	v.finishCommand()
+}
+
+// clampCursor keeps the cursor on a character in normal mode. Only
+// insert mode can place the cursor after the last character of a line.
+func (v *Vi) clampCursor() {
+	cur := v.cur()
+	if cur == v.lineEnd(cur) && cur > v.lineStart(cur) {
+		v.d.MvLeft()
+	}
+}
+
+func (v *Vi) pending() bool {
+	return v.count > 0 || v.op != 0 || v.prefix != 0
+}
+
+func (v *Vi) finishCommand() {
+	if v.changed && !v.replaying {
+		v.lastChange = v.keys
+	}
+	v.keys = nil
+	v.changed = false
+}
+
+func (v *Vi) reset() {
+	v.count = 0
+	v.op = 0
+	v.opCnt = 0
+	v.prefix = 0
+}
+
+func (v *Vi) setMode(m Mode) {
+	v.mode = m
+	switch m {
+	case Insert:
+		v.d.SetCursorStyle(vt100.CursorSteadyBar)
+		v.d.SetStatus("-- INSERT --")
+	case Visual:
+		v.d.SetCursorStyle(vt100.CursorSteadyBlock)
+		v.d.SetStatus("-- VISUAL --")
+	default:
+		v.d.SetCursorStyle(vt100.CursorSteadyBlock)
+		v.d.SetStatus("")
+	}
+}
+
+func (v *Vi) insertKey(r rune) {
+	if !v.replaying {
+		v.keys = append(v.keys, r)
+	}
+
+	switch r {
+	case KeyEsc:
+		v.setMode(Normal)
+		// like vi, leave the cursor on the last inserted character
+		v.d.MvLeft()
+		v.finishCommand()
+	case KeyEnter:
+		v.d.InsertNewline()
+	case KeyBackspace:
+		v.d.Backspace()
+	case '\t':
+		v.d.Insert([]byte{'\t'})
+	default:
+		if r < 0x20 {
+			return
+		}
+		v.d.Insert([]byte(string(r)))
+	}
+}
+
+func (v *Vi) command(r rune) {
+	if r >= '1' && r <= '9' || r == '0' && v.count > 0 {
+		v.count = v.count*10 + int(r-'0')
+		return
+	}
+
+	count := v.count
+	v.count = 0
+
+	if v.prefix == 'g' {
+		v.prefix = 0
+		if r != 'g' {
+			v.reset()
+			return
+		}
+		// use a rune that can't be typed to stand in for gg
+		r = motionTop
+	} else if r == 'g' {
+		v.prefix = 'g'
+		v.count = count
+		return
+	}
+
+	if v.op != 0 {
+		v.operatorMotion(r, count)
+		return
+	}
+
+	if v.mode == Visual {
+		v.visualCommand(r, count)
+		return
+	}
+
+	n := max(count, 1)
+
+	switch r {
+	case KeyEsc:
+		v.reset()
+	case 'd', 'c', 'y':
+		v.op = r
+		v.opCnt = count
+	case 'x':
+		v.operate('d', v.cur(), v.forwardRunes(v.cur(), n), false)
+	case 'D':
+		v.op = 'd'
+		v.operatorMotion('$', count)
+	case 'C':
+		v.op = 'c'
+		v.operatorMotion('$', count)
+	case 'i':
+		v.startInsert()
+	case 'a':
+		v.startInsert()
+		if v.cur() < v.lineEnd(v.cur()) {
+			v.d.MvRight()
+		}
+	case 'I':
+		v.startInsert()
+		v.d.MvTo(v.firstNonBlank(v.cur()))
+	case 'A':
+		v.startInsert()
+		v.d.MvEOL()
+	case 'o':
+		v.startInsert()
+		v.d.MvEOL()
+		v.d.InsertNewline()
+	case 'O':
+		v.startInsert()
+		v.d.MvBOL()
+		v.d.InsertNewline()
+		v.d.MvUp()
+	case 'p':
+		v.put(true, n)
+	case 'P':
+		v.put(false, n)
+	case 'u':
+		for i := 0; i < n; i++ {
+			v.undoChange()
+		}
+	case KeyCtrlR:
+		for i := 0; i < n; i++ {
+			v.redoChange()
+		}
+	case 'v':
+		v.anchor = v.cur()
+		v.setMode(Visual)
+		v.updateSelection()
+	case ':':
+		v.startEx("")
+	default:
+		v.motion(r, count)
+	}
+}
+
+func (v *Vi) visualCommand(r rune, count int) {
+	switch r {
+	case KeyEsc, 'v':
+		v.endVisual()
+	case 'd', 'x', 'c', 'y':
+		if r == 'x' {
+			r = 'd'
+		}
+		start, end, _ := v.d.Selection()
+		v.endVisual()
+		v.operate(r, start, end, false)
+	case ':':
+		start, end, _ := v.d.Selection()
+		v.setVisualMarks(start, end)
+		v.endVisual()
+		v.startEx("'<,'>")
+	default:
+		v.motion(r, count)
+		v.updateSelection()
+	}
+}
+
+func (v *Vi) endVisual() {
+	v.d.ClearSelection()
+	v.setMode(Normal)
+}
+
+// setVisualMarks remembers [start, end) as the last visual selection.
+func (v *Vi) setVisualMarks(start, end int) {
+	if v.visualStart != nil {
+		v.buf.RemoveAnchor(v.visualStart)
+		v.buf.RemoveAnchor(v.visualEnd)
+	}
+	v.visualStart = v.buf.NewAnchor(start, textbuffer.GravityLeft)
+	v.visualEnd = v.buf.NewAnchor(end, textbuffer.GravityRight)
+}
+
+// VisualMarks returns the text last selected in visual mode, which the
+// range '<,'> refers to in an ex command. The range follows the text as
+// the buffer is edited.
+func (v *Vi) VisualMarks() (start, end int, ok bool) {
+	if v.visualStart == nil {
+		return 0, 0, false
+	}
+	return v.visualStart.Offset(), v.visualEnd.Offset(), true
+}
+
+func (v *Vi) updateSelection() {
+	start, end := v.anchor, v.cur()
+	if start > end {
+		start, end = end, start
+	}
+	v.d.SetSelection(start, v.forwardRunes(end, 1))
+}
+
+// motion characters that can't be typed directly
+const (
+	motionTop = -1 // gg
+)
+
+// motion moves the cursor. Keys that aren't motions are ignored.
+func (v *Vi) motion(r rune, count int) {
+	n := max(count, 1)
+
+	switch r {
+	case 'h':
+		for i := 0; i < n; i++ {
+			v.d.MvLeft()
+		}
+	case 'l':
+		for i := 0; i < n; i++ {
+			v.d.MvRight()
+		}
+	case 'j':
+		for i := 0; i < n; i++ {
+			v.d.MvDown()
+		}
+	case 'k':
+		for i := 0; i < n; i++ {
+			v.d.MvUp()
+		}
+	case 'w':
+		for i := 0; i < n; i++ {
+			v.d.MvWordForward()
+		}
+	case 'b':
+		for i := 0; i < n; i++ {
+			v.d.MvWordBackward()
+		}
+	case 'e':
+		for i := 0; i < n; i++ {
+			v.d.MvWordEnd()
+		}
+	case '0':
+		v.d.MvBOL()
+	case '$':
+		for i := 1; i < n; i++ {
+			v.d.MvDown()
+		}
+		v.d.MvEOL()
+		if v.mode == Visual {
+			v.clampCursor()
+		}
+	case motionTop:
+		v.d.MvTo(v.lineOffset(n - 1))
+	case 'G':
+		if count > 0 {
+			v.d.MvTo(v.lineOffset(count - 1))
+		} else {
+			v.d.MvTo(v.lastLineStart())
+		}
+	}
+}
+
+func (v *Vi) operatorMotion(r rune, count int) {
+	op := v.op
+	if v.opCnt > 0 {
+		count = max(count, 1) * v.opCnt
+	}
+	n := max(count, 1)
+	v.reset()
+
+	cur := v.cur()
+	var (
+		start, end = cur, cur
+		linewise   bool
+	)
+
+	switch r {
+	case op:
+		// dd, cc, yy
+		linewise = true
+		end = cur
+		for i := 1; i < n; i++ {
+			next := v.lineEnd(end) + 1
+			if next > v.buf.Size() {
+				break
+			}
+			end = next
+		}
+	case 'h':
+		lineStart := v.lineStart(cur)
+		for i := 0; i < n && start > lineStart; i++ {
+			start = v.backRune(start)
+		}
+	case 'l':
+		end = v.forwardRunes(cur, n)
+	case 'w':
+		if op == 'c' && !v.isBlank(cur) {
+			// cw behaves like ce
+			for i := 0; i < n; i++ {
+				end = v.d.WordEnd(end)
+			}
+			end = v.forwardRunes(end, 1)
+			break
+		}
+		for i := 0; i < n; i++ {
+			end = v.d.NextWordStart(end)
+		}
+		// don't delete past the end of the line for the last word
+		if nl := bytes.IndexByte(v.text(cur, end), '\n'); nl > 0 {
+			end = cur + nl
+		}
+	case 'b':
+		for i := 0; i < n; i++ {
+			start = v.d.PrevWordStart(start)
+		}
+	case 'e':
+		for i := 0; i < n; i++ {
+			end = v.d.WordEnd(end)
+		}
+		end = v.forwardRunes(end, 1)
+	case '0':
+		start = v.lineStart(cur)
+	case '$':
+		for i := 1; i < n; i++ {
+			next := v.lineEnd(end) + 1
+			if next > v.buf.Size() {
+				break
+			}
+			end = next
+		}
+		end = v.lineEnd(end)
+	case 'j':
+		linewise = true
+		for i := 0; i < n; i++ {
+			next := v.lineEnd(end) + 1
+			if next > v.buf.Size() {
+				break
+			}
+			end = next
+		}
+	case 'k':
+		linewise = true
+		for i := 0; i < n && start > 0; i++ {
+			start = v.lineStart(v.lineStart(start) - 1)
+		}
+	case motionTop:
+		linewise = true
+		start = v.lineOffset(n - 1)
+	case 'G':
+		linewise = true
+		if count > 0 {
+			end = v.lineOffset(count - 1)
+		} else {
+			end = v.lastLineStart()
+		}
+	default:
+		return
+	}
+
+	v.operate(op, start, end, linewise)
+}
+
+// operate applies op to the text between start and end. For linewise
+// operations start and end may be anywhere on the first and last line.
+func (v *Vi) operate(op rune, start, end int, linewise bool) {
+	if start > end {
+		start, end = end, start
+	}
+
+	var noNewline bool
+	if linewise {
+		start = v.lineStart(start)
+		end = v.lineEnd(end)
+		if end < v.buf.Size() {
+			end++ // include the newline
+		} else {
+			noNewline = true
+		}
+	}
+
+	if start == end && op != 'c' {
+		return
+	}
+
+	text := v.text(start, end)
+	if linewise && !bytes.HasSuffix(text, []byte{'\n'}) {
+		text = append(text, '\n')
+	}
+	v.reg = text
+	v.regLinewise = linewise
+
+	switch op {
+	case 'y':
+		v.d.MvTo(start)
+	case 'd':
+		v.saveUndo()
+		if noNewline && start > 0 {
+			// last line without a trailing newline; remove the newline
+			// before it instead
+			start--
+		}
+		v.d.Replace(start, end, nil, start)
+		if linewise {
+			lineStart := v.lineStart(start)
+			if start == v.buf.Size() {
+				// we deleted the last lines
+				lineStart = v.lastLineStart()
+			}
+			v.d.MvTo(v.firstNonBlank(lineStart))
+		}
+	case 'c':
+		v.saveUndo()
+		if linewise && end > start && v.byteAt(end-1) == '\n' {
+			// keep the line itself
+			end--
+		}
+		v.d.Replace(start, end, nil, start)
+		v.setMode(Insert)
+	}
+}
+
+func (v *Vi) startInsert() {
+	v.saveUndo()
+	v.setMode(Insert)
+}
+
+func (v *Vi) put(after bool, count int) {
+	if len(v.reg) == 0 {
+		return
+	}
+
+	v.saveUndo()
+
+	text := bytes.Repeat(v.reg, count)
+	cur := v.cur()
+
+	if v.regLinewise {
+		var at int
+		if after {
+			at = v.lineEnd(cur)
+			if at == v.buf.Size() {
+				// no newline on the last line
+				text = append([]byte{'\n'}, text[:len(text)-1]...)
+				v.d.Replace(at, at, text, at+1)
+				return
+			}
+			at++
+		} else {
+			at = v.lineStart(cur)
+		}
+		v.d.Replace(at, at, text, at)
+		return
+	}
+
+	at := cur
+	if after && cur < v.lineEnd(cur) {
+		at = v.forwardRunes(cur, 1)
+	}
+	_, lastSize := utf8.DecodeLastRune(text)
+	v.d.Replace(at, at, text, at+len(text)-lastSize)
+}
+
+func (v *Vi) saveUndo() {
+	if v.changed {
+		// already saved for this command
+		return
+	}
+	v.changed = true
+	v.pushUndo(v.cur())
+}
+
+// pushUndo starts a new undo step that puts the cursor back at cursor.
+func (v *Vi) pushUndo(cursor int) {
+	v.undo = append(v.undo, &undoStep{cursor: cursor})
+	if len(v.undo) > maxUndo {
+		v.undo = v.undo[1:]
+	}
+	v.redo = nil
+}
+
+// record adds an edit to the buffer to the current undo step. Edits
+// made outside of vi's commands, by ex commands for example, get a step
+// of their own.
+func (v *Vi) record(c textbuffer.Change) {
+	if v.undoing {
+		return
+	}
+	if !v.changed && !v.external {
+		v.external = true
+		v.pushUndo(c.CursorBefore)
+	}
+	s := v.undo[len(v.undo)-1]
+	s.changes = append(s.changes, c)
+}
+
+func (v *Vi) undoChange() {
+	s := popStep(&v.undo)
+	if s == nil {
+		return
+	}
+
+	// redoing it puts the cursor back here
+	cursor := v.cur()
+	v.undoing = true
+	for i := len(s.changes) - 1; i >= 0; i-- {
+		c := s.changes[i]
+		v.d.Replace(c.Offset, c.Offset+len(c.Inserted), c.Removed, c.Offset)
+	}
+	v.undoing = false
+
+	v.d.MvTo(s.cursor)
+	s.cursor = cursor
+	v.redo = append(v.redo, s)
+}
+
+func (v *Vi) redoChange() {
+	s := popStep(&v.redo)
+	if s == nil {
+		return
+	}
+
+	cursor := v.cur()
+	v.undoing = true
+	for _, c := range s.changes {
+		v.d.Replace(c.Offset, c.Offset+len(c.Removed), c.Inserted, c.Offset)
+	}
+	v.undoing = false
+
+	v.d.MvTo(s.cursor)
+	s.cursor = cursor
+	v.undo = append(v.undo, s)
+}
+
+// popStep removes the last step that made any edits from steps and
+// returns it, or nil if there is none.
+func popStep(steps *[]*undoStep) *undoStep {
+	for len(*steps) > 0 {
+		s := (*steps)[len(*steps)-1]
+		*steps = (*steps)[:len(*steps)-1]
+		if len(s.changes) > 0 {
+			return s
+		}
+	}
+	return nil
+}
+
+// repeat replays the last change. A count given before '.' replaces the
+// count of the original command.
+func (v *Vi) repeat() {
+	count := v.count
+	v.reset()
+	v.keys = nil
+
+	keys := v.lastChange
+	if count > 0 {
+		for len(keys) > 0 && keys[0] >= '0' && keys[0] <= '9' {
+			keys = keys[1:]
+		}
+		var prefix []rune
+		for _, c := range itoa(count) {
+			prefix = append(prefix, c)
+		}
+		keys = append(prefix, keys...)
+	}
+
+	v.replaying = true
+	for _, k := range keys {
+		v.Key(k)
+	}
+	v.replaying = false
+	v.keys = nil
+	v.changed = false
+}
+
+func itoa(n int) string {
+	var b []byte
+	for n > 0 {
+		b = append([]byte{byte('0' + n%10)}, b...)
+		n /= 10
+	}
+	return string(b)
+}
+
+// startEx opens the ':' prompt with text already entered.
+func (v *Vi) startEx(text string) {
+	v.reset()
+	v.inEx = true
+	v.ex = append(v.ex[:0], []rune(text)...)
+	v.d.SetPrompt(":"+text, 1+len(v.ex))
+}
+
+func (v *Vi) exKey(r rune) {
+	switch r {
+	case KeyEsc:
+		v.inEx = false
+		v.d.ClearPrompt()
+	case KeyBackspace:
+		if len(v.ex) == 0 {
+			v.inEx = false
+			v.d.ClearPrompt()
+			return
+		}
+		v.ex = v.ex[:len(v.ex)-1]
+		v.d.SetPrompt(":"+string(v.ex), 1+len(v.ex))
+	case KeyEnter:
+		v.inEx = false
+		v.d.ClearPrompt()
+		if v.ExCommand == nil {
+			return
+		}
+		if err := v.ExCommand(string(v.ex)); err != nil {
+			v.d.SetStatus(err.Error())
+		}
+	default:
+		if r < 0x20 {
+			return
+		}
+		v.ex = append(v.ex, r)
+		v.d.SetPrompt(":"+string(v.ex), 1+len(v.ex))
+	}
+}
+
+func (v *Vi) cur() int {
+	return v.d.Offset()
+}
+
+func (v *Vi) text(start, end int) []byte {
+	b := make([]byte, end-start)
+	n, _ := v.buf.ReadAt(b, int64(start))
+	return b[:n]
+}
+
+func (v *Vi) byteAt(off int) byte {
+	var b [1]byte
+	v.buf.ReadAt(b[:], int64(off))
+	return b[0]
+}
+
+func (v *Vi) isBlank(off int) bool {
+	if off >= v.buf.Size() {
+		return true
+	}
+	c := v.byteAt(off)
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// lineStart returns the offset of the start of the line containing off.
+func (v *Vi) lineStart(off int) int {
+	return v.buf.LineStart(v.buf.LineAt(off))
+}
+
+// lineEnd returns the offset of the newline ending the line containing
+// off, or the size of the buffer if it is the last line.
+func (v *Vi) lineEnd(off int) int {
+	next := v.buf.LineStart(v.buf.LineAt(off) + 1)
+	if next == -1 {
+		return v.buf.Size()
+	}
+	return next - 1
+}
+
+// lineOffset returns the offset of the start of line n (zero indexed).
+func (v *Vi) lineOffset(n int) int {
+	return v.buf.LineStart(min(n, v.buf.LineCount()-1))
+}
+
+// lastLineStart returns the start of the last line, ignoring the empty
+// line after a trailing newline.
+func (v *Vi) lastLineStart() int {
+	end := v.buf.Size()
+	if end > 0 && v.byteAt(end-1) == '\n' {
+		end--
+	}
+	return v.lineStart(end)
+}
+
+func (v *Vi) firstNonBlank(lineStart int) int {
+	off := lineStart
+	for off < v.buf.Size() {
+		c := v.byteAt(off)
+		if c != ' ' && c != '\t' {
+			break
+		}
+		off++
+	}
+	return off
+}
+
+// forwardRunes returns the offset n runes after off without crossing the
+// end of the line.
+func (v *Vi) forwardRunes(off, n int) int {
+	end := v.lineEnd(off)
+	for i := 0; i < n && off < end; i++ {
+		b := v.text(off, min(off+utf8.UTFMax, end))
+		_, size := utf8.DecodeRune(b)
+		off += size
+	}
+	return off
+}
+
+// backRune returns the offset of the rune before off.
+func (v *Vi) backRune(off int) int {
+	b := v.text(max(off-utf8.UTFMax, 0), off)
+	_, size := utf8.DecodeLastRune(b)
+	return off - size
+}
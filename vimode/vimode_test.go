@@ -0,0 +1,421 @@
+package vimode
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/psanford/hat/displaybox"
+	"github.com/psanford/hat/gapbuffer"
+	"github.com/psanford/hat/terminal/mock"
+	"github.com/psanford/hat/vt100"
+)
+
+func TestVi(t *testing.T) {
+	testCases := []struct {
+		name         string
+		text         string
+		keys         string
+		expect       string
+		expectCursor int
+	}{
+		{
+			name:         "insert",
+			text:         "world",
+			keys:         "ihello \x1b",
+			expect:       "hello world",
+			expectCursor: 5,
+		},
+		{
+			name:         "append at end of line",
+			text:         "foo\nbar",
+			keys:         "A!\x1bjA?\x1b",
+			expect:       "foo!\nbar?",
+			expectCursor: 8,
+		},
+		{
+			name:         "open line below and above",
+			text:         "a\nc",
+			keys:         "ob\x1bggOz\x1b",
+			expect:       "z\na\nb\nc",
+			expectCursor: 0,
+		},
+		{
+			name:         "x with count",
+			text:         "abcdef",
+			keys:         "l3x",
+			expect:       "aef",
+			expectCursor: 1,
+		},
+		{
+			name:         "dw",
+			text:         "one two three",
+			keys:         "dw",
+			expect:       "two three",
+			expectCursor: 0,
+		},
+		{
+			name:         "d2w and 2dw",
+			text:         "a b c d e",
+			keys:         "d2w2dw",
+			expect:       "e",
+			expectCursor: 0,
+		},
+		{
+			name:         "dw stops at end of line",
+			text:         "one two\nthree",
+			keys:         "wdw",
+			expect:       "one \nthree",
+			expectCursor: 3,
+		},
+		{
+			name:         "de",
+			text:         "foo.bar baz",
+			keys:         "de",
+			expect:       ".bar baz",
+			expectCursor: 0,
+		},
+		{
+			name:         "db",
+			text:         "foo bar",
+			keys:         "$db",
+			expect:       "foo r",
+			expectCursor: 4,
+		},
+		{
+			name:         "d$ and D",
+			text:         "abc def\nghi jkl",
+			keys:         "wd$jwD",
+			expect:       "abc \nghi ",
+			expectCursor: 8,
+		},
+		{
+			name:         "d0",
+			text:         "abc def",
+			keys:         "wd0",
+			expect:       "def",
+			expectCursor: 0,
+		},
+		{
+			name:         "dd",
+			text:         "one\ntwo\nthree",
+			keys:         "jdd",
+			expect:       "one\nthree",
+			expectCursor: 4,
+		},
+		{
+			name:         "dd on last line",
+			text:         "one\ntwo",
+			keys:         "jdd",
+			expect:       "one",
+			expectCursor: 0,
+		},
+		{
+			name:         "3dd",
+			text:         "1\n2\n3\n4",
+			keys:         "3dd",
+			expect:       "4",
+			expectCursor: 0,
+		},
+		{
+			name:         "dj and dk",
+			text:         "1\n2\n3\n4\n5\n",
+			keys:         "jdjjdk",
+			expect:       "1\n",
+			expectCursor: 0,
+		},
+		{
+			name:         "dG",
+			text:         "1\n2\n3\n",
+			keys:         "jdG",
+			expect:       "1\n",
+			expectCursor: 0,
+		},
+		{
+			name:         "dgg",
+			text:         "1\n2\n3\n",
+			keys:         "jdgg",
+			expect:       "3\n",
+			expectCursor: 0,
+		},
+		{
+			name:         "cw",
+			text:         "foo bar",
+			keys:         "cwbaz\x1b",
+			expect:       "baz bar",
+			expectCursor: 2,
+		},
+		{
+			name:         "cc",
+			text:         "a\nbcd\ne",
+			keys:         "jccx\x1b",
+			expect:       "a\nx\ne",
+			expectCursor: 2,
+		},
+		{
+			name:         "yy and p",
+			text:         "one\ntwo",
+			keys:         "yyjp",
+			expect:       "one\ntwo\none",
+			expectCursor: 8,
+		},
+		{
+			name:         "yw and P",
+			text:         "foo bar",
+			keys:         "ywwP",
+			expect:       "foo foo bar",
+			expectCursor: 7,
+		},
+		{
+			name:         "dd and p",
+			text:         "1\n2\n3\n",
+			keys:         "ddp",
+			expect:       "2\n1\n3\n",
+			expectCursor: 2,
+		},
+		{
+			name:         "x and p",
+			text:         "ab",
+			keys:         "xp",
+			expect:       "ba",
+			expectCursor: 1,
+		},
+		{
+			name:         "insert tab",
+			text:         "foo",
+			keys:         "i\tx\x1b",
+			expect:       "\txfoo",
+			expectCursor: 1,
+		},
+		{
+			name:         "undo",
+			text:         "foo bar",
+			keys:         "dwihello\x1bu",
+			expect:       "bar",
+			expectCursor: 0,
+		},
+		{
+			name:         "undo twice and redo",
+			text:         "foo bar",
+			keys:         "dwxuu\x12",
+			expect:       "bar",
+			expectCursor: 0,
+		},
+		{
+			name:         "undo a change made of many edits",
+			text:         "foo bar",
+			keys:         "wcwhello\x7f\x7fp\x1bu",
+			expect:       "foo bar",
+			expectCursor: 4,
+		},
+		{
+			name:         "undo and redo each change in turn",
+			text:         "abcd",
+			keys:         "xxxuuu\x12\x12",
+			expect:       "cd",
+			expectCursor: 0,
+		},
+		{
+			name:         "insert without typing is not a change",
+			text:         "foo bar",
+			keys:         "xi\x1bu",
+			expect:       "foo bar",
+			expectCursor: 0,
+		},
+		{
+			name:         "nothing to undo or redo",
+			text:         "foo bar",
+			keys:         "wu\x12",
+			expect:       "foo bar",
+			expectCursor: 4,
+		},
+		{
+			name:         "new change drops redo",
+			text:         "abc",
+			keys:         "xux\x12",
+			expect:       "bc",
+			expectCursor: 0,
+		},
+		{
+			name:         "repeat delete",
+			text:         "a b c d",
+			keys:         "dw..",
+			expect:       "d",
+			expectCursor: 0,
+		},
+		{
+			name:         "repeat insert",
+			text:         "x",
+			keys:         "i-\x1b.",
+			expect:       "--x",
+			expectCursor: 0,
+		},
+		{
+			name:         "repeat with count",
+			text:         "abcdefgh",
+			keys:         "x3.",
+			expect:       "efgh",
+			expectCursor: 0,
+		},
+		{
+			name:         "visual delete",
+			text:         "hello world",
+			keys:         "lvlllld",
+			expect:       "hworld",
+			expectCursor: 1,
+		},
+		{
+			name:         "visual yank and put",
+			text:         "ab cd",
+			keys:         "vly$p",
+			expect:       "ab cdab",
+			expectCursor: 6,
+		},
+		{
+			name:         "motions",
+			text:         "one two\nthree four\nfive",
+			keys:         "Gx2ggwxggex",
+			expect:       "on two\nthree our\nive",
+			expectCursor: 2,
+		},
+		{
+			name:         "count G",
+			text:         "1\n2\n3\n4",
+			keys:         "3Gx",
+			expect:       "1\n2\n\n4",
+			expectCursor: 4,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, gb := setup(tc.text)
+			sendKeys(v, tc.keys)
+
+			got := string(gb.DebugInfo().Bytes())
+			if got != tc.expect {
+				t.Errorf("got %q expected %q", got, tc.expect)
+			}
+			if v.d.Offset() != tc.expectCursor {
+				t.Errorf("got cursor %d expected %d", v.d.Offset(), tc.expectCursor)
+			}
+			if v.Mode() != Normal {
+				t.Errorf("expected normal mode but was %s", v.Mode())
+			}
+		})
+	}
+}
+
+func TestViEx(t *testing.T) {
+	v, _ := setup("foo")
+
+	var got []string
+	v.ExCommand = func(cmd string) error {
+		got = append(got, cmd)
+		if cmd == "bad" {
+			return errors.New("Not an editor command: bad")
+		}
+		return nil
+	}
+
+	sendKeys(v, ":wq\r")
+	sendKeys(v, ":bax\x7fd\r")
+	sendKeys(v, ":q\x1b")
+
+	expect := []string{"wq", "bad"}
+	if len(got) != len(expect) {
+		t.Fatalf("got %q expected %q", got, expect)
+	}
+	for i := range got {
+		if got[i] != expect[i] {
+			t.Fatalf("got %q expected %q", got, expect)
+		}
+	}
+
+	// after the prompt we should be back to normal mode editing
+	sendKeys(v, "x")
+	if v.d.Offset() != 0 || v.Mode() != Normal {
+		t.Fatalf("unexpected state after ex prompt: offset=%d mode=%s", v.d.Offset(), v.Mode())
+	}
+}
+
+func TestViExVisualRange(t *testing.T) {
+	v, _ := setup("foo bar baz")
+
+	var got string
+	v.ExCommand = func(cmd string) error {
+		got = cmd
+		return nil
+	}
+
+	if _, _, ok := v.VisualMarks(); ok {
+		t.Fatalf("visual marks set before visual mode was used")
+	}
+
+	sendKeys(v, "wve:!sort\r")
+	if got != "'<,'>!sort" {
+		t.Fatalf("got command %q expected %q", got, "'<,'>!sort")
+	}
+	if start, end, ok := v.VisualMarks(); !ok || start != 4 || end != 7 {
+		t.Fatalf("got visual marks %d %d %t expected 4 7 true", start, end, ok)
+	}
+
+	// the marks follow the text
+	sendKeys(v, "0x")
+	if start, end, _ := v.VisualMarks(); start != 3 || end != 6 {
+		t.Fatalf("got visual marks %d %d after delete expected 3 6", start, end)
+	}
+}
+
+func TestViUndoExternalEdit(t *testing.T) {
+	v, gb := setup("foo bar")
+
+	// an ex command that edits the buffer itself
+	v.ExCommand = func(cmd string) error {
+		text := bytes.ToUpper(gb.Bytes(0, gb.Size()))
+		v.d.Replace(0, gb.Size(), text, 0)
+		return nil
+	}
+
+	steps := []struct {
+		keys   string
+		expect string
+	}{
+		{"x", "oo bar"},
+		{":upper\r", "OO BAR"},
+		{"u", "oo bar"},
+		{"u", "foo bar"},
+		{"\x12", "oo bar"},
+		{"\x12", "OO BAR"},
+	}
+	for _, step := range steps {
+		sendKeys(v, step.keys)
+		if got := string(gb.Bytes(0, gb.Size())); got != step.expect {
+			t.Fatalf("after %q got %q expected %q", step.keys, got, step.expect)
+		}
+	}
+}
+
+func setup(text string) (*Vi, *gapbuffer.GapBuffer) {
+	term := mock.NewMock(40, 10)
+	vt := vt100.New(term)
+	gb := gapbuffer.New(2)
+
+	col, row := term.CursorPos()
+	cursorT := vt100.TermCoord{
+		Col: col,
+		Row: row,
+	}
+	d := displaybox.New(vt, gb, false, cursorT)
+	d.EnableStatusLine()
+	d.Insert([]byte(text))
+	d.MvBOF()
+
+	return New(d, gb), gb
+}
+
+func sendKeys(v *Vi, keys string) {
+	for _, r := range keys {
+		v.Key(r)
+	}
+}
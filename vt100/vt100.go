@@ -6,20 +6,102 @@ import (
 	"io"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/psanford/hat/terminal"
+	"github.com/psanford/hat/terminfo"
 )
 
 type VT100 struct {
 	term terminal.Terminal
+	caps *terminfo.Terminfo
+
+	// modes holds the sequences that turned on the terminal modes that
+	// are turned off again when the terminal is restored, see Resume
+	modes [][2]string
+
+	// cursorStyle is the cursor shape last set by SetCursorStyle
+	cursorStyle CursorStyle
 }
 
+// New returns a VT100 that emits xterm compatible escape sequences.
 func New(t terminal.Terminal) *VT100 {
 	return &VT100{
 		term: t,
+		caps: xtermCaps,
 	}
 }
 
+// NewTerminfo returns a VT100 that emits the escape sequences from the
+// terminfo entry for termName. If there is no entry for termName it
+// returns an error along with a VT100 using the xterm sequences.
+func NewTerminfo(t terminal.Terminal, termName string) (*VT100, error) {
+	caps, err := terminfo.Load(termName)
+	if err != nil {
+		return New(t), err
+	}
+
+	return &VT100{
+		term: t,
+		caps: caps,
+	}, nil
+}
+
+// xtermCaps are the capabilities we use when we don't have a terminfo
+// entry.
+var xtermCaps = &terminfo.Terminfo{
+	Names: []string{"xterm"},
+	Numbers: map[string]int{
+		"colors": 8,
+	},
+	Strings: map[string]string{
+		"el":    "\x1b[K",
+		"cup":   "\x1b[%i%p1%d;%p2%dH",
+		"sc":    "\x1b7",
+		"rc":    "\x1b8",
+		"ind":   "\n",
+		"indn":  "\x1b[%p1%dS",
+		"u7":    "\x1b[6n",
+		"civis": "\x1b[?25l",
+		"cnorm": "\x1b[?25h",
+		"csr":   "\x1b[%i%p1%d;%p2%dr",
+		"il1":   "\x1b[L",
+		"il":    "\x1b[%p1%dL",
+		"dl1":   "\x1b[M",
+		"dl":    "\x1b[%p1%dM",
+		"bold":  "\x1b[1m",
+		"smul":  "\x1b[4m",
+		"rev":   "\x1b[7m",
+		"sgr0":  "\x1b[0m",
+		"setaf": "\x1b[3%p1%dm",
+		"setab": "\x1b[4%p1%dm",
+		"Ss":    "\x1b[%p1%d q",
+	},
+}
+
+// cap writes the string capability name expanded with params. It
+// reports false if the terminal doesn't have the capability.
+func (t *VT100) cap(name string, params ...int) bool {
+	s, ok := t.caps.Strings[name]
+	if !ok {
+		return false
+	}
+	if len(params) > 0 || strings.ContainsAny(s, "%$") {
+		s = terminfo.Tparm(s, params...)
+	}
+	t.term.Write([]byte(s))
+	return true
+}
+
+// Name returns the name of the terminal type we are emitting escape
+// sequences for.
+func (t *VT100) Name() string {
+	if len(t.caps.Names) == 0 {
+		return ""
+	}
+	return t.caps.Names[0]
+}
+
 // Size returns the terminal size in number of columns, rows
 func (t *VT100) Size() TermCoord {
 
@@ -41,7 +123,7 @@ type TermCoord struct {
 }
 
 func (t *VT100) CursorPos() (*TermCoord, []byte, error) {
-	if _, err := t.term.Write([]byte(vt100GetCursorActivePos)); err != nil {
+	if _, err := t.term.Write([]byte(t.cursorPosRequest())); err != nil {
 		return nil, nil, err
 	}
 
@@ -53,6 +135,16 @@ func (t *VT100) CursorPos() (*TermCoord, []byte, error) {
 	return readUntilCursorPosition(r, maxRead)
 }
 
+// cursorPosRequest returns the device status report request for the
+// cursor position. We can't do anything useful without a reply so fall
+// back to the ANSI sequence if terminfo doesn't know it.
+func (t *VT100) cursorPosRequest() string {
+	if s, ok := t.caps.Strings["u7"]; ok {
+		return s
+	}
+	return vt100GetCursorActivePos
+}
+
 type readWrapper struct {
 	term terminal.Terminal
 }
@@ -92,28 +184,267 @@ func readUntilCursorPosition(r io.Reader, maxRead int) (*TermCoord, []byte, erro
 	}
 }
 
+// EnableKittyKeyboard probes for support of the kitty keyboard protocol
+// and turns on its disambiguate escape codes mode if the terminal
+// replies. The mode is popped when the terminal is restored. Any
+// unrelated input read while waiting for the reply is returned.
+func (t *VT100) EnableKittyKeyboard() (bool, []byte, error) {
+	// Terminals that don't support the protocol ignore the query but
+	// still answer the cursor position request.
+	if _, err := t.term.Write([]byte(kittyQueryFlags + t.cursorPosRequest())); err != nil {
+		return false, nil, err
+	}
+
+	r := &readWrapper{
+		term: t.term,
+	}
+
+	_, extra, err := readUntilCursorPosition(r, 1<<24)
+	if err != nil {
+		return false, extra, err
+	}
+
+	supported, extra := parseKittyFlagsReply(extra)
+	if !supported {
+		return false, extra, nil
+	}
+
+	if err := t.enableMode(kittyPushFlags, kittyPopFlags); err != nil {
+		return false, extra, err
+	}
+
+	return true, extra, nil
+}
+
+var kittyFlagsRegex = regexp.MustCompile(`\x1b\[\?\d*u`)
+
+// parseKittyFlagsReply looks for a reply to the kitty keyboard flags
+// query and returns the input with the reply removed.
+func parseKittyFlagsReply(b []byte) (bool, []byte) {
+	loc := kittyFlagsRegex.FindIndex(b)
+	if loc == nil {
+		return false, b
+	}
+	rest := make([]byte, 0, len(b)-(loc[1]-loc[0]))
+	rest = append(rest, b[:loc[0]]...)
+	rest = append(rest, b[loc[1]:]...)
+	return true, rest
+}
+
+// EnableMouse turns on SGR mouse reporting for button presses and drags.
+// Reporting is turned off again when the terminal is restored.
+func (t *VT100) EnableMouse() {
+	t.enableMode(vt100EnableMouse, vt100DisableMouse)
+}
+
+// enableMode writes on and registers off to be written when the
+// terminal is restored.
+func (t *VT100) enableMode(on, off string) error {
+	if _, err := t.term.Write([]byte(on)); err != nil {
+		return err
+	}
+	t.term.OnRestore([]byte(off))
+	t.modes = append(t.modes, [2]string{on, off})
+	return nil
+}
+
+// Suspend restores the terminal to the state we found it in, so
+// another program can use it. Resume takes it back.
+func (t *VT100) Suspend() {
+	t.term.Restore()
+}
+
+// Resume puts the terminal back in raw mode and turns the modes enabled
+// before Suspend back on.
+func (t *VT100) Resume() {
+	t.term.EnableRawMode()
+	for _, m := range t.modes {
+		t.term.Write([]byte(m[0]))
+		t.term.OnRestore([]byte(m[1]))
+	}
+}
+
 func (t *VT100) SaveCursorPos() {
-	t.term.Write([]byte(vt100SaveCursorPosition))
+	t.cap("sc")
 }
 
 func (t *VT100) RestoreCursorPos() {
-	t.term.Write([]byte(vt100RestoreCursorPosition))
+	t.cap("rc")
 }
 
 func (t *VT100) MoveTo(line, col int) {
-	t.term.Write([]byte(fmt.Sprintf(vt100CursorPosition, line, col)))
+	if !t.cap("cup", line-1, col-1) {
+		// cursor addressing is required, assume ANSI
+		t.term.Write([]byte(fmt.Sprintf(vt100CursorPosition, line, col)))
+	}
 }
 
 func (t *VT100) MoveToCoord(coord TermCoord) {
-	t.term.Write([]byte(fmt.Sprintf(vt100CursorPosition, coord.Row, coord.Col)))
+	t.MoveTo(coord.Row, coord.Col)
 }
 
 func (t *VT100) ClearToEndOfLine() {
-	t.term.Write([]byte(vt100ClearToEndOfLine))
+	if !t.cap("el") {
+		t.term.Write([]byte(vt100ClearToEndOfLine))
+	}
 }
 
+// CanScroll reports whether ScrollUp is supported. Callers should redraw
+// instead of scrolling if it is not.
+func (t *VT100) CanScroll() bool {
+	return t.caps.Has("indn") || t.caps.Has("ind")
+}
+
+// ScrollUp scrolls the whole screen up one line. The cursor position is
+// undefined afterwards.
 func (t *VT100) ScrollUp() {
-	t.term.Write([]byte(vtPanDown))
+	if t.cap("indn", 1) {
+		return
+	}
+	if t.caps.Has("ind") {
+		// ind only scrolls when the cursor is on the bottom line
+		size := t.Size()
+		t.MoveTo(size.Row, 1)
+		t.cap("ind")
+	}
+}
+
+// SetScrollRegion restricts scrolling to the rows top through bottom
+// (inclusive, 1 based). It returns false if the terminal doesn't
+// support scroll regions.
+func (t *VT100) SetScrollRegion(top, bottom int) bool {
+	return t.cap("csr", top-1, bottom-1)
+}
+
+// ResetScrollRegion makes the whole screen scrollable again.
+func (t *VT100) ResetScrollRegion() {
+	t.SetScrollRegion(1, t.Size().Row)
+}
+
+// InsertLines inserts n blank lines at the cursor row, pushing the rows
+// below down. It returns false if the terminal doesn't support it.
+func (t *VT100) InsertLines(n int) bool {
+	return t.repeatCap("il", "il1", n)
+}
+
+// DeleteLines deletes n lines starting at the cursor row, pulling the
+// rows below up. It returns false if the terminal doesn't support it.
+func (t *VT100) DeleteLines(n int) bool {
+	return t.repeatCap("dl", "dl1", n)
+}
+
+// repeatCap writes the parameterized capability name with n, or the
+// single step capability one n times if name is missing.
+func (t *VT100) repeatCap(name, one string, n int) bool {
+	if n < 1 {
+		return true
+	}
+	if t.cap(name, n) {
+		return true
+	}
+	if !t.caps.Has(one) {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		t.cap(one)
+	}
+	return true
+}
+
+// HideCursor makes the cursor invisible.
+func (t *VT100) HideCursor() {
+	t.cap("civis")
+}
+
+// ShowCursor makes the cursor visible again after HideCursor.
+func (t *VT100) ShowCursor() {
+	t.cap("cnorm")
+}
+
+// CursorStyle is a DECSCUSR cursor shape.
+type CursorStyle int
+
+const (
+	CursorDefault           CursorStyle = 0
+	CursorBlinkingBlock     CursorStyle = 1
+	CursorSteadyBlock       CursorStyle = 2
+	CursorBlinkingUnderline CursorStyle = 3
+	CursorSteadyUnderline   CursorStyle = 4
+	CursorBlinkingBar       CursorStyle = 5
+	CursorSteadyBar         CursorStyle = 6
+)
+
+// SetCursorStyle changes the shape of the cursor (DECSCUSR). It does
+// nothing if the cursor already has that shape, so CursorDefault only
+// resets a shape we changed, or on terminals that can't change the
+// cursor shape.
+func (t *VT100) SetCursorStyle(style CursorStyle) {
+	if style == t.cursorStyle {
+		return
+	}
+	t.cursorStyle = style
+	// CursorDefault is DECSCUSR 0, the user's configured shape. Se
+	// often resets to a steady block instead.
+	t.cap("Ss", int(style))
+}
+
+// ReverseVideo swaps the foreground and background colors for
+// subsequent writes. Terminals without reverse video get standout mode.
+func (t *VT100) ReverseVideo() {
+	if !t.cap("rev") {
+		t.cap("smso")
+	}
+}
+
+// Bold makes subsequent writes bold.
+func (t *VT100) Bold() {
+	t.cap("bold")
+}
+
+// Underline makes subsequent writes underlined.
+func (t *VT100) Underline() {
+	t.cap("smul")
+}
+
+// Color is a terminal palette index. The first 8 are the standard ANSI
+// colors.
+type Color int
+
+const (
+	ColorBlack Color = iota
+	ColorRed
+	ColorGreen
+	ColorYellow
+	ColorBlue
+	ColorMagenta
+	ColorCyan
+	ColorWhite
+)
+
+// Colors returns the number of colors the terminal supports.
+func (t *VT100) Colors() int {
+	return t.caps.Numbers["colors"]
+}
+
+// SetForeground sets the text color for subsequent writes. It does
+// nothing if the terminal doesn't support c.
+func (t *VT100) SetForeground(c Color) {
+	if int(c) < t.Colors() {
+		t.cap("setaf", int(c))
+	}
+}
+
+// SetBackground sets the background color for subsequent writes. It
+// does nothing if the terminal doesn't support c.
+func (t *VT100) SetBackground(c Color) {
+	if int(c) < t.Colors() {
+		t.cap("setab", int(c))
+	}
+}
+
+// ResetStyle clears all character attributes.
+func (t *VT100) ResetStyle() {
+	t.cap("sgr0")
 }
 
 const (
@@ -132,10 +463,15 @@ const (
 
 	vt100CursorPosition = "\x1b[%d;%dH"
 
-	vt100SaveCursorPosition    = "\x1b7"
-	vt100RestoreCursorPosition = "\x1b8"
+	// report button presses (1000) and drags (1002) using SGR
+	// encoding (1006)
+	vt100EnableMouse  = "\x1b[?1000h\x1b[?1002h\x1b[?1006h"
+	vt100DisableMouse = "\x1b[?1006l\x1b[?1002l\x1b[?1000l"
 
-	vtPanDown = "\x1b[S" // scroll up
+	// kitty progressive keyboard enhancement
+	kittyQueryFlags = "\x1b[?u"
+	kittyPushFlags  = "\x1b[>1u" // disambiguate escape codes
+	kittyPopFlags   = "\x1b[<u"
 
 	// ctrlA = 0x01
 	// ctrlB = 0x02
@@ -57,3 +57,204 @@ func TestReadUntilCursorPosition(t *testing.T) {
 		})
 	}
 }
+
+func TestParseKittyFlagsReply(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         []byte
+		expectSupport bool
+		expectRest    []byte
+	}{
+		{
+			name:          "No reply",
+			input:         []byte{},
+			expectSupport: false,
+			expectRest:    []byte{},
+		},
+		{
+			name:          "Reply",
+			input:         []byte("\x1b[?0u"),
+			expectSupport: true,
+			expectRest:    []byte{},
+		},
+		{
+			name:          "Reply with extra bytes",
+			input:         []byte("ab\x1b[?15ucd"),
+			expectSupport: true,
+			expectRest:    []byte("abcd"),
+		},
+		{
+			name:          "Other input only",
+			input:         []byte("\x1b[A"),
+			expectSupport: false,
+			expectRest:    []byte("\x1b[A"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			supported, rest := parseKittyFlagsReply(tc.input)
+			if supported != tc.expectSupport {
+				t.Errorf("Expect supported %t, got %t", tc.expectSupport, supported)
+			}
+			if !bytes.Equal(rest, tc.expectRest) {
+				t.Errorf("Expect rest %q, got %q", tc.expectRest, rest)
+			}
+		})
+	}
+}
+
+// recordTerm is a terminal.Terminal that records what is written to it.
+type recordTerm struct {
+	bytes.Buffer
+	restoreSeqs [][]byte
+}
+
+func (t *recordTerm) EnableRawMode() {}
+
+func (t *recordTerm) Restore() {
+	for i := len(t.restoreSeqs) - 1; i >= 0; i-- {
+		t.Write(t.restoreSeqs[i])
+	}
+	t.restoreSeqs = nil
+}
+
+func (t *recordTerm) OnRestore(seq []byte) {
+	t.restoreSeqs = append(t.restoreSeqs, seq)
+}
+
+func (t *recordTerm) Size() (int, int)                 { return 80, 24 }
+func (t *recordTerm) UnsafeRead(b []byte) (int, error) { return 0, io.EOF }
+
+func TestSuspendResume(t *testing.T) {
+	var term recordTerm
+	vt := New(&term)
+
+	vt.EnableMouse()
+	vt.Suspend()
+	vt.Resume()
+	term.Restore()
+
+	expect := vt100EnableMouse + vt100DisableMouse + vt100EnableMouse + vt100DisableMouse
+	if got := term.String(); got != expect {
+		t.Errorf("got %q expected %q", got, expect)
+	}
+}
+
+func TestTerminfoCapabilities(t *testing.T) {
+	t.Setenv("TERMINFO", "../terminfo/testdata")
+
+	testCases := []struct {
+		name   string
+		term   string
+		action func(t *testing.T, vt *VT100)
+		expect string
+	}{
+		{
+			name:   "xterm move",
+			term:   "xterm-256color",
+			action: func(t *testing.T, vt *VT100) { vt.MoveTo(3, 7) },
+			expect: "\x1b[3;7H",
+		},
+		{
+			name:   "xterm scroll",
+			term:   "xterm-256color",
+			action: func(t *testing.T, vt *VT100) { vt.ScrollUp() },
+			expect: "\x1b[1S",
+		},
+		{
+			name: "xterm scroll region and lines",
+			term: "xterm-256color",
+			action: func(t *testing.T, vt *VT100) {
+				vt.SetScrollRegion(2, 10)
+				vt.InsertLines(3)
+				vt.DeleteLines(1)
+			},
+			expect: "\x1b[2;10r\x1b[3L\x1b[1M",
+		},
+		{
+			name: "xterm style",
+			term: "xterm-256color",
+			action: func(t *testing.T, vt *VT100) {
+				vt.Bold()
+				vt.SetForeground(ColorRed)
+				vt.ResetStyle()
+			},
+			expect: "\x1b[1m\x1b[31m\x1b(B\x1b[m",
+		},
+		{
+			name: "xterm cursor",
+			term: "xterm-256color",
+			action: func(t *testing.T, vt *VT100) {
+				vt.HideCursor()
+				vt.SetCursorStyle(CursorSteadyBar)
+				vt.SetCursorStyle(CursorDefault)
+			},
+			expect: "\x1b[?25l\x1b[6 q\x1b[0 q",
+		},
+		{
+			name: "cursor style only reset when changed",
+			term: "xterm-256color",
+			action: func(t *testing.T, vt *VT100) {
+				vt.SetCursorStyle(CursorDefault)
+				vt.SetCursorStyle(CursorSteadyBlock)
+				vt.SetCursorStyle(CursorSteadyBlock)
+			},
+			expect: "\x1b[2 q",
+		},
+		{
+			name: "dumb degrades",
+			term: "dumb",
+			action: func(t *testing.T, vt *VT100) {
+				if vt.SetScrollRegion(1, 5) {
+					t.Fatalf("dumb terminal has no scroll region")
+				}
+				if vt.InsertLines(1) || vt.DeleteLines(1) {
+					t.Fatalf("dumb terminal can't insert or delete lines")
+				}
+				vt.HideCursor()
+				vt.SetCursorStyle(CursorSteadyBar)
+				vt.Bold()
+				vt.SetForeground(ColorRed)
+				vt.ReverseVideo()
+				vt.ResetStyle()
+			},
+			expect: "",
+		},
+		{
+			name:   "dumb scroll uses newline on the last row",
+			term:   "dumb",
+			action: func(t *testing.T, vt *VT100) { vt.ScrollUp() },
+			expect: "\x1b[24;1H\n",
+		},
+		{
+			name: "vt100 padding removed",
+			term: "vt100",
+			action: func(t *testing.T, vt *VT100) {
+				vt.MoveTo(2, 3)
+				vt.ClearToEndOfLine()
+				vt.ReverseVideo()
+				vt.Underline()
+				vt.ResetStyle()
+			},
+			expect: "\x1b[2;3H\x1b[K\x1b[7m\x1b[4m\x1b[m\x0f",
+		},
+		{
+			name:   "unknown terminal uses xterm",
+			term:   "no-such-terminal",
+			action: func(t *testing.T, vt *VT100) { vt.ScrollUp(); vt.ClearToEndOfLine() },
+			expect: "\x1b[1S\x1b[K",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			term := &recordTerm{}
+			vt, _ := NewTerminfo(term, tc.term)
+			tc.action(t, vt)
+			if got := term.String(); got != tc.expect {
+				t.Errorf("got %q expected %q", got, tc.expect)
+			}
+		})
+	}
+}